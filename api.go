@@ -21,6 +21,7 @@ package services
 import (
 	"fmt"
 	"github.com/kiprotect/go-helpers/forms"
+	"io"
 	"reflect"
 )
 
@@ -28,6 +29,8 @@ type Context interface {
 	Params() map[string]interface{}
 	Result(data interface{}) Response
 	Error(code int, message string, data interface{}) Response
+	// returns an error from the error catalog
+	Fail(err *APIError, details interface{}) Response
 	InternalError() Response
 	InvalidParams(err error) Response
 	IsInternalError(err Response) bool
@@ -40,6 +43,59 @@ type Context interface {
 type Response interface {
 }
 
+// Returns the HTTP headers of both maps, the first one takes precedence
+func MergeHeaders(headers, defaults map[string]string) map[string]string {
+	merged := make(map[string]string, len(headers)+len(defaults))
+	for key, value := range defaults {
+		merged[key] = value
+	}
+	for key, value := range headers {
+		merged[key] = value
+	}
+	return merged
+}
+
+// Contexts of persistent connections (e.g. WebSockets), over which the server
+// can send notifications to the client
+type NotifyingContext interface {
+	Context
+	Notify(method string, params interface{}) error
+	// registers a function that is called when the connection is closed
+	OnClose(func())
+	// returns a comparable value that identifies the connection
+	ConnectionKey() interface{}
+}
+
+// Contexts that know the network address of the client
+type RemoteContext interface {
+	Context
+	// returns the IP address of the client or an empty string
+	RemoteAddress() string
+}
+
+// Returns the IP address of the client if the context provides it
+func RemoteAddress(context Context) string {
+	if remoteContext, ok := context.(RemoteContext); ok {
+		return remoteContext.RemoteAddress()
+	}
+	return ""
+}
+
+// A result that protocols which support it (e.g. REST) return as-is instead
+// of encoding it as JSON
+type RawResult struct {
+	ContentType string `json:"contentType"`
+	Data        []byte `json:"data"`
+}
+
+// A result that protocols which support it (e.g. REST) stream to the client
+// until the stream function returns. The function should return as soon as
+// the done channel is closed, i.e. when the client has disconnected.
+type StreamResult struct {
+	ContentType string                                             `json:"contentType"`
+	Stream      func(done <-chan struct{}, writer io.Writer) error `json:"-"`
+}
+
 type Request interface {
 }
 
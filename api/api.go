@@ -20,6 +20,7 @@ package api
 
 import (
 	"encoding/json"
+	"github.com/impfen/services-inoeg"
 	"github.com/kiprotect/go-helpers/forms"
 )
 
@@ -34,7 +35,8 @@ const (
 )
 
 type API struct {
-	Name        string      `json:"name"`
+	Name string `json:"name"`
+	// the default version, which is served under the unversioned routes
 	Version     int         `json:"version"`
 	Description string      `json:"description"`
 	Endpoints   []*Endpoint `json:"endpoints"`
@@ -47,6 +49,9 @@ type REST struct {
 
 type ReturnType struct {
 	Validators []forms.Validator
+	// a value of the Go type returned by the endpoint (e.g. false or
+	// &services.Keys{}), used when generating clients
+	Type interface{}
 }
 
 func (r *ReturnType) MarshalJSON() ([]byte, error) {
@@ -67,4 +72,20 @@ type Endpoint struct {
 	REST        *REST       `json:"rest,omitempty"`
 	Form        *forms.Form `json:"form"`
 	ReturnType  *ReturnType `json:"returnType"`
+	// the versions of the API the endpoint belongs to (all if empty)
+	Versions   []int        `json:"versions,omitempty"`
+	Deprecated *Deprecation `json:"deprecated,omitempty"`
+}
+
+// Returns whether the endpoint can only be served via REST, as its result
+// (e.g. a stream or a file) cannot be encoded in a JSON-RPC response
+func (e *Endpoint) RESTOnly() bool {
+	if e.ReturnType == nil {
+		return false
+	}
+	switch e.ReturnType.Type.(type) {
+	case *services.StreamResult, *services.RawResult:
+		return true
+	}
+	return false
 }
@@ -36,12 +36,44 @@ func makeJSONRPCDoc(methods map[string]*jsonrpc.Method, api *API) interface{} {
 	}
 }
 
+func makeOpenAPIDoc(api *API, version int) interface{} {
+	return func(context services.Context, params *APIDocParams) services.Response {
+		if doc, err := api.OpenAPI(version); err != nil {
+			services.Log.Error(err)
+			return context.InternalError()
+		} else {
+			return context.Result(doc)
+		}
+	}
+}
+
+func deprecationHeaders(endpoint *Endpoint) map[string]string {
+	if endpoint.Deprecated == nil {
+		return nil
+	}
+	return endpoint.Deprecated.Headers()
+}
+
 func (c *API) ToJSONRPC(validateSettings *services.ValidateSettings) (jsonrpc.Handler, error) {
 	methods := map[string]*jsonrpc.Method{}
-	for _, endpoint := range c.Endpoints {
-		methods[endpoint.Name] = &jsonrpc.Method{
-			Form:    endpoint.Form,
-			Handler: endpoint.Handler,
+	for _, version := range c.Versions() {
+		endpoints, err := c.VersionEndpoints(version)
+		if err != nil {
+			return nil, err
+		}
+		for _, endpoint := range endpoints {
+			if endpoint.RESTOnly() {
+				continue
+			}
+			method := &jsonrpc.Method{
+				Form:    endpoint.Form,
+				Handler: endpoint.Handler,
+				Headers: deprecationHeaders(endpoint),
+			}
+			methods[VersionedName(endpoint.Name, version)] = method
+			if version == c.Version {
+				methods[endpoint.Name] = method
+			}
 		}
 	}
 	methods["_doc"] = &jsonrpc.Method{
@@ -53,16 +85,44 @@ func (c *API) ToJSONRPC(validateSettings *services.ValidateSettings) (jsonrpc.Ha
 
 func (c *API) ToREST(validateSettings *services.ValidateSettings) (rest.Handler, error) {
 	methods := map[string]*rest.Method{}
-	for _, endpoint := range c.Endpoints {
-		if endpoint.REST == nil {
-			continue
+	for _, version := range c.Versions() {
+		endpoints, err := c.VersionEndpoints(version)
+		if err != nil {
+			return nil, err
 		}
-		methods[endpoint.Name] = &rest.Method{
-			Path:    endpoint.REST.Path,
-			Method:  string(endpoint.REST.Method),
-			Form:    endpoint.Form,
-			Handler: endpoint.Handler,
+		for _, endpoint := range endpoints {
+			if endpoint.REST == nil {
+				continue
+			}
+			methods[VersionedName(endpoint.Name, version)] = &rest.Method{
+				Path:    VersionedPath(endpoint.REST.Path, version),
+				Method:  string(endpoint.REST.Method),
+				Form:    endpoint.Form,
+				Handler: endpoint.Handler,
+				Headers: deprecationHeaders(endpoint),
+			}
+			if version == c.Version {
+				methods[endpoint.Name] = &rest.Method{
+					Path:    endpoint.REST.Path,
+					Method:  string(endpoint.REST.Method),
+					Form:    endpoint.Form,
+					Handler: endpoint.Handler,
+					Headers: deprecationHeaders(endpoint),
+				}
+			}
 		}
+		methods[VersionedName("_openapi", version)] = &rest.Method{
+			Path:    VersionedPath("openapi.json", version),
+			Method:  string(GET),
+			Form:    APIDocForm,
+			Handler: makeOpenAPIDoc(c, version),
+		}
+	}
+	methods["_openapi"] = &rest.Method{
+		Path:    "openapi.json",
+		Method:  string(GET),
+		Form:    APIDocForm,
+		Handler: makeOpenAPIDoc(c, c.Version),
 	}
 	return rest.MethodsHandler(methods, validateSettings)
 }
@@ -0,0 +1,370 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"fmt"
+	"github.com/impfen/services-inoeg"
+	"github.com/kiprotect/go-helpers/forms"
+	"regexp"
+	"strings"
+)
+
+// Validators that are not part of the forms library can describe themselves
+// by implementing this interface. The returned schema is the one to which
+// the following validators of the field apply (e.g. the decoded content of a
+// JSON string).
+type SchemaDescriber interface {
+	DescribeSchema(schema map[string]interface{}) map[string]interface{}
+}
+
+var urlParamRegexp = regexp.MustCompile(`<([a-zA-Z0-9_]+)>`)
+
+type openAPIGenerator struct {
+	schemas map[string]interface{}
+	// the component names of the forms, different forms with the same name
+	// get a numeric suffix
+	names map[*forms.Form]string
+}
+
+func schemaRef(name string) map[string]interface{} {
+	return map[string]interface{}{
+		"$ref": fmt.Sprintf("#/components/schemas/%s", name),
+	}
+}
+
+// Returns the schema of the form, named forms are stored as components
+func (g *openAPIGenerator) formSchema(form *forms.Form) map[string]interface{} {
+
+	if form == nil {
+		return map[string]interface{}{"type": "object"}
+	}
+
+	name := form.Name
+
+	if name != "" {
+		if name, ok := g.names[form]; ok {
+			return schemaRef(name)
+		}
+		for i := 2; ; i++ {
+			if _, ok := g.schemas[name]; !ok {
+				break
+			}
+			name = fmt.Sprintf("%s%d", form.Name, i)
+		}
+		// we reserve the name first in case the form refers to itself
+		g.names[form] = name
+		g.schemas[name] = nil
+	}
+
+	properties := map[string]interface{}{}
+	required := []string{}
+
+	for _, field := range form.Fields {
+		schema, optional := g.fieldSchema(field.Validators)
+		if field.Description != "" {
+			schema["description"] = field.Description
+		}
+		properties[field.Name] = schema
+		if !optional {
+			required = append(required, field.Name)
+		}
+	}
+
+	schema := map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+
+	if name == "" {
+		return schema
+	}
+
+	g.schemas[name] = schema
+
+	return schemaRef(name)
+}
+
+// Returns the schema described by the validators and whether they are optional
+func (g *openAPIGenerator) fieldSchema(validators []forms.Validator) (map[string]interface{}, bool) {
+
+	schema := map[string]interface{}{}
+	target := schema
+	optional := false
+
+	for _, validator := range validators {
+		switch v := validator.(type) {
+		case forms.IsOptional:
+			optional = true
+			if v.Default != nil {
+				target["default"] = v.Default
+			}
+		case forms.IsString:
+			target["type"] = "string"
+			if v.MinLength > 0 {
+				target["minLength"] = v.MinLength
+			}
+			if v.MaxLength > 0 {
+				target["maxLength"] = v.MaxLength
+			}
+		case forms.IsInteger:
+			target["type"] = "integer"
+			if v.HasMin {
+				target["minimum"] = v.Min
+			}
+			if v.HasMax {
+				target["maximum"] = v.Max
+			}
+		case forms.IsFloat:
+			target["type"] = "number"
+			if v.HasMin {
+				target["minimum"] = v.Min
+			}
+			if v.HasMax {
+				target["maximum"] = v.Max
+			}
+		case forms.IsBoolean:
+			target["type"] = "boolean"
+		case forms.IsIn:
+			target["enum"] = v.Choices
+		case forms.IsTime:
+			target["type"] = "string"
+			target["format"] = "date-time"
+		case forms.IsBytes:
+			target["type"] = "string"
+			target["format"] = "byte"
+			if v.Encoding == "hex" {
+				target["format"] = "hex"
+			}
+		case forms.IsHex:
+			target["type"] = "string"
+			target["format"] = "hex"
+		case forms.MatchesRegex:
+			target["type"] = "string"
+			target["pattern"] = v.Regexp.String()
+		case forms.IsStringList:
+			target["type"] = "array"
+			items, _ := g.fieldSchema(v.Validators)
+			items["type"] = "string"
+			target["items"] = items
+		case forms.IsList:
+			target["type"] = "array"
+			items, _ := g.fieldSchema(v.Validators)
+			target["items"] = items
+		case forms.IsStringMap:
+			if v.Form == nil {
+				target["type"] = "object"
+			} else {
+				// we keep descriptions and defaults of the field
+				ref := g.formSchema(v.Form)
+				for key, value := range ref {
+					target[key] = value
+				}
+			}
+		case forms.Or:
+			options := make([]interface{}, 0, len(v.Options))
+			for _, option := range v.Options {
+				optionSchema, _ := g.fieldSchema(option)
+				options = append(options, optionSchema)
+			}
+			target["oneOf"] = options
+		case SchemaDescriber:
+			target = v.DescribeSchema(target)
+		}
+	}
+
+	return schema, optional
+}
+
+func (g *openAPIGenerator) operation(endpoint *Endpoint) map[string]interface{} {
+
+	operation := map[string]interface{}{
+		"operationId": endpoint.Name,
+		"description": endpoint.Description,
+	}
+
+	if deprecation := endpoint.Deprecated; deprecation != nil {
+		operation["deprecated"] = true
+		notes := []string{}
+		if deprecation.Message != "" {
+			notes = append(notes, deprecation.Message)
+		}
+		if !deprecation.Sunset.IsZero() {
+			notes = append(notes, fmt.Sprintf("Will be removed on %s.", deprecation.Sunset.Format("2006-01-02")))
+		}
+		if len(notes) > 0 {
+			operation["description"] = strings.TrimSpace(endpoint.Description + " Deprecated: " + strings.Join(notes, " "))
+		}
+	}
+
+	urlParams := map[string]bool{}
+
+	for _, match := range urlParamRegexp.FindAllStringSubmatch(endpoint.REST.Path, -1) {
+		urlParams[match[1]] = true
+	}
+
+	parameters := []interface{}{}
+
+	if endpoint.REST.Method == GET || len(urlParams) > 0 {
+		for _, field := range endpoint.Form.Fields {
+			if endpoint.REST.Method != GET && !urlParams[field.Name] {
+				continue
+			}
+			schema, optional := g.fieldSchema(field.Validators)
+			parameter := map[string]interface{}{
+				"name":        field.Name,
+				"in":          "query",
+				"description": field.Description,
+				"required":    !optional,
+				"schema":      schema,
+			}
+			if urlParams[field.Name] {
+				parameter["in"] = "path"
+				parameter["required"] = true
+			}
+			parameters = append(parameters, parameter)
+		}
+	}
+
+	if len(parameters) > 0 {
+		operation["parameters"] = parameters
+	}
+
+	if endpoint.REST.Method != GET {
+		operation["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{
+					"schema": g.formSchema(endpoint.Form),
+				},
+			},
+		}
+	}
+
+	result := map[string]interface{}{}
+
+	if endpoint.ReturnType != nil {
+		result, _ = g.fieldSchema(endpoint.ReturnType.Validators)
+	}
+
+	operation["responses"] = map[string]interface{}{
+		"200": map[string]interface{}{
+			"description": "Successful response.",
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{
+					"schema": result,
+				},
+			},
+		},
+		"default": map[string]interface{}{
+			"description": "Error response.",
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{
+					"schema": schemaRef("Error"),
+				},
+			},
+		},
+	}
+
+	return operation
+}
+
+// Generates an OpenAPI 3 document for all endpoints of the given version
+// that have a REST binding
+func (c *API) OpenAPI(version int) (map[string]interface{}, error) {
+
+	endpoints, err := c.VersionEndpoints(version)
+
+	if err != nil {
+		return nil, err
+	}
+
+	codes := make([]interface{}, 0, len(services.ErrorCatalog))
+
+	for _, err := range services.ErrorCatalog {
+		codes = append(codes, err.Code)
+	}
+
+	g := &openAPIGenerator{
+		names: map[*forms.Form]string{},
+		schemas: map[string]interface{}{
+			"Error": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"message": map[string]interface{}{"type": "string"},
+					"data":    schemaRef("ErrorData"),
+				},
+				"required": []string{"message"},
+			},
+			"ErrorData": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"code":       map[string]interface{}{"type": "string", "enum": codes},
+					"serverTime": map[string]interface{}{"type": "string", "format": "date-time"},
+					"retryAfter": map[string]interface{}{"type": "integer", "description": "Seconds after which the request may be retried."},
+					"details":    map[string]interface{}{},
+				},
+				"required": []string{"code", "serverTime"},
+			},
+		},
+	}
+
+	paths := map[string]interface{}{}
+
+	for _, endpoint := range endpoints {
+
+		if endpoint.REST == nil {
+			continue
+		}
+
+		path := "/" + urlParamRegexp.ReplaceAllString(endpoint.REST.Path, "{$1}")
+
+		pathItem, ok := paths[path].(map[string]interface{})
+
+		if !ok {
+			pathItem = map[string]interface{}{}
+			paths[path] = pathItem
+		}
+
+		pathItem[strings.ToLower(string(endpoint.REST.Method))] = g.operation(endpoint)
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.1.0",
+		"info": map[string]interface{}{
+			"title":       c.Name,
+			"description": c.Description,
+			"version":     fmt.Sprintf("%d", version),
+		},
+		// the paths are relative to the versioned prefix
+		"servers": []interface{}{
+			map[string]interface{}{"url": "/" + VersionedPath("", version)},
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": g.schemas,
+		},
+		// the error catalog with the HTTP status of each error code
+		"x-error-codes": services.ErrorCatalog,
+	}, nil
+}
@@ -0,0 +1,248 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package api_test
+
+import (
+	"github.com/impfen/services-inoeg/api"
+	"github.com/kiprotect/go-helpers/forms"
+	"testing"
+)
+
+var testItemForm = forms.Form{
+	Name: "Item",
+	Fields: []forms.Field{
+		{
+			Name: "name",
+			Validators: []forms.Validator{
+				forms.IsString{MinLength: 1, MaxLength: 10},
+			},
+		},
+		{
+			Name: "count",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: 1},
+				forms.IsInteger{HasMin: true, Min: 0},
+			},
+		},
+	},
+}
+
+var testAPI = &api.API{
+	Version: 2,
+	Name:    "test",
+	Endpoints: []*api.Endpoint{
+		{
+			Name: "getItem",
+			Form: &forms.Form{
+				Fields: []forms.Field{
+					{
+						Name:       "id",
+						Validators: []forms.Validator{forms.IsString{}},
+					},
+					{
+						Name:       "verbose",
+						Validators: []forms.Validator{forms.IsOptional{}, forms.IsBoolean{}},
+					},
+				},
+			},
+			ReturnType: &api.ReturnType{
+				Validators: []forms.Validator{forms.IsStringMap{Form: &testItemForm}},
+			},
+			REST: &api.REST{
+				Path:   "items/<id>",
+				Method: api.GET,
+			},
+		},
+		{
+			Name: "addItems",
+			Form: &forms.Form{
+				Fields: []forms.Field{
+					{
+						Name: "items",
+						Validators: []forms.Validator{
+							forms.IsList{
+								Validators: []forms.Validator{forms.IsStringMap{Form: &testItemForm}},
+							},
+						},
+					},
+				},
+			},
+			REST: &api.REST{
+				Path:   "items",
+				Method: api.POST,
+			},
+		},
+		{
+			// endpoints without a REST binding are not documented
+			Name: "subscribe",
+			Form: &forms.Form{},
+		},
+	},
+}
+
+type M = map[string]interface{}
+
+func TestOpenAPI(t *testing.T) {
+
+	doc, err := testAPI.OpenAPI(2)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if doc["openapi"] != "3.1.0" || doc["info"].(M)["version"] != "2" {
+		t.Fatalf("invalid document header: %v", doc)
+	}
+
+	if server := doc["servers"].([]interface{})[0].(M); server["url"] != "/v2/" {
+		t.Fatalf("invalid server: %v", server)
+	}
+
+	paths := doc["paths"].(M)
+
+	if len(paths) != 2 {
+		t.Fatalf("expected two paths, got %d", len(paths))
+	}
+
+	get, ok := paths["/items/{id}"].(M)["get"].(M)
+
+	if !ok {
+		t.Fatalf("path parameters were not converted: %v", paths)
+	}
+
+	parameters := get["parameters"].([]interface{})
+
+	if len(parameters) != 2 {
+		t.Fatalf("expected two parameters, got %d", len(parameters))
+	}
+
+	if id := parameters[0].(M); id["in"] != "path" || id["required"] != true {
+		t.Fatalf("invalid path parameter: %v", id)
+	}
+
+	if verbose := parameters[1].(M); verbose["in"] != "query" || verbose["required"] != false || verbose["schema"].(M)["type"] != "boolean" {
+		t.Fatalf("invalid query parameter: %v", verbose)
+	}
+
+	response := get["responses"].(M)["200"].(M)["content"].(M)["application/json"].(M)["schema"].(M)
+
+	if response["$ref"] != "#/components/schemas/Item" {
+		t.Fatalf("expected a reference to the item schema, got %v", response)
+	}
+
+	post := paths["/items"].(M)["post"].(M)
+	body := post["requestBody"].(M)["content"].(M)["application/json"].(M)["schema"].(M)
+	items := body["properties"].(M)["items"].(M)
+
+	if items["type"] != "array" || items["items"].(M)["$ref"] != "#/components/schemas/Item" {
+		t.Fatalf("invalid list schema: %v", items)
+	}
+
+	item := doc["components"].(M)["schemas"].(M)["Item"].(M)
+
+	if required := item["required"].([]string); len(required) != 1 || required[0] != "name" {
+		t.Fatalf("expected only name to be required, got %v", required)
+	}
+
+	name := item["properties"].(M)["name"].(M)
+
+	if name["type"] != "string" || name["minLength"] != 1 || name["maxLength"] != 10 {
+		t.Fatalf("invalid string schema: %v", name)
+	}
+
+	count := item["properties"].(M)["count"].(M)
+
+	if count["type"] != "integer" || count["default"] != 1 || count["minimum"] != int64(0) {
+		t.Fatalf("invalid integer schema: %v", count)
+	}
+}
+
+func TestOpenAPIFormNameCollision(t *testing.T) {
+
+	// a different form with the same name as testItemForm
+	otherItemForm := forms.Form{
+		Name: "Item",
+		Fields: []forms.Field{
+			{
+				Name:       "label",
+				Validators: []forms.Validator{forms.IsString{}},
+			},
+		},
+	}
+
+	collidingAPI := &api.API{
+		Version: 1,
+		Endpoints: []*api.Endpoint{
+			{
+				Name: "getItem",
+				Form: &forms.Form{},
+				ReturnType: &api.ReturnType{
+					Validators: []forms.Validator{forms.IsStringMap{Form: &testItemForm}},
+				},
+				REST: &api.REST{Path: "item", Method: api.GET},
+			},
+			{
+				Name: "getOtherItem",
+				Form: &forms.Form{},
+				ReturnType: &api.ReturnType{
+					Validators: []forms.Validator{forms.IsStringMap{Form: &otherItemForm}},
+				},
+				REST: &api.REST{Path: "other", Method: api.GET},
+			},
+			{
+				Name: "getItemAgain",
+				Form: &forms.Form{},
+				ReturnType: &api.ReturnType{
+					Validators: []forms.Validator{forms.IsStringMap{Form: &testItemForm}},
+				},
+				REST: &api.REST{Path: "again", Method: api.GET},
+			},
+		},
+	}
+
+	doc, err := collidingAPI.OpenAPI(1)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	responseRef := func(path string) interface{} {
+		return doc["paths"].(M)[path].(M)["get"].(M)["responses"].(M)["200"].(M)["content"].(M)["application/json"].(M)["schema"].(M)["$ref"]
+	}
+
+	item, other, again := responseRef("/item"), responseRef("/other"), responseRef("/again")
+
+	if item == other {
+		t.Fatalf("expected different schemas for different forms, got %v", item)
+	}
+
+	if item != again {
+		t.Fatalf("expected the same schema for the same form, got %v and %v", item, again)
+	}
+
+	schemas := doc["components"].(M)["schemas"].(M)
+
+	if _, ok := schemas["Item"].(M)["properties"].(M)["name"]; !ok {
+		t.Fatalf("invalid item schema: %v", schemas["Item"])
+	}
+
+	if _, ok := schemas["Item2"].(M)["properties"].(M)["label"]; !ok {
+		t.Fatalf("invalid schema of the second item form: %v", schemas["Item2"])
+	}
+}
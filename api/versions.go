@@ -0,0 +1,108 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+)
+
+type Deprecation struct {
+	// when the endpoint was deprecated (optional)
+	Date time.Time `json:"date,omitempty"`
+	// when the endpoint will be removed (optional)
+	Sunset  time.Time `json:"sunset,omitempty"`
+	Message string    `json:"message,omitempty"`
+}
+
+// Returns the headers that announce the deprecation to clients (RFC 9745 and
+// RFC 8594)
+func (d *Deprecation) Headers() map[string]string {
+	headers := map[string]string{
+		"Deprecation": "true",
+	}
+	if !d.Date.IsZero() {
+		headers["Deprecation"] = fmt.Sprintf("@%d", d.Date.Unix())
+	}
+	if !d.Sunset.IsZero() {
+		headers["Sunset"] = d.Sunset.UTC().Format(http.TimeFormat)
+	}
+	return headers
+}
+
+// Returns whether the endpoint belongs to the given version of the API.
+// Endpoints that don't declare versions belong to all versions.
+func (e *Endpoint) InVersion(version int) bool {
+	if len(e.Versions) == 0 {
+		return true
+	}
+	for _, v := range e.Versions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns all versions of the API in ascending order
+func (c *API) Versions() []int {
+	seen := map[int]bool{c.Version: true}
+	versions := []int{c.Version}
+	for _, endpoint := range c.Endpoints {
+		for _, version := range endpoint.Versions {
+			if !seen[version] {
+				seen[version] = true
+				versions = append(versions, version)
+			}
+		}
+	}
+	sort.Ints(versions)
+	return versions
+}
+
+// Returns the endpoints of the given version of the API
+func (c *API) VersionEndpoints(version int) ([]*Endpoint, error) {
+	names := map[string]bool{}
+	endpoints := []*Endpoint{}
+	for _, endpoint := range c.Endpoints {
+		if !endpoint.InVersion(version) {
+			continue
+		}
+		if names[endpoint.Name] {
+			return nil, fmt.Errorf("endpoint %s defined twice for version %d", endpoint.Name, version)
+		}
+		names[endpoint.Name] = true
+		endpoints = append(endpoints, endpoint)
+	}
+	return endpoints, nil
+}
+
+// The JSON-RPC method name of an endpoint in the given version. The endpoints
+// of the default version are also available under their plain names.
+func VersionedName(name string, version int) string {
+	return fmt.Sprintf("%s.v%d", name, version)
+}
+
+// The REST path of an endpoint in the given version. The endpoints of the
+// default version are also available under their plain paths.
+func VersionedPath(path string, version int) string {
+	return fmt.Sprintf("v%d/%s", version, path)
+}
@@ -0,0 +1,209 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package api_test
+
+import (
+	"github.com/impfen/services-inoeg"
+	"github.com/impfen/services-inoeg/api"
+	"github.com/impfen/services-inoeg/http"
+	"github.com/impfen/services-inoeg/jsonrpc"
+	"github.com/impfen/services-inoeg/rest"
+	"github.com/kiprotect/go-helpers/forms"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type versionParams struct{}
+
+func versionHandler(result string) func(services.Context, *versionParams) services.Response {
+	return func(context services.Context, params *versionParams) services.Response {
+		return context.Result(result)
+	}
+}
+
+var sunset = time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+var versionedAPI = &api.API{
+	Version: 1,
+	Name:    "versioned",
+	Endpoints: []*api.Endpoint{
+		{
+			Name:     "getItem",
+			Form:     &forms.Form{},
+			Handler:  versionHandler("v1"),
+			Versions: []int{1},
+			REST:     &api.REST{Path: "item", Method: api.GET},
+			Deprecated: &api.Deprecation{
+				Sunset:  sunset,
+				Message: "Use version 2.",
+			},
+		},
+		{
+			Name:     "getItem",
+			Form:     &forms.Form{},
+			Handler:  versionHandler("v2"),
+			Versions: []int{2},
+			REST:     &api.REST{Path: "item", Method: api.GET},
+		},
+		{
+			// belongs to all versions
+			Name:    "getStatus",
+			Form:    &forms.Form{},
+			Handler: versionHandler("status"),
+			REST:    &api.REST{Path: "status", Method: api.GET},
+		},
+	},
+}
+
+func TestVersionedJSONRPC(t *testing.T) {
+
+	handler, err := versionedAPI.ToJSONRPC(nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for method, expected := range map[string]string{
+		"getItem":      "v1",
+		"getItem.v1":   "v1",
+		"getItem.v2":   "v2",
+		"getStatus":    "status",
+		"getStatus.v2": "status",
+	} {
+		response := handler(&jsonrpc.Context{Request: &jsonrpc.Request{Method: method, Params: map[string]interface{}{}}})
+		if response.Error != nil || response.Result != expected {
+			t.Fatalf("%s: expected %s, got %v (%v)", method, expected, response.Result, response.Error)
+		}
+		if deprecated := response.Headers["Deprecation"] == "true"; deprecated != (expected == "v1") {
+			t.Fatalf("%s: unexpected headers %v", method, response.Headers)
+		}
+	}
+
+	if response := handler(&jsonrpc.Context{Request: &jsonrpc.Request{Method: "getItem.v3", Params: map[string]interface{}{}}}); response.Error == nil {
+		t.Fatalf("expected an error for an unknown version")
+	}
+}
+
+func TestVersionedREST(t *testing.T) {
+
+	handler, err := versionedAPI.ToREST(nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for path, expected := range map[string]string{
+		"/item":      "v1",
+		"/v1/item":   "v1",
+		"/v2/item":   "v2",
+		"/v2/status": "status",
+	} {
+		request := httptest.NewRequest("GET", path, nil)
+		context := &rest.Context{HTTP: http.MakeContext(httptest.NewRecorder(), request)}
+		response := handler(context)
+		if response.StatusCode != 200 || response.Data != expected {
+			t.Fatalf("%s: expected %s, got %d (%v)", path, expected, response.StatusCode, response.Data)
+		}
+		if expected == "v1" && response.Headers["Sunset"] != "Tue, 01 Jan 2030 00:00:00 GMT" {
+			t.Fatalf("%s: expected a sunset header, got %v", path, response.Headers)
+		}
+	}
+}
+
+func TestDuplicateVersionEndpoints(t *testing.T) {
+
+	duplicated := &api.API{
+		Version: 1,
+		Endpoints: []*api.Endpoint{
+			{Name: "getItem", Form: &forms.Form{}, Handler: versionHandler("a")},
+			{Name: "getItem", Form: &forms.Form{}, Handler: versionHandler("b"), Versions: []int{2}},
+		},
+	}
+
+	if _, err := duplicated.ToJSONRPC(nil); err == nil {
+		t.Fatalf("expected an error for an endpoint defined twice in version 2")
+	}
+}
+
+func TestRESTOnlyEndpoints(t *testing.T) {
+
+	streaming := &api.API{
+		Version: 1,
+		Endpoints: []*api.Endpoint{
+			{
+				Name:       "exportItems",
+				Form:       &forms.Form{},
+				Handler:    versionHandler("export"),
+				REST:       &api.REST{Path: "items/export", Method: api.GET},
+				ReturnType: &api.ReturnType{Type: &services.RawResult{}},
+			},
+		},
+	}
+
+	handler, err := streaming.ToJSONRPC(nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if response := handler(&jsonrpc.Context{Request: &jsonrpc.Request{Method: "exportItems", Params: map[string]interface{}{}}}); response.Error == nil {
+		t.Fatalf("expected raw results not to be served via JSON-RPC")
+	}
+
+	restHandler, err := streaming.ToREST(nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := httptest.NewRequest("GET", "/items/export", nil)
+	if response := restHandler(&rest.Context{HTTP: http.MakeContext(httptest.NewRecorder(), request)}); response.StatusCode != 200 {
+		t.Fatalf("expected raw results to be served via REST, got %d", response.StatusCode)
+	}
+}
+
+func TestDeprecationKeepsResponseHeaders(t *testing.T) {
+
+	deprecated := &api.API{
+		Version: 1,
+		Endpoints: []*api.Endpoint{
+			{
+				Name: "getItem",
+				Form: &forms.Form{},
+				Handler: func(context services.Context, params *versionParams) services.Response {
+					return context.Fail(services.ErrLockTimeout, nil)
+				},
+				Deprecated: &api.Deprecation{},
+			},
+		},
+	}
+
+	handler, err := deprecated.ToJSONRPC(nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response := handler(&jsonrpc.Context{Request: &jsonrpc.Request{Method: "getItem", Params: map[string]interface{}{}}})
+
+	if response.Headers["Deprecation"] != "true" || response.Headers["Retry-After"] != "1" {
+		t.Fatalf("expected both the deprecation and the error headers, got %v", response.Headers)
+	}
+}
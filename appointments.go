@@ -47,6 +47,7 @@ type ConfirmProviderSignedParams struct {
 // stored here...
 type ConfirmProviderParams struct {
 	Timestamp             time.Time              `json:"timestamp"`
+	IdempotencyKey        string                 `json:"idempotencyKey,omitempty"`
 	PublicProviderData    *SignedProviderData    `json:"publicProviderData"`
 	ConfirmedProviderData *ConfirmedProviderData `json:"confirmedProviderData"`
 	SignedKeyData         *SignedProviderKeyData `json:"signedKeyData"`
@@ -82,9 +83,11 @@ func (k *ProviderKeyData) Sign(key *crypto.Key) (*SignedProviderKeyData, error)
 }
 
 type ProviderKeyData struct {
-	Signing    []byte             `json:"signing"`
-	Encryption []byte             `json:"encryption"`
-	QueueData  *ProviderQueueData `json:"queueData"`
+	Signing        []byte             `json:"signing"`
+	Encryption     []byte             `json:"encryption"`
+	SigningType    string             `json:"signingType,omitempty"`
+	EncryptionType string             `json:"encryptionType,omitempty"`
+	QueueData      *ProviderQueueData `json:"queueData"`
 }
 
 type ProviderQueueData struct {
@@ -105,6 +108,26 @@ type ResetDBParams struct {
 	Timestamp time.Time `json:"timestamp"`
 }
 
+// GetEvents
+
+type GetEventsSignedParams struct {
+	JSON      string           `json:"data" coerce:"name:json"`
+	Data      *GetEventsParams `json:"-" coerce:"name:data"`
+	Signature []byte           `json:"signature"`
+	PublicKey []byte           `json:"publicKey"`
+}
+
+type GetEventsParams struct {
+	Timestamp time.Time `json:"timestamp"`
+	Cursor    int64     `json:"cursor"`
+	Limit     int64     `json:"limit"`
+}
+
+type EventsFeed struct {
+	Events []*OutboxEvent `json:"events"`
+	Cursor int64          `json:"cursor"`
+}
+
 // AddMediatorPublicKeys
 
 type AddMediatorPublicKeysSignedParams struct {
@@ -115,8 +138,9 @@ type AddMediatorPublicKeysSignedParams struct {
 }
 
 type AddMediatorPublicKeysParams struct {
-	Timestamp     time.Time              `json:"timestamp"`
-	SignedKeyData *SignedMediatorKeyData `json:"signedKeyData"`
+	Timestamp      time.Time              `json:"timestamp"`
+	IdempotencyKey string                 `json:"idempotencyKey,omitempty"`
+	SignedKeyData  *SignedMediatorKeyData `json:"signedKeyData"`
 }
 
 type SignedMediatorKeyData struct {
@@ -156,9 +180,10 @@ type AddCodesParams struct {
 }
 
 type CodesData struct {
-	Actor     string    `json:"actor"`
-	Timestamp time.Time `json:"timestamp"`
-	Codes     [][]byte  `json:"codes"`
+	Actor          string    `json:"actor"`
+	Timestamp      time.Time `json:"timestamp"`
+	IdempotencyKey string    `json:"idempotencyKey,omitempty"`
+	Codes          [][]byte  `json:"codes"`
 }
 
 // UploadDistances
@@ -171,9 +196,10 @@ type UploadDistancesSignedParams struct {
 }
 
 type UploadDistancesParams struct {
-	Timestamp time.Time  `json:"timestamp"`
-	Type      string     `json:"type"`
-	Distances []Distance `json:"distances"`
+	Timestamp      time.Time  `json:"timestamp"`
+	IdempotencyKey string     `json:"idempotencyKey,omitempty"`
+	Type           string     `json:"type"`
+	Distances      []Distance `json:"distances"`
 }
 
 type Distance struct {
@@ -233,8 +259,10 @@ func (a *ActorKey) ProviderKeyData() (*ProviderKeyData, error) {
 }
 
 type ActorKeyData struct {
-	Encryption []byte `json:"encryption"`
-	Signing    []byte `json:"signing"`
+	Encryption     []byte `json:"encryption"`
+	Signing        []byte `json:"signing"`
+	EncryptionType string `json:"encryptionType,omitempty"`
+	SigningType    string `json:"signingType,omitempty"`
 }
 
 // GetToken
@@ -296,6 +324,21 @@ type GetAppointmentsByZipCodeParams struct {
 	To        time.Time `json:"to"`
 }
 
+// SubscribeAvailability
+
+type SubscribeAvailabilityParams struct {
+	Radius  int64  `json:"radius"`
+	ZipCode string `json:"zipCode"`
+}
+
+// A change of the available appointments around the subscribed zip code,
+// which is sent to subscribed clients as a notification. Subscribers only
+// learn that something changed, not which provider or appointment.
+type AvailabilityUpdate struct {
+	ZipCode   string    `json:"zipCode"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
 // GetProvidersAggregated
 
 type GetAppointmentsAggregatedParams struct {
@@ -376,6 +419,26 @@ type GetProviderAppointmentsParams struct {
 	UpdatedSince *time.Time `json:"updatedSince"`
 }
 
+// StreamProviderAppointments
+
+type StreamProviderAppointmentsSignedParams struct {
+	JSON      string                            `json:"data" coerce:"name:json"`
+	Data      *StreamProviderAppointmentsParams `json:"-" coerce:"name:data"`
+	Signature []byte                            `json:"signature"`
+	PublicKey []byte                            `json:"publicKey"`
+}
+
+type StreamProviderAppointmentsParams struct {
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// An update of an appointment as it is sent to subscribed providers
+type AppointmentUpdate struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
 // GetProviderAppointmentsByProperty
 
 type GetProviderAppointmentsByPropertySignedParams struct {
@@ -401,10 +464,34 @@ type PublishAppointmentsSignedParams struct {
 }
 
 type PublishAppointmentsParams struct {
-	Timestamp    time.Time            `json:"timestamp"`
+	Timestamp      time.Time `json:"timestamp"`
+	IdempotencyKey string    `json:"idempotencyKey,omitempty"`
+	// if set, no appointment is written unless all of them can be
+	Atomic bool `json:"atomic,omitempty"`
+	// if set, slots with bookings may be removed from appointments, the
+	// affected users receive a cancellation notice
+	Force        bool                 `json:"force,omitempty"`
 	Appointments []*SignedAppointment `json:"appointments"`
 }
 
+// statuses of published appointments
+const (
+	AppointmentCreated   = "created"
+	AppointmentUpdated   = "updated"
+	AppointmentUnchanged = "unchanged"
+	// not written as another appointment failed in atomic mode
+	AppointmentSkipped = "skipped"
+	AppointmentFailed  = "error"
+)
+
+type PublishAppointmentResult struct {
+	ID     []byte `json:"id"`
+	Status string `json:"status"`
+	// the code (from the error catalog) and reason of failed appointments
+	Error  string `json:"error,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
 type SignedAppointment struct {
 	UpdatedAt   time.Time    `json:"updatedAt"`
 	Bookings    []*Booking   `json:"bookings"`    // only for providers
@@ -505,6 +592,7 @@ type BookAppointmentParams struct {
 	EncryptedData   *crypto.ECDHEncryptedData `json:"encryptedData"`
 	SignedTokenData *SignedTokenData          `json:"signedTokenData"`
 	Timestamp       time.Time                 `json:"timestamp"`
+	IdempotencyKey  string                    `json:"idempotencyKey,omitempty"`
 }
 
 type Booking struct {
@@ -532,11 +620,42 @@ type CancelAppointmentSignedParams struct {
 
 type CancelAppointmentParams struct {
 	Timestamp       time.Time        `json:"timestamp"`
+	IdempotencyKey  string           `json:"idempotencyKey,omitempty"`
 	ProviderID      []byte           `json:"providerID"`
 	SignedTokenData *SignedTokenData `json:"signedTokenData"`
 	ID              []byte           `json:"id"`
 }
 
+// GetCancellationNotices
+
+type GetCancellationNoticesSignedParams struct {
+	JSON      string                        `json:"data" coerce:"name:json"`
+	Data      *GetCancellationNoticesParams `json:"-" coerce:"name:data"`
+	Signature []byte                        `json:"signature"`
+	PublicKey []byte                        `json:"publicKey"`
+}
+
+type GetCancellationNoticesParams struct {
+	Timestamp       time.Time        `json:"timestamp"`
+	SignedTokenData *SignedTokenData `json:"signedTokenData"`
+}
+
+// reasons for the cancellation of a booking by the system
+const (
+	// the provider removed the booked slot from the appointment
+	SlotRemovedReason = "slotRemoved"
+)
+
+// Tells the user that their booking has been cancelled
+type CancellationNotice struct {
+	ProviderID    []byte    `json:"providerID"`
+	AppointmentID []byte    `json:"appointmentID"`
+	SlotID        []byte    `json:"slotID"`
+	Timestamp     time.Time `json:"timestamp"`
+	CancelledAt   time.Time `json:"cancelledAt"`
+	Reason        string    `json:"reason"`
+}
+
 // CheckProviderData
 
 type CheckProviderDataSignedParams struct {
@@ -560,9 +679,10 @@ type StoreProviderDataSignedParams struct {
 }
 
 type StoreProviderDataParams struct {
-	Timestamp     time.Time                 `json:"timestamp"`
-	EncryptedData *crypto.ECDHEncryptedData `json:"encryptedData"`
-	Code          []byte                    `json:"code"`
+	Timestamp      time.Time                 `json:"timestamp"`
+	IdempotencyKey string                    `json:"idempotencyKey,omitempty"`
+	EncryptedData  *crypto.ECDHEncryptedData `json:"encryptedData"`
+	Code           []byte                    `json:"code"`
 }
 
 type RawProviderData struct {
@@ -608,14 +728,17 @@ type GetProvidersDataParams struct {
 // GetStats
 
 type GetStatsParams struct {
-	ID     string                 `json:"id"`
-	Type   string                 `json:"type"`
-	Filter map[string]interface{} `json:"filter"`
-	Metric string                 `json:"metric"`
-	Name   string                 `json:"name"`
-	From   *time.Time             `json:"from"` // optional
-	To     *time.Time             `json:"to"`   // optional
-	N      *int64                 `json:"n"`    // optional
+	ID        string                 `json:"id"`
+	Type      string                 `json:"type"`
+	Filter    map[string]interface{} `json:"filter"`
+	Metric    string                 `json:"metric"`
+	Name      string                 `json:"name"`
+	From      *time.Time             `json:"from"`      // optional
+	To        *time.Time             `json:"to"`        // optional
+	N         *int64                 `json:"n"`         // optional
+	GroupBy   string                 `json:"groupBy"`   // optional
+	Aggregate string                 `json:"aggregate"` // optional
+	TopN      *int64                 `json:"topN"`      // optional
 }
 
 type StatsValue struct {
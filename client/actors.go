@@ -0,0 +1,74 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"encoding/json"
+	"github.com/impfen/services-inoeg/crypto"
+)
+
+// An actor signs the parameters of authenticated endpoints
+type Actor struct {
+	Role string
+	Key  *crypto.Key
+	// the signed token data of a user, which is added to the parameters
+	Token *crypto.SignedStringData
+}
+
+func Root(key *crypto.Key) *Actor {
+	return &Actor{Role: "root", Key: key}
+}
+
+func Mediator(mediator *crypto.Actor) *Actor {
+	return &Actor{Role: "mediator", Key: mediator.SigningKey}
+}
+
+func Provider(provider *crypto.Actor) *Actor {
+	return &Actor{Role: "provider", Key: provider.SigningKey}
+}
+
+// Users sign with the key whose public key they submitted when requesting
+// their token, the token is returned by the getToken endpoint.
+func User(key *crypto.Key, token *crypto.SignedStringData) *Actor {
+	return &Actor{Role: "user", Key: key, Token: token}
+}
+
+// Signs the parameters and returns the signed parameters
+func (a *Actor) Sign(params map[string]interface{}) (map[string]interface{}, error) {
+
+	if a.Token != nil {
+		if _, ok := params["signedTokenData"]; !ok || params["signedTokenData"] == nil {
+			params["signedTokenData"] = a.Token
+		}
+	}
+
+	data, err := json.Marshal(params)
+
+	if err != nil {
+		return nil, err
+	}
+
+	signedData, err := a.Key.SignString(string(data))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return signedData.AsMap(), nil
+}
@@ -0,0 +1,579 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+// Code generated by go generate; DO NOT EDIT.
+
+package client
+
+import (
+	"github.com/impfen/services-inoeg"
+	"github.com/impfen/services-inoeg/crypto"
+	"net/http"
+)
+
+type AppointmentsClient struct {
+	*Client
+}
+
+func MakeAppointmentsClient(url string, transport Transport, client *http.Client) *AppointmentsClient {
+	return &AppointmentsClient{MakeClient(appointmentsEndpoints, url, transport, client)}
+}
+
+var appointmentsEndpoints = map[string]*Endpoint{
+	"getStats":                          {Path: "stats", Method: "GET", Signed: false},
+	"exportStats":                       {Path: "stats/export", Method: "GET", Signed: false, RESTOnly: true},
+	"getKeys":                           {Path: "keys", Method: "GET", Signed: false},
+	"getConfigurables":                  {Path: "configurables", Method: "GET", Signed: false},
+	"getAppointmentsAggregated":         {Path: "appointments/aggregated/<zipFrom>/<zipTo>/<date>", Method: "GET", Signed: false},
+	"getAppointmentsByZipCode":          {Path: "appointments/zipCode/<zipCode>/<radius>/<from>/<to>", Method: "GET", Signed: false},
+	"subscribeAvailability":             {Signed: false},
+	"getProvidersByZipCode":             {Path: "providers/zipCode/<zipFrom>/<zipTo>", Method: "GET", Signed: false},
+	"getAppointment":                    {Path: "provider/<providerID>/appointments/<id>", Method: "GET", Signed: false},
+	"getToken":                          {Path: "token", Method: "POST", Signed: false},
+	"addMediatorPublicKeys":             {Path: "mediators", Method: "POST", Signed: true},
+	"getEvents":                         {Path: "events", Method: "POST", Signed: true},
+	"addCodes":                          {Path: "codes", Method: "POST", Signed: true},
+	"uploadDistances":                   {Path: "distances", Method: "POST", Signed: true},
+	"resetDB":                           {Path: "db/reset", Method: "DELETE", Signed: true},
+	"isValidMediator":                   {Path: "mediator/isValid", Method: "POST", Signed: true},
+	"confirmProvider":                   {Path: "providers", Method: "POST", Signed: true},
+	"getProviders":                      {Path: "providers/all", Method: "POST", Signed: true},
+	"getProviderData":                   {Path: "providers/single", Method: "POST", Signed: true},
+	"getPendingProviderData":            {Path: "providers/pending", Method: "POST", Signed: true},
+	"getVerifiedProviderData":           {Path: "providers/verified", Method: "POST", Signed: true},
+	"isValidProvider":                   {Path: "provider/isValid", Method: "POST", Signed: true},
+	"isValidatedProvider":               {Path: "provider/isValidated", Method: "POST", Signed: true},
+	"getProviderAppointmentsByProperty": {Path: "appointments/property", Method: "POST", Signed: true},
+	"getProviderAppointments":           {Path: "appointments", Method: "POST", Signed: true},
+	"streamProviderAppointments":        {Path: "appointments/stream", Method: "GET", Signed: true, RESTOnly: true},
+	"publishAppointments":               {Path: "appointments/publish", Method: "POST", Signed: true},
+	"storeProviderData":                 {Path: "providers/data", Method: "POST", Signed: true},
+	"checkProviderData":                 {Path: "providers/data/check", Method: "POST", Signed: true},
+	"checkProviderStatus":               {Path: "provider/status", Method: "POST", Signed: true},
+	"bookAppointment":                   {Path: "appointments/book", Method: "POST", Signed: true},
+	"cancelAppointment":                 {Path: "appointments/cancel", Method: "DELETE", Signed: true},
+	"getCancellationNotices":            {Path: "appointments/cancellations", Method: "POST", Signed: true},
+	"isValidUser":                       {Path: "user/isValid", Method: "POST", Signed: true},
+}
+
+// GetStats calls the getStats endpoint. Returns various public statistics related to the system.
+func (c *AppointmentsClient) GetStats(params *services.GetStatsParams) ([]*services.StatsValue, error) {
+	var result []*services.StatsValue
+	err := c.Call("getStats", params, nil, &result)
+	return result, err
+}
+
+// ExportStats calls the exportStats endpoint. Returns the public statistics in CSV format.
+func (c *AppointmentsClient) ExportStats(params *services.GetStatsParams) (*services.RawResult, error) {
+	var result *services.RawResult
+	err := c.Call("exportStats", params, nil, &result)
+	return result, err
+}
+
+// GetKeys calls the getKeys endpoint. Returns various required public keys. Please note that you should have an independent verification mechanism for these keys and not blindly trust the ones provided by this API.
+func (c *AppointmentsClient) GetKeys(params *services.GetKeysParams) (*services.Keys, error) {
+	var result *services.Keys
+	err := c.Call("getKeys", params, nil, &result)
+	return result, err
+}
+
+// GetConfigurables calls the getConfigurables endpoint. returns configuration variables regarding filters
+func (c *AppointmentsClient) GetConfigurables(params *services.GetConfigurablesParams) (*services.ValidateSettings, error) {
+	var result *services.ValidateSettings
+	err := c.Call("getConfigurables", params, nil, &result)
+	return result, err
+}
+
+// GetAppointmentsAggregated calls the getAppointmentsAggregated endpoint. Returns available appointments for a given zip code area.
+func (c *AppointmentsClient) GetAppointmentsAggregated(params *services.GetAppointmentsAggregatedParams) ([]*services.AggregatedProviderAppointments, error) {
+	var result []*services.AggregatedProviderAppointments
+	err := c.Call("getAppointmentsAggregated", params, nil, &result)
+	return result, err
+}
+
+// GetAppointmentsByZipCode calls the getAppointmentsByZipCode endpoint. Returns available appointments for a given zip code area.
+func (c *AppointmentsClient) GetAppointmentsByZipCode(params *services.GetAppointmentsByZipCodeParams) ([]*services.ProviderAppointments, error) {
+	var result []*services.ProviderAppointments
+	err := c.Call("getAppointmentsByZipCode", params, nil, &result)
+	return result, err
+}
+
+// SubscribeAvailability calls the subscribeAvailability endpoint. Sends 'availabilityUpdate' notifications (at most once per minute) when new appointments are published in the given zip code area. Requires a WebSocket connection.
+func (c *AppointmentsClient) SubscribeAvailability(params *services.SubscribeAvailabilityParams) (string, error) {
+	var result string
+	err := c.Call("subscribeAvailability", params, nil, &result)
+	return result, err
+}
+
+// GetProvidersByZipCode calls the getProvidersByZipCode endpoint. Returns verified providers for a given zip code area.
+func (c *AppointmentsClient) GetProvidersByZipCode(params *services.GetProvidersByZipCodeParams) ([]*services.SignedProviderData, error) {
+	var result []*services.SignedProviderData
+	err := c.Call("getProvidersByZipCode", params, nil, &result)
+	return result, err
+}
+
+// GetAppointment calls the getAppointment endpoint. Returns details about a specific appointment.
+func (c *AppointmentsClient) GetAppointment(params *services.GetAppointmentParams) (*services.ProviderAppointments, error) {
+	var result *services.ProviderAppointments
+	err := c.Call("getAppointment", params, nil, &result)
+	return result, err
+}
+
+// GetToken calls the getToken endpoint. Returns a signed token that allows users to book appointments.
+func (c *AppointmentsClient) GetToken(params *services.GetTokenParams) (*crypto.SignedStringData, error) {
+	var result *crypto.SignedStringData
+	err := c.Call("getToken", params, nil, &result)
+	return result, err
+}
+
+// AddMediatorPublicKeys calls the addMediatorPublicKeys endpoint. Adds the public key data and associated information of a mediator to the system.
+func (c *AppointmentsClient) AddMediatorPublicKeys(params *services.AddMediatorPublicKeysParams, actor *Actor) (string, error) {
+	var result string
+	err := c.Call("addMediatorPublicKeys", params, actor, &result)
+	return result, err
+}
+
+// GetEvents calls the getEvents endpoint. Returns the domain events that occurred after the given cursor.
+func (c *AppointmentsClient) GetEvents(params *services.GetEventsParams, actor *Actor) (*services.EventsFeed, error) {
+	var result *services.EventsFeed
+	err := c.Call("getEvents", params, actor, &result)
+	return result, err
+}
+
+// AddCodes calls the addCodes endpoint. Adds signup codes to the system.
+func (c *AppointmentsClient) AddCodes(params *services.CodesData, actor *Actor) (string, error) {
+	var result string
+	err := c.Call("addCodes", params, actor, &result)
+	return result, err
+}
+
+// UploadDistances calls the uploadDistances endpoint. Uploads distance information to the system.
+func (c *AppointmentsClient) UploadDistances(params *services.UploadDistancesParams, actor *Actor) (string, error) {
+	var result string
+	err := c.Call("uploadDistances", params, actor, &result)
+	return result, err
+}
+
+// ResetDB calls the resetDB endpoint. Resets the database. This endpoint is only active for test deployments.
+func (c *AppointmentsClient) ResetDB(params *services.ResetDBParams, actor *Actor) (string, error) {
+	var result string
+	err := c.Call("resetDB", params, actor, &result)
+	return result, err
+}
+
+// IsValidMediator calls the isValidMediator endpoint. Validates the mediator signature
+func (c *AppointmentsClient) IsValidMediator(params *services.CheckProviderDataParams, actor *Actor) (bool, error) {
+	var result bool
+	err := c.Call("isValidMediator", params, actor, &result)
+	return result, err
+}
+
+// ConfirmProvider calls the confirmProvider endpoint. Confirms a provider by adding its public key data and associated information to the system.
+func (c *AppointmentsClient) ConfirmProvider(params *services.ConfirmProviderParams, actor *Actor) (string, error) {
+	var result string
+	err := c.Call("confirmProvider", params, actor, &result)
+	return result, err
+}
+
+// GetProviders calls the getProviders endpoint. Returns the provider data for all providers
+func (c *AppointmentsClient) GetProviders(params *services.GetProvidersDataParams, actor *Actor) ([]*services.RawProviderData, error) {
+	var result []*services.RawProviderData
+	err := c.Call("getProviders", params, actor, &result)
+	return result, err
+}
+
+// GetProviderData calls the getProviderData endpoint. Returns the provider data for the given provider id
+func (c *AppointmentsClient) GetProviderData(params *services.GetProviderDataParams, actor *Actor) (*services.GetProviderResult, error) {
+	var result *services.GetProviderResult
+	err := c.Call("getProviderData", params, actor, &result)
+	return result, err
+}
+
+// GetPendingProviderData calls the getPendingProviderData endpoint. Returns a list of provider data waiting for confirmation.
+func (c *AppointmentsClient) GetPendingProviderData(params *services.GetProvidersDataParams, actor *Actor) ([]*services.RawProviderData, error) {
+	var result []*services.RawProviderData
+	err := c.Call("getPendingProviderData", params, actor, &result)
+	return result, err
+}
+
+// GetVerifiedProviderData calls the getVerifiedProviderData endpoint. Returns a list of confirmed provider data.
+func (c *AppointmentsClient) GetVerifiedProviderData(params *services.GetProvidersDataParams, actor *Actor) ([]*services.RawProviderData, error) {
+	var result []*services.RawProviderData
+	err := c.Call("getVerifiedProviderData", params, actor, &result)
+	return result, err
+}
+
+// IsValidProvider calls the isValidProvider endpoint. Checks the verification status of provider data.
+func (c *AppointmentsClient) IsValidProvider(params *services.CheckProviderDataParams, actor *Actor) (bool, error) {
+	var result bool
+	err := c.Call("isValidProvider", params, actor, &result)
+	return result, err
+}
+
+// IsValidatedProvider calls the isValidatedProvider endpoint. Checks the verification status of provider data.
+func (c *AppointmentsClient) IsValidatedProvider(params *services.CheckProviderDataParams, actor *Actor) (bool, error) {
+	var result bool
+	err := c.Call("isValidatedProvider", params, actor, &result)
+	return result, err
+}
+
+// GetProviderAppointmentsByProperty calls the getProviderAppointmentsByProperty endpoint. Returns a list of appointments for the given provider.
+func (c *AppointmentsClient) GetProviderAppointmentsByProperty(params *services.GetProviderAppointmentsByPropertyParams, actor *Actor) (*services.ProviderAppointments, error) {
+	var result *services.ProviderAppointments
+	err := c.Call("getProviderAppointmentsByProperty", params, actor, &result)
+	return result, err
+}
+
+// GetProviderAppointments calls the getProviderAppointments endpoint. Returns a list of appointments for the given provider.
+func (c *AppointmentsClient) GetProviderAppointments(params *services.GetProviderAppointmentsParams, actor *Actor) (*services.ProviderAppointments, error) {
+	var result *services.ProviderAppointments
+	err := c.Call("getProviderAppointments", params, actor, &result)
+	return result, err
+}
+
+// PublishAppointments calls the publishAppointments endpoint. Publishes new or modified appointments to the system.
+func (c *AppointmentsClient) PublishAppointments(params *services.PublishAppointmentsParams, actor *Actor) (string, error) {
+	var result string
+	err := c.Call("publishAppointments", params, actor, &result)
+	return result, err
+}
+
+// StoreProviderData calls the storeProviderData endpoint. Stores provider data for verification.
+func (c *AppointmentsClient) StoreProviderData(params *services.StoreProviderDataParams, actor *Actor) (string, error) {
+	var result string
+	err := c.Call("storeProviderData", params, actor, &result)
+	return result, err
+}
+
+// CheckProviderData calls the checkProviderData endpoint. Checks the verification status of provider data.
+func (c *AppointmentsClient) CheckProviderData(params *services.CheckProviderDataParams, actor *Actor) (*services.ConfirmedProviderData, error) {
+	var result *services.ConfirmedProviderData
+	err := c.Call("checkProviderData", params, actor, &result)
+	return result, err
+}
+
+// CheckProviderStatus calls the checkProviderStatus endpoint. returns the current status of the provider
+func (c *AppointmentsClient) CheckProviderStatus(params *services.CheckProviderDataParams, actor *Actor) (string, error) {
+	var result string
+	err := c.Call("checkProviderStatus", params, actor, &result)
+	return result, err
+}
+
+// BookAppointment calls the bookAppointment endpoint. Books an appointment.
+func (c *AppointmentsClient) BookAppointment(params *services.BookAppointmentParams, actor *Actor) (*services.Booking, error) {
+	var result *services.Booking
+	err := c.Call("bookAppointment", params, actor, &result)
+	return result, err
+}
+
+// CancelAppointment calls the cancelAppointment endpoint. Cancels a booking.
+func (c *AppointmentsClient) CancelAppointment(params *services.CancelAppointmentParams, actor *Actor) (string, error) {
+	var result string
+	err := c.Call("cancelAppointment", params, actor, &result)
+	return result, err
+}
+
+// GetCancellationNotices calls the getCancellationNotices endpoint. Returns the bookings of the user that have been cancelled because the provider removed the booked slot.
+func (c *AppointmentsClient) GetCancellationNotices(params *services.GetCancellationNoticesParams, actor *Actor) ([]*services.CancellationNotice, error) {
+	var result []*services.CancellationNotice
+	err := c.Call("getCancellationNotices", params, actor, &result)
+	return result, err
+}
+
+// IsValidUser calls the isValidUser endpoint. Validates the user token signature
+func (c *AppointmentsClient) IsValidUser(params *services.ValidateUserParams, actor *Actor) (bool, error) {
+	var result bool
+	err := c.Call("isValidUser", params, actor, &result)
+	return result, err
+}
+
+type AppointmentsV2Client struct {
+	*Client
+}
+
+func MakeAppointmentsV2Client(url string, transport Transport, client *http.Client) *AppointmentsV2Client {
+	return &AppointmentsV2Client{MakeClient(appointmentsV2Endpoints, url, transport, client)}
+}
+
+var appointmentsV2Endpoints = map[string]*Endpoint{
+	"getStats.v2":                          {Path: "v2/stats", Method: "GET", Signed: false},
+	"exportStats.v2":                       {Path: "v2/stats/export", Method: "GET", Signed: false, RESTOnly: true},
+	"getKeys.v2":                           {Path: "v2/keys", Method: "GET", Signed: false},
+	"getConfigurables.v2":                  {Path: "v2/configurables", Method: "GET", Signed: false},
+	"getAppointmentsAggregated.v2":         {Path: "v2/appointments/aggregated/<zipFrom>/<zipTo>/<date>", Method: "GET", Signed: false},
+	"getAppointmentsByZipCode.v2":          {Path: "v2/appointments/zipCode/<zipCode>/<radius>/<from>/<to>", Method: "GET", Signed: false},
+	"subscribeAvailability.v2":             {Signed: false},
+	"getProvidersByZipCode.v2":             {Path: "v2/providers/zipCode/<zipFrom>/<zipTo>", Method: "GET", Signed: false},
+	"getAppointment.v2":                    {Path: "v2/provider/<providerID>/appointments/<id>", Method: "GET", Signed: false},
+	"getToken.v2":                          {Path: "v2/token", Method: "POST", Signed: false},
+	"addMediatorPublicKeys.v2":             {Path: "v2/mediators", Method: "POST", Signed: true},
+	"getEvents.v2":                         {Path: "v2/events", Method: "POST", Signed: true},
+	"addCodes.v2":                          {Path: "v2/codes", Method: "POST", Signed: true},
+	"uploadDistances.v2":                   {Path: "v2/distances", Method: "POST", Signed: true},
+	"resetDB.v2":                           {Path: "v2/db/reset", Method: "DELETE", Signed: true},
+	"isValidMediator.v2":                   {Path: "v2/mediator/isValid", Method: "POST", Signed: true},
+	"confirmProvider.v2":                   {Path: "v2/providers", Method: "POST", Signed: true},
+	"getProviders.v2":                      {Path: "v2/providers/all", Method: "POST", Signed: true},
+	"getProviderData.v2":                   {Path: "v2/providers/single", Method: "POST", Signed: true},
+	"getPendingProviderData.v2":            {Path: "v2/providers/pending", Method: "POST", Signed: true},
+	"getVerifiedProviderData.v2":           {Path: "v2/providers/verified", Method: "POST", Signed: true},
+	"isValidProvider.v2":                   {Path: "v2/provider/isValid", Method: "POST", Signed: true},
+	"isValidatedProvider.v2":               {Path: "v2/provider/isValidated", Method: "POST", Signed: true},
+	"getProviderAppointmentsByProperty.v2": {Path: "v2/appointments/property", Method: "POST", Signed: true},
+	"getProviderAppointments.v2":           {Path: "v2/appointments", Method: "POST", Signed: true},
+	"streamProviderAppointments.v2":        {Path: "v2/appointments/stream", Method: "GET", Signed: true, RESTOnly: true},
+	"publishAppointments.v2":               {Path: "v2/appointments/publish", Method: "POST", Signed: true},
+	"storeProviderData.v2":                 {Path: "v2/providers/data", Method: "POST", Signed: true},
+	"checkProviderData.v2":                 {Path: "v2/providers/data/check", Method: "POST", Signed: true},
+	"checkProviderStatus.v2":               {Path: "v2/provider/status", Method: "POST", Signed: true},
+	"bookAppointment.v2":                   {Path: "v2/appointments/book", Method: "POST", Signed: true},
+	"cancelAppointment.v2":                 {Path: "v2/appointments/cancel", Method: "DELETE", Signed: true},
+	"getCancellationNotices.v2":            {Path: "v2/appointments/cancellations", Method: "POST", Signed: true},
+	"isValidUser.v2":                       {Path: "v2/user/isValid", Method: "POST", Signed: true},
+}
+
+// GetStats calls the getStats.v2 endpoint. Returns various public statistics related to the system.
+func (c *AppointmentsV2Client) GetStats(params *services.GetStatsParams) ([]*services.StatsValue, error) {
+	var result []*services.StatsValue
+	err := c.Call("getStats.v2", params, nil, &result)
+	return result, err
+}
+
+// ExportStats calls the exportStats.v2 endpoint. Returns the public statistics in CSV format.
+func (c *AppointmentsV2Client) ExportStats(params *services.GetStatsParams) (*services.RawResult, error) {
+	var result *services.RawResult
+	err := c.Call("exportStats.v2", params, nil, &result)
+	return result, err
+}
+
+// GetKeys calls the getKeys.v2 endpoint. Returns various required public keys. Please note that you should have an independent verification mechanism for these keys and not blindly trust the ones provided by this API.
+func (c *AppointmentsV2Client) GetKeys(params *services.GetKeysParams) (*services.Keys, error) {
+	var result *services.Keys
+	err := c.Call("getKeys.v2", params, nil, &result)
+	return result, err
+}
+
+// GetConfigurables calls the getConfigurables.v2 endpoint. returns configuration variables regarding filters
+func (c *AppointmentsV2Client) GetConfigurables(params *services.GetConfigurablesParams) (*services.ValidateSettings, error) {
+	var result *services.ValidateSettings
+	err := c.Call("getConfigurables.v2", params, nil, &result)
+	return result, err
+}
+
+// GetAppointmentsAggregated calls the getAppointmentsAggregated.v2 endpoint. Returns available appointments for a given zip code area.
+func (c *AppointmentsV2Client) GetAppointmentsAggregated(params *services.GetAppointmentsAggregatedParams) ([]*services.AggregatedProviderAppointments, error) {
+	var result []*services.AggregatedProviderAppointments
+	err := c.Call("getAppointmentsAggregated.v2", params, nil, &result)
+	return result, err
+}
+
+// GetAppointmentsByZipCode calls the getAppointmentsByZipCode.v2 endpoint. Returns available appointments for a given zip code area.
+func (c *AppointmentsV2Client) GetAppointmentsByZipCode(params *services.GetAppointmentsByZipCodeParams) ([]*services.ProviderAppointments, error) {
+	var result []*services.ProviderAppointments
+	err := c.Call("getAppointmentsByZipCode.v2", params, nil, &result)
+	return result, err
+}
+
+// SubscribeAvailability calls the subscribeAvailability.v2 endpoint. Sends 'availabilityUpdate' notifications (at most once per minute) when new appointments are published in the given zip code area. Requires a WebSocket connection.
+func (c *AppointmentsV2Client) SubscribeAvailability(params *services.SubscribeAvailabilityParams) (string, error) {
+	var result string
+	err := c.Call("subscribeAvailability.v2", params, nil, &result)
+	return result, err
+}
+
+// GetProvidersByZipCode calls the getProvidersByZipCode.v2 endpoint. Returns verified providers for a given zip code area.
+func (c *AppointmentsV2Client) GetProvidersByZipCode(params *services.GetProvidersByZipCodeParams) ([]*services.SignedProviderData, error) {
+	var result []*services.SignedProviderData
+	err := c.Call("getProvidersByZipCode.v2", params, nil, &result)
+	return result, err
+}
+
+// GetAppointment calls the getAppointment.v2 endpoint. Returns details about a specific appointment.
+func (c *AppointmentsV2Client) GetAppointment(params *services.GetAppointmentParams) (*services.ProviderAppointments, error) {
+	var result *services.ProviderAppointments
+	err := c.Call("getAppointment.v2", params, nil, &result)
+	return result, err
+}
+
+// GetToken calls the getToken.v2 endpoint. Returns a signed token that allows users to book appointments.
+func (c *AppointmentsV2Client) GetToken(params *services.GetTokenParams) (*crypto.SignedStringData, error) {
+	var result *crypto.SignedStringData
+	err := c.Call("getToken.v2", params, nil, &result)
+	return result, err
+}
+
+// AddMediatorPublicKeys calls the addMediatorPublicKeys.v2 endpoint. Adds the public key data and associated information of a mediator to the system.
+func (c *AppointmentsV2Client) AddMediatorPublicKeys(params *services.AddMediatorPublicKeysParams, actor *Actor) (string, error) {
+	var result string
+	err := c.Call("addMediatorPublicKeys.v2", params, actor, &result)
+	return result, err
+}
+
+// GetEvents calls the getEvents.v2 endpoint. Returns the domain events that occurred after the given cursor.
+func (c *AppointmentsV2Client) GetEvents(params *services.GetEventsParams, actor *Actor) (*services.EventsFeed, error) {
+	var result *services.EventsFeed
+	err := c.Call("getEvents.v2", params, actor, &result)
+	return result, err
+}
+
+// AddCodes calls the addCodes.v2 endpoint. Adds signup codes to the system.
+func (c *AppointmentsV2Client) AddCodes(params *services.CodesData, actor *Actor) (string, error) {
+	var result string
+	err := c.Call("addCodes.v2", params, actor, &result)
+	return result, err
+}
+
+// UploadDistances calls the uploadDistances.v2 endpoint. Uploads distance information to the system.
+func (c *AppointmentsV2Client) UploadDistances(params *services.UploadDistancesParams, actor *Actor) (string, error) {
+	var result string
+	err := c.Call("uploadDistances.v2", params, actor, &result)
+	return result, err
+}
+
+// ResetDB calls the resetDB.v2 endpoint. Resets the database. This endpoint is only active for test deployments.
+func (c *AppointmentsV2Client) ResetDB(params *services.ResetDBParams, actor *Actor) (string, error) {
+	var result string
+	err := c.Call("resetDB.v2", params, actor, &result)
+	return result, err
+}
+
+// IsValidMediator calls the isValidMediator.v2 endpoint. Validates the mediator signature
+func (c *AppointmentsV2Client) IsValidMediator(params *services.CheckProviderDataParams, actor *Actor) (bool, error) {
+	var result bool
+	err := c.Call("isValidMediator.v2", params, actor, &result)
+	return result, err
+}
+
+// ConfirmProvider calls the confirmProvider.v2 endpoint. Confirms a provider by adding its public key data and associated information to the system.
+func (c *AppointmentsV2Client) ConfirmProvider(params *services.ConfirmProviderParams, actor *Actor) (string, error) {
+	var result string
+	err := c.Call("confirmProvider.v2", params, actor, &result)
+	return result, err
+}
+
+// GetProviders calls the getProviders.v2 endpoint. Returns the provider data for all providers
+func (c *AppointmentsV2Client) GetProviders(params *services.GetProvidersDataParams, actor *Actor) ([]*services.RawProviderData, error) {
+	var result []*services.RawProviderData
+	err := c.Call("getProviders.v2", params, actor, &result)
+	return result, err
+}
+
+// GetProviderData calls the getProviderData.v2 endpoint. Returns the provider data for the given provider id
+func (c *AppointmentsV2Client) GetProviderData(params *services.GetProviderDataParams, actor *Actor) (*services.GetProviderResult, error) {
+	var result *services.GetProviderResult
+	err := c.Call("getProviderData.v2", params, actor, &result)
+	return result, err
+}
+
+// GetPendingProviderData calls the getPendingProviderData.v2 endpoint. Returns a list of provider data waiting for confirmation.
+func (c *AppointmentsV2Client) GetPendingProviderData(params *services.GetProvidersDataParams, actor *Actor) ([]*services.RawProviderData, error) {
+	var result []*services.RawProviderData
+	err := c.Call("getPendingProviderData.v2", params, actor, &result)
+	return result, err
+}
+
+// GetVerifiedProviderData calls the getVerifiedProviderData.v2 endpoint. Returns a list of confirmed provider data.
+func (c *AppointmentsV2Client) GetVerifiedProviderData(params *services.GetProvidersDataParams, actor *Actor) ([]*services.RawProviderData, error) {
+	var result []*services.RawProviderData
+	err := c.Call("getVerifiedProviderData.v2", params, actor, &result)
+	return result, err
+}
+
+// IsValidProvider calls the isValidProvider.v2 endpoint. Checks the verification status of provider data.
+func (c *AppointmentsV2Client) IsValidProvider(params *services.CheckProviderDataParams, actor *Actor) (bool, error) {
+	var result bool
+	err := c.Call("isValidProvider.v2", params, actor, &result)
+	return result, err
+}
+
+// IsValidatedProvider calls the isValidatedProvider.v2 endpoint. Checks the verification status of provider data.
+func (c *AppointmentsV2Client) IsValidatedProvider(params *services.CheckProviderDataParams, actor *Actor) (bool, error) {
+	var result bool
+	err := c.Call("isValidatedProvider.v2", params, actor, &result)
+	return result, err
+}
+
+// GetProviderAppointmentsByProperty calls the getProviderAppointmentsByProperty.v2 endpoint. Returns a list of appointments for the given provider.
+func (c *AppointmentsV2Client) GetProviderAppointmentsByProperty(params *services.GetProviderAppointmentsByPropertyParams, actor *Actor) (*services.ProviderAppointments, error) {
+	var result *services.ProviderAppointments
+	err := c.Call("getProviderAppointmentsByProperty.v2", params, actor, &result)
+	return result, err
+}
+
+// GetProviderAppointments calls the getProviderAppointments.v2 endpoint. Returns a list of appointments for the given provider.
+func (c *AppointmentsV2Client) GetProviderAppointments(params *services.GetProviderAppointmentsParams, actor *Actor) (*services.ProviderAppointments, error) {
+	var result *services.ProviderAppointments
+	err := c.Call("getProviderAppointments.v2", params, actor, &result)
+	return result, err
+}
+
+// PublishAppointments calls the publishAppointments.v2 endpoint. Publishes new or modified appointments to the system and returns the status of every appointment. Unlike version 1, appointments must be signed by the publishing provider, duplicate IDs are rejected and a failing appointment does not stop the others.
+func (c *AppointmentsV2Client) PublishAppointments(params *services.PublishAppointmentsParams, actor *Actor) ([]*services.PublishAppointmentResult, error) {
+	var result []*services.PublishAppointmentResult
+	err := c.Call("publishAppointments.v2", params, actor, &result)
+	return result, err
+}
+
+// StoreProviderData calls the storeProviderData.v2 endpoint. Stores provider data for verification.
+func (c *AppointmentsV2Client) StoreProviderData(params *services.StoreProviderDataParams, actor *Actor) (string, error) {
+	var result string
+	err := c.Call("storeProviderData.v2", params, actor, &result)
+	return result, err
+}
+
+// CheckProviderData calls the checkProviderData.v2 endpoint. Checks the verification status of provider data.
+func (c *AppointmentsV2Client) CheckProviderData(params *services.CheckProviderDataParams, actor *Actor) (*services.ConfirmedProviderData, error) {
+	var result *services.ConfirmedProviderData
+	err := c.Call("checkProviderData.v2", params, actor, &result)
+	return result, err
+}
+
+// CheckProviderStatus calls the checkProviderStatus.v2 endpoint. returns the current status of the provider
+func (c *AppointmentsV2Client) CheckProviderStatus(params *services.CheckProviderDataParams, actor *Actor) (string, error) {
+	var result string
+	err := c.Call("checkProviderStatus.v2", params, actor, &result)
+	return result, err
+}
+
+// BookAppointment calls the bookAppointment.v2 endpoint. Books an appointment.
+func (c *AppointmentsV2Client) BookAppointment(params *services.BookAppointmentParams, actor *Actor) (*services.Booking, error) {
+	var result *services.Booking
+	err := c.Call("bookAppointment.v2", params, actor, &result)
+	return result, err
+}
+
+// CancelAppointment calls the cancelAppointment.v2 endpoint. Cancels a booking.
+func (c *AppointmentsV2Client) CancelAppointment(params *services.CancelAppointmentParams, actor *Actor) (string, error) {
+	var result string
+	err := c.Call("cancelAppointment.v2", params, actor, &result)
+	return result, err
+}
+
+// GetCancellationNotices calls the getCancellationNotices.v2 endpoint. Returns the bookings of the user that have been cancelled because the provider removed the booked slot.
+func (c *AppointmentsV2Client) GetCancellationNotices(params *services.GetCancellationNoticesParams, actor *Actor) ([]*services.CancellationNotice, error) {
+	var result []*services.CancellationNotice
+	err := c.Call("getCancellationNotices.v2", params, actor, &result)
+	return result, err
+}
+
+// IsValidUser calls the isValidUser.v2 endpoint. Validates the user token signature
+func (c *AppointmentsV2Client) IsValidUser(params *services.ValidateUserParams, actor *Actor) (bool, error) {
+	var result bool
+	err := c.Call("isValidUser.v2", params, actor, &result)
+	return result, err
+}
@@ -0,0 +1,346 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package client provides typed clients for the appointments and storage APIs.
+// The endpoint methods are generated from the API definitions of the servers.
+package client
+
+//go:generate go run ./generate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/impfen/services-inoeg"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"sync/atomic"
+)
+
+type Transport string
+
+const (
+	JSONRPC = Transport("jsonrpc")
+	REST    = Transport("rest")
+)
+
+// Describes how an endpoint is called
+type Endpoint struct {
+	// the REST binding of the endpoint, if it has one
+	Path   string
+	Method string
+	// whether the parameters have to be signed by an actor
+	Signed bool
+	// whether the endpoint is only available via REST (e.g. file exports)
+	RESTOnly bool
+}
+
+// An error returned by the API. For JSON-RPC the code is the JSON-RPC error
+// code, for REST the HTTP status code.
+type Error struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("API error %d: %s", e.Code, e.Message)
+}
+
+// Returns the code of the error from the error catalog, if it has one
+func (e *Error) ErrorCode() string {
+	if data, ok := e.Data.(map[string]interface{}); ok {
+		if code, ok := data["code"].(string); ok {
+			return code
+		}
+	}
+	return ""
+}
+
+// Returns whether the error is the given error from the catalog
+func (e *Error) Is(err error) bool {
+	if apiErr, ok := err.(*services.APIError); ok {
+		return e.ErrorCode() == apiErr.Code
+	}
+	return false
+}
+
+type Client struct {
+	url       string
+	transport Transport
+	client    *http.Client
+	endpoints map[string]*Endpoint
+	id        int64
+}
+
+func MakeClient(endpoints map[string]*Endpoint, url string, transport Transport, client *http.Client) *Client {
+	if client == nil {
+		client = &http.Client{}
+	}
+	return &Client{
+		url:       url,
+		transport: transport,
+		client:    client,
+		endpoints: endpoints,
+	}
+}
+
+// Calls the endpoint with the given parameters, which are signed by the actor
+// if it is given. The result is decoded into the given value if it isn't nil.
+func (c *Client) Call(name string, params interface{}, actor *Actor, result interface{}) error {
+
+	endpoint, ok := c.endpoints[name]
+
+	if !ok {
+		return fmt.Errorf("unknown endpoint '%s'", name)
+	}
+
+	if endpoint.RESTOnly && c.transport != REST {
+		return fmt.Errorf("endpoint '%s' is only available via REST", name)
+	}
+
+	if endpoint.Signed && actor == nil {
+		return fmt.Errorf("endpoint '%s' requires a signing actor", name)
+	}
+
+	values, err := toMap(params)
+
+	if err != nil {
+		return err
+	}
+
+	if actor != nil {
+		if values, err = actor.Sign(values); err != nil {
+			return err
+		}
+	}
+
+	var data json.RawMessage
+	var contentType string
+
+	switch c.transport {
+	case JSONRPC:
+		data, err = c.callJSONRPC(name, values)
+	case REST:
+		data, contentType, err = c.callREST(name, endpoint, values)
+	default:
+		err = fmt.Errorf("unknown transport '%s'", c.transport)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if result == nil || len(data) == 0 {
+		return nil
+	}
+
+	// REST returns raw results as-is
+	if c.transport == REST {
+		switch raw := result.(type) {
+		case *services.RawResult:
+			raw.ContentType = contentType
+			raw.Data = data
+			return nil
+		case **services.RawResult:
+			*raw = &services.RawResult{ContentType: contentType, Data: data}
+			return nil
+		}
+	}
+
+	return json.Unmarshal(data, result)
+}
+
+type jsonRPCResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *Error          `json:"error"`
+}
+
+func (c *Client) callJSONRPC(name string, params map[string]interface{}) (json.RawMessage, error) {
+
+	request := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  name,
+		"params":  params,
+		"id":      strconv.FormatInt(atomic.AddInt64(&c.id, 1), 10),
+	}
+
+	body, err := json.Marshal(request)
+
+	if err != nil {
+		return nil, err
+	}
+
+	statusCode, _, responseBody, err := c.do("POST", c.url, body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	response := &jsonRPCResponse{}
+
+	if err := json.Unmarshal(responseBody, response); err != nil {
+		return nil, fmt.Errorf("invalid response (status %d): %w", statusCode, err)
+	}
+
+	if response.Error != nil {
+		return nil, response.Error
+	}
+
+	return response.Result, nil
+}
+
+var pathParamRegexp = regexp.MustCompile(`<([a-zA-Z0-9_]+)>`)
+
+func (c *Client) callREST(name string, endpoint *Endpoint, params map[string]interface{}) (json.RawMessage, string, error) {
+
+	if endpoint.Method == "" {
+		return nil, "", fmt.Errorf("endpoint '%s' cannot be called via REST", name)
+	}
+
+	var missing string
+
+	path := pathParamRegexp.ReplaceAllStringFunc(endpoint.Path, func(param string) string {
+		key := param[1 : len(param)-1]
+		value, ok := params[key]
+		if !ok {
+			missing = key
+			return ""
+		}
+		delete(params, key)
+		return url.PathEscape(queryValue(value))
+	})
+
+	if missing != "" {
+		return nil, "", fmt.Errorf("parameter '%s' missing", missing)
+	}
+
+	requestURL := c.url + "/" + path
+
+	var body []byte
+
+	if endpoint.Method == "GET" {
+		query := url.Values{}
+		for key, value := range params {
+			query.Set(key, queryValue(value))
+		}
+		if len(query) > 0 {
+			requestURL += "?" + query.Encode()
+		}
+	} else {
+		var err error
+		if body, err = json.Marshal(params); err != nil {
+			return nil, "", err
+		}
+	}
+
+	statusCode, contentType, responseBody, err := c.do(endpoint.Method, requestURL, body)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	if statusCode >= 400 {
+		apiError := &Error{}
+		if err := json.Unmarshal(responseBody, apiError); err != nil {
+			apiError.Message = http.StatusText(statusCode)
+		}
+		apiError.Code = statusCode
+		return nil, "", apiError
+	}
+
+	return responseBody, contentType, nil
+}
+
+func (c *Client) do(method, url string, body []byte) (int, string, []byte, error) {
+
+	var reader io.Reader
+
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	request, err := http.NewRequest(method, url, reader)
+
+	if err != nil {
+		return 0, "", nil, err
+	}
+
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	response, err := c.client.Do(request)
+
+	if err != nil {
+		return 0, "", nil, err
+	}
+
+	defer response.Body.Close()
+
+	responseBody, err := io.ReadAll(response.Body)
+
+	if err != nil {
+		return 0, "", nil, err
+	}
+
+	return response.StatusCode, response.Header.Get("Content-Type"), responseBody, nil
+}
+
+// Converts the parameters to a map with the same JSON representation
+func toMap(params interface{}) (map[string]interface{}, error) {
+
+	values := map[string]interface{}{}
+
+	if params == nil {
+		return values, nil
+	}
+
+	data, err := json.Marshal(params)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, err
+	}
+
+	// nil pointers are encoded as null
+	if values == nil {
+		values = map[string]interface{}{}
+	}
+
+	return values, nil
+}
+
+func queryValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	data, _ := json.Marshal(value)
+	return string(data)
+}
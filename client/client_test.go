@@ -0,0 +1,140 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"encoding/json"
+	"github.com/impfen/services-inoeg"
+	"github.com/impfen/services-inoeg/crypto"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSignedJSONRPCCall(t *testing.T) {
+
+	key, err := crypto.GenerateWebKey("user", "ecdsa")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token := &crypto.SignedStringData{Data: "{}", Signature: []byte("token")}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		request := struct {
+			Method string `json:"method"`
+			Params struct {
+				Data      string `json:"data"`
+				Signature []byte `json:"signature"`
+				PublicKey []byte `json:"publicKey"`
+			} `json:"params"`
+		}{}
+
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Fatal(err)
+		}
+
+		if request.Method != "getEvents" {
+			t.Errorf("unexpected method %s", request.Method)
+		}
+
+		if ok, err := crypto.VerifyWithBytes([]byte(request.Params.Data), request.Params.Signature, request.Params.PublicKey); err != nil || !ok {
+			t.Errorf("invalid signature")
+		}
+
+		data := map[string]interface{}{}
+
+		if err := json.Unmarshal([]byte(request.Params.Data), &data); err != nil {
+			t.Fatal(err)
+		}
+
+		if data["cursor"] != float64(4) || data["signedTokenData"] == nil {
+			t.Errorf("unexpected data: %v", data)
+		}
+
+		w.Write([]byte(`{"jsonrpc": "2.0", "id": "1", "result": {"cursor": 5, "events": [{"id": 5, "type": "appointmentBooked"}]}}`))
+	}))
+
+	defer server.Close()
+
+	client := MakeAppointmentsClient(server.URL, JSONRPC, nil)
+
+	if _, err := client.GetEvents(&services.GetEventsParams{Cursor: 4}, nil); err == nil {
+		t.Fatalf("expected an error without an actor")
+	}
+
+	feed, err := client.GetEvents(&services.GetEventsParams{
+		Timestamp: time.Now(),
+		Cursor:    4,
+	}, User(key, token))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if feed.Cursor != 5 || len(feed.Events) != 1 || feed.Events[0].ID != 5 {
+		t.Fatalf("unexpected feed: %v", feed)
+	}
+}
+
+func TestRESTCall(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/provider/AQI=/appointments/AwQ=":
+			if r.Method != "GET" {
+				t.Errorf("unexpected method %s", r.Method)
+			}
+			w.Write([]byte(`{"provider": {"id": "AQI="}, "appointments": []}`))
+		default:
+			w.WriteHeader(404)
+			w.Write([]byte(`{"message": "not found"}`))
+		}
+	}))
+
+	defer server.Close()
+
+	client := MakeAppointmentsClient(server.URL, REST, nil)
+
+	appointments, err := client.GetAppointment(&services.GetAppointmentParams{
+		ProviderID: []byte{1, 2},
+		ID:         []byte{3, 4},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if appointments.Provider == nil || len(appointments.Provider.ID) != 2 {
+		t.Fatalf("unexpected result: %v", appointments)
+	}
+
+	if _, err := client.GetKeys(nil); err == nil {
+		t.Fatalf("expected an error")
+	} else if apiErr, ok := err.(*Error); !ok || apiErr.Code != 404 || apiErr.Message != "not found" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := client.SubscribeAvailability(nil); err == nil {
+		t.Fatalf("expected an error for an endpoint without REST binding")
+	}
+}
@@ -0,0 +1,244 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+// Generates the typed endpoint methods of the clients from the API
+// definitions of the servers. Run it via "go generate ./client".
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/impfen/services-inoeg"
+	"github.com/impfen/services-inoeg/api"
+	"github.com/impfen/services-inoeg/servers"
+	"go/format"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const header = `// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.`
+
+var streamResultType = reflect.TypeOf(&services.StreamResult{})
+
+type generator struct {
+	imports map[string]bool
+	buffer  bytes.Buffer
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buffer, format, args...)
+}
+
+// Returns the name of the type as used in the client package
+func (g *generator) typeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return "*" + g.typeName(t.Elem())
+	case reflect.Slice:
+		return "[]" + g.typeName(t.Elem())
+	case reflect.Map:
+		return fmt.Sprintf("map[%s]%s", g.typeName(t.Key()), g.typeName(t.Elem()))
+	}
+	if t.PkgPath() != "" {
+		g.imports[t.PkgPath()] = true
+		// the string representation uses the package name
+		return t.String()
+	}
+	if t.Name() == "" {
+		return "interface{}"
+	}
+	return t.Name()
+}
+
+// Returns the type of the parameters the client passes to the endpoint and
+// whether they need to be signed
+func paramsType(endpoint *api.Endpoint) (reflect.Type, bool) {
+
+	handlerType := reflect.TypeOf(endpoint.Handler)
+	// handlers have the signature func(context, params) response
+	params := handlerType.In(1)
+
+	if params.Kind() != reflect.Ptr || params.Elem().Kind() != reflect.Struct {
+		return params, false
+	}
+
+	if _, ok := params.Elem().FieldByName("Signature"); !ok {
+		return params, false
+	}
+
+	// the signed data is decoded into the data field
+	if data, ok := params.Elem().FieldByName("Data"); ok && data.Tag.Get("json") == "-" {
+		return data.Type, true
+	}
+
+	return reflect.TypeOf(map[string]interface{}{}), true
+}
+
+func (g *generator) endpoint(clientType, name string, endpoint *api.Endpoint) {
+
+	resultType := reflect.TypeOf((*interface{})(nil)).Elem()
+
+	if endpoint.ReturnType != nil && endpoint.ReturnType.Type != nil {
+		resultType = reflect.TypeOf(endpoint.ReturnType.Type)
+	}
+
+	// streams require a long-lived connection, which the client doesn't support
+	if resultType == streamResultType {
+		return
+	}
+
+	params, signed := paramsType(endpoint)
+	methodName := strings.ToUpper(endpoint.Name[:1]) + endpoint.Name[1:]
+	resultName := g.typeName(resultType)
+
+	g.printf("\n// %s calls the %s endpoint. %s\n", methodName, name, endpoint.Description)
+
+	if endpoint.Deprecated != nil {
+		g.printf("//\n// Deprecated: %s\n", strings.TrimSpace(endpoint.Deprecated.Message+" Use a later version of the API."))
+	}
+
+	if signed {
+		g.printf("func (c *%s) %s(params %s, actor *Actor) (%s, error) {\n", clientType, methodName, g.typeName(params), resultName)
+	} else {
+		g.printf("func (c *%s) %s(params %s) (%s, error) {\n", clientType, methodName, g.typeName(params), resultName)
+	}
+
+	g.printf("\tvar result %s\n", resultName)
+
+	if signed {
+		g.printf("\terr := c.Call(%q, params, actor, &result)\n", name)
+	} else {
+		g.printf("\terr := c.Call(%q, params, nil, &result)\n", name)
+	}
+
+	g.printf("\treturn result, err\n}\n")
+}
+
+// Generates the client for a version of the API. The client of the default
+// version uses the unversioned method names and paths.
+func (g *generator) version(definition *api.API, version int) error {
+
+	endpoints, err := definition.VersionEndpoints(version)
+
+	if err != nil {
+		return err
+	}
+
+	prefix := strings.ToUpper(definition.Name[:1]) + definition.Name[1:]
+	endpointsName := definition.Name + "Endpoints"
+
+	if version != definition.Version {
+		prefix += fmt.Sprintf("V%d", version)
+		endpointsName = fmt.Sprintf("%sV%dEndpoints", definition.Name, version)
+	}
+
+	clientType := prefix + "Client"
+
+	g.printf("\ntype %s struct {\n\t*Client\n}\n", clientType)
+	g.printf("\nfunc Make%s(url string, transport Transport, client *http.Client) *%s {\n", clientType, clientType)
+	g.printf("\treturn &%s{MakeClient(%s, url, transport, client)}\n}\n", clientType, endpointsName)
+
+	g.printf("\nvar %s = map[string]*Endpoint{\n", endpointsName)
+
+	names := map[*api.Endpoint]string{}
+
+	for _, endpoint := range endpoints {
+		_, signed := paramsType(endpoint)
+		name := endpoint.Name
+		if version != definition.Version {
+			name = api.VersionedName(endpoint.Name, version)
+		}
+		names[endpoint] = name
+		if endpoint.REST != nil {
+			path := endpoint.REST.Path
+			if version != definition.Version {
+				path = api.VersionedPath(path, version)
+			}
+			if endpoint.RESTOnly() {
+				g.printf("\t%q: {Path: %q, Method: %q, Signed: %t, RESTOnly: true},\n", name, path, endpoint.REST.Method, signed)
+			} else {
+				g.printf("\t%q: {Path: %q, Method: %q, Signed: %t},\n", name, path, endpoint.REST.Method, signed)
+			}
+		} else {
+			g.printf("\t%q: {Signed: %t},\n", name, signed)
+		}
+	}
+
+	g.printf("}\n")
+
+	for _, endpoint := range endpoints {
+		g.endpoint(clientType, names[endpoint], endpoint)
+	}
+
+	return nil
+}
+
+func generate(definition *api.API) ([]byte, error) {
+
+	g := &generator{imports: map[string]bool{"net/http": true}}
+
+	for _, version := range definition.Versions() {
+		if err := g.version(definition, version); err != nil {
+			return nil, err
+		}
+	}
+
+	imports := make([]string, 0, len(g.imports))
+
+	for imp := range g.imports {
+		imports = append(imports, fmt.Sprintf("\t%q\n", imp))
+	}
+
+	sort.Strings(imports)
+
+	source := fmt.Sprintf("%s\n\n// Code generated by go generate; DO NOT EDIT.\n\npackage client\n\nimport (\n%s)\n%s", header, strings.Join(imports, ""), g.buffer.String())
+
+	if formatted, err := format.Source([]byte(source)); err != nil {
+		return nil, fmt.Errorf("%w\n%s", err, source)
+	} else {
+		return formatted, nil
+	}
+}
+
+func main() {
+	for _, definition := range []*api.API{servers.AppointmentsAPI(), servers.StorageAPI()} {
+		if source, err := generate(definition); err != nil {
+			services.Log.Fatal(err)
+		} else if err := ioutil.WriteFile(definition.Name+".go", source, 0644); err != nil {
+			services.Log.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+// Code generated by go generate; DO NOT EDIT.
+
+package client
+
+import (
+	"github.com/impfen/services-inoeg"
+	"net/http"
+)
+
+type StorageClient struct {
+	*Client
+}
+
+func MakeStorageClient(url string, transport Transport, client *http.Client) *StorageClient {
+	return &StorageClient{MakeClient(storageEndpoints, url, transport, client)}
+}
+
+var storageEndpoints = map[string]*Endpoint{
+	"storeSettings":  {Path: "store", Method: "PUT", Signed: false},
+	"getSettings":    {Path: "store/<id>", Method: "GET", Signed: false},
+	"deleteSettings": {Path: "store", Method: "DELETE", Signed: false},
+	"resetDB":        {Path: "db/reset", Method: "DELETE", Signed: true},
+}
+
+// StoreSettings calls the storeSettings endpoint. Stores encrypted settings.
+func (c *StorageClient) StoreSettings(params *services.StoreSettingsParams) (string, error) {
+	var result string
+	err := c.Call("storeSettings", params, nil, &result)
+	return result, err
+}
+
+// GetSettings calls the getSettings endpoint. Retrieves encrypted settings.
+func (c *StorageClient) GetSettings(params *services.GetSettingsParams) (interface{}, error) {
+	var result interface{}
+	err := c.Call("getSettings", params, nil, &result)
+	return result, err
+}
+
+// DeleteSettings calls the deleteSettings endpoint. Deletes encrypted settings.
+func (c *StorageClient) DeleteSettings(params *services.GetSettingsParams) (string, error) {
+	var result string
+	err := c.Call("deleteSettings", params, nil, &result)
+	return result, err
+}
+
+// ResetDB calls the resetDB endpoint. Resets the database. Only enabled for test deployments.
+func (c *StorageClient) ResetDB(params *services.ResetDBParams, actor *Actor) (string, error) {
+	var result string
+	err := c.Call("resetDB", params, actor, &result)
+	return result, err
+}
@@ -295,17 +295,13 @@ func setupKeys(settings *services.Settings) func(c *cli.Context) error {
 		// encrypt admin settings if flag is set
 		if c.Bool("encrypt") {
 
-			key, err := crypto.BuildKeyFromEnv()
+			// further recipients can be added with 'admin settings rekey'
+			recipient, err := crypto.PassphraseRecipientFromEnv("admin")
 			if err != nil {
 				services.Log.Fatal(err)
 			}
 
-			encAdminSettings, err := crypto.Encrypt(adminJson, key)
-			if err != nil {
-				services.Log.Fatal(err)
-			}
-
-			adminJson, err = json.MarshalIndent(encAdminSettings, "", " ")
+			adminJson, err = crypto.SealStream(adminJson, []crypto.Recipient{recipient})
 			if err != nil {
 				services.Log.Fatal(err)
 			}
@@ -820,6 +816,7 @@ func Admin(settings *services.Settings) ([]cli.Command, error) {
 						},
 					},
 				},
+				settingsCommands(settings),
 				{
 					Name:  "distances",
 					Flags: []cli.Flag{},
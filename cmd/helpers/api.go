@@ -0,0 +1,114 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package helpers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/impfen/services-inoeg"
+	"github.com/impfen/services-inoeg/api"
+	"github.com/impfen/services-inoeg/servers"
+	"github.com/urfave/cli"
+	"io/ioutil"
+)
+
+func serverAPI(name string) (*api.API, error) {
+	switch name {
+	case "appointments":
+		return servers.AppointmentsAPI(), nil
+	case "storage":
+		return servers.StorageAPI(), nil
+	}
+	return nil, fmt.Errorf("unknown server '%s' (should be 'appointments' or 'storage')", name)
+}
+
+func exportOpenAPI(settings *services.Settings) func(c *cli.Context) error {
+	return func(c *cli.Context) error {
+
+		apiDefinition, err := serverAPI(c.String("server"))
+
+		if err != nil {
+			services.Log.Fatal(err)
+		}
+
+		version := c.Int("version")
+
+		if version == 0 {
+			version = apiDefinition.Version
+		}
+
+		doc, err := apiDefinition.OpenAPI(version)
+
+		if err != nil {
+			services.Log.Fatal(err)
+		}
+
+		jsonData, err := json.MarshalIndent(doc, "", "  ")
+
+		if err != nil {
+			services.Log.Fatal(err)
+		}
+
+		if output := c.String("output"); output != "" {
+			if err := ioutil.WriteFile(output, jsonData, 0644); err != nil {
+				services.Log.Fatal(err)
+			}
+			return nil
+		}
+
+		fmt.Println(string(jsonData))
+
+		return nil
+	}
+}
+
+func API(settings *services.Settings) ([]cli.Command, error) {
+
+	return []cli.Command{
+		{
+			Name:  "api",
+			Flags: []cli.Flag{},
+			Usage: "API-related commands.",
+			Subcommands: []cli.Command{
+				{
+					Name: "openapi",
+					Flags: []cli.Flag{
+						&cli.StringFlag{
+							Name:  "server",
+							Value: "appointments",
+							Usage: "server for which to export the API (appointments or storage)",
+						},
+						&cli.IntFlag{
+							Name:  "version",
+							Value: 0,
+							Usage: "version of the API to export (default: the default version)",
+						},
+						&cli.StringFlag{
+							Name:  "output",
+							Value: "",
+							Usage: "file to write the document to (default: standard output)",
+						},
+					},
+					Usage:  "Export the OpenAPI 3 document of a server.",
+					Action: exportOpenAPI(settings),
+				},
+			},
+		},
+	}, nil
+}
@@ -82,6 +82,14 @@ func initializeMetrics(settings *services.Settings) (Server, error) {
 	return helpers.InitializeMetricsServer(settings)
 }
 
+func initializeSigner(settings *services.Settings) (Server, error) {
+	services.Log.Debug("Starting signing daemon...")
+	if settings.Signer == nil {
+		return nil, fmt.Errorf("Signer settings undefined")
+	}
+	return helpers.InitializeSignerServer(settings)
+}
+
 type Initializer func(settings *services.Settings) (Server, error)
 
 func startServer(settings *services.Settings, initializer Initializer) Server {
@@ -143,6 +151,12 @@ func Run(settings *services.Settings) ([]cli.Command, error) {
 					Usage:  "Run the appointments server.",
 					Action: run(settings, []Initializer{initializeMetrics, initializeAppointments}),
 				},
+				{
+					Name:   "signer",
+					Flags:  []cli.Flag{},
+					Usage:  "Run the signing daemon.",
+					Action: run(settings, []Initializer{initializeSigner}),
+				},
 			},
 		},
 	}, nil
@@ -0,0 +1,362 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package helpers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/impfen/services-inoeg"
+	"github.com/impfen/services-inoeg/crypto"
+	"github.com/impfen/services-inoeg/encryptFs"
+	"github.com/impfen/services-inoeg/helpers"
+	"github.com/urfave/cli"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// environment variable for a passphrase that should be added to a file
+const envNewPassName = "KIEBITZ_NEW_PASSPHRASE"
+
+// resolves a file name relative to the settings directories
+func settingsFilePath(c *cli.Context) string {
+
+	name := c.Args().Get(0)
+
+	if name == "" {
+		services.Log.Fatal("please specify a filename")
+	}
+
+	if _, err := os.Stat(name); err == nil {
+		return name
+	}
+
+	settingsPaths, err := helpers.RealSettingsPaths()
+
+	if err != nil {
+		services.Log.Fatal(err)
+	}
+
+	for _, settingsPath := range settingsPaths {
+		path := filepath.Join(settingsPath, name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+
+	services.Log.Fatalf("settings file '%s' not found", name)
+	return ""
+}
+
+func identitiesFromEnv() []crypto.Identity {
+	identities, err := crypto.IdentitiesFromEnv()
+	if err != nil {
+		services.Log.Fatal(err)
+	}
+	return identities
+}
+
+func readSettingsFile(path string, identities []crypto.Identity) ([]byte, []byte, bool, os.FileMode) {
+
+	stat, err := os.Stat(path)
+
+	if err != nil {
+		services.Log.Fatal(err)
+	}
+
+	rawData, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		services.Log.Fatal(err)
+	}
+
+	data, encrypted, err := encryptFs.Decrypt(rawData, identities)
+
+	if err != nil {
+		services.Log.Fatalf("cannot read '%s': %v", path, err)
+	}
+
+	return rawData, data, encrypted, stat.Mode()
+}
+
+// We first write the data to a temporary file and check that we can read the
+// expected content back with our own identities. Only then we replace the
+// original file, so that we never lock ourselves out.
+func writeSettingsFile(path string, rawData, expected []byte, mode os.FileMode, identities []crypto.Identity) {
+
+	tmpPath := path + ".tmp"
+
+	if err := ioutil.WriteFile(tmpPath, rawData, mode); err != nil {
+		services.Log.Fatal(err)
+	}
+
+	if writtenData, err := ioutil.ReadFile(tmpPath); err != nil {
+		os.Remove(tmpPath)
+		services.Log.Fatal(err)
+	} else if data, _, err := encryptFs.Decrypt(writtenData, identities); err != nil {
+		os.Remove(tmpPath)
+		services.Log.Fatalf("cannot read back '%s', refusing to overwrite it: %v", path, err)
+	} else if !bytes.Equal(data, expected) {
+		os.Remove(tmpPath)
+		services.Log.Fatalf("round-trip check failed for '%s', refusing to overwrite it", path)
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		services.Log.Fatal(err)
+	}
+}
+
+// reads ECDH or X25519 public keys from files, the key name is used as recipient ID
+func keyRecipients(filenames []string) []crypto.Recipient {
+	recipients := make([]crypto.Recipient, 0, len(filenames))
+	for _, filename := range filenames {
+		var key *crypto.Key
+		if data, err := ioutil.ReadFile(filename); err != nil {
+			services.Log.Fatal(err)
+		} else if err := json.Unmarshal(data, &key); err != nil {
+			services.Log.Fatal(err)
+		} else if key == nil || (key.Type != "ecdh" && key.Type != "x25519") {
+			services.Log.Fatalf("'%s' does not contain an ECDH or X25519 key", filename)
+		}
+		recipients = append(recipients, &crypto.PublicKeyRecipient{
+			ID:  key.Name,
+			Key: key,
+		})
+	}
+	return recipients
+}
+
+func sealStream(data []byte, recipients []crypto.Recipient) []byte {
+	if streamData, err := crypto.SealStream(data, recipients); err != nil {
+		services.Log.Fatal(err)
+		return nil
+	} else {
+		return streamData
+	}
+}
+
+func streamRecipients(streamData []byte) crypto.WrappedKeys {
+	if header, err := crypto.ReadStreamHeader(bytes.NewReader(streamData)); err != nil {
+		services.Log.Fatal(err)
+		return nil
+	} else {
+		return header.Recipients
+	}
+}
+
+func encryptSettings(settings *services.Settings) func(c *cli.Context) error {
+	return func(c *cli.Context) error {
+
+		path := settingsFilePath(c)
+		identities := identitiesFromEnv()
+
+		_, data, encrypted, mode := readSettingsFile(path, identities)
+
+		if encrypted {
+			services.Log.Fatalf("'%s' is already encrypted, use 'rekey' to change its recipients", path)
+		}
+
+		recipients := keyRecipients(c.StringSlice("key"))
+
+		if recipient, err := crypto.PassphraseRecipientFromEnv(c.String("id")); err == nil {
+			recipients = append(recipients, recipient)
+		}
+
+		writeSettingsFile(path, sealStream(data, recipients), data, mode, identities)
+
+		services.Log.Infof("Encrypted '%s' for %d recipient(s).", path, len(recipients))
+
+		return nil
+	}
+}
+
+func decryptSettings(settings *services.Settings) func(c *cli.Context) error {
+	return func(c *cli.Context) error {
+
+		path := settingsFilePath(c)
+		identities := identitiesFromEnv()
+
+		_, data, encrypted, mode := readSettingsFile(path, identities)
+
+		if !encrypted {
+			services.Log.Fatalf("'%s' is not encrypted", path)
+		}
+
+		writeSettingsFile(path, data, data, mode, identities)
+
+		services.Log.Infof("Decrypted '%s'.", path)
+
+		return nil
+	}
+}
+
+func rekeySettings(settings *services.Settings) func(c *cli.Context) error {
+	return func(c *cli.Context) error {
+
+		path := settingsFilePath(c)
+		identities := identitiesFromEnv()
+
+		rawData, data, encrypted, mode := readSettingsFile(path, identities)
+
+		if !encrypted {
+			services.Log.Fatalf("'%s' is not encrypted, use 'encrypt' first", path)
+		}
+
+		// we convert envelopes and files in the legacy format to streams
+		if !crypto.IsStream(rawData) {
+			services.Log.Infof("Converting '%s' to the stream format...", path)
+			if envelope := crypto.ParseEnvelope(rawData); envelope != nil {
+				recipients, dropped, err := envelope.Recipients.Recipients(identities)
+				if err != nil {
+					services.Log.Fatal(err)
+				}
+				for _, id := range dropped {
+					services.Log.Warningf("Dropped recipient '%s' as we do not know their passphrase.", id)
+				}
+				rawData = sealStream(data, recipients)
+			} else if recipient, err := crypto.PassphraseRecipientFromEnv(c.String("id")); err != nil {
+				services.Log.Fatal(err)
+			} else {
+				rawData = sealStream(data, []crypto.Recipient{recipient})
+			}
+		}
+
+		wrappedKeys := streamRecipients(rawData)
+		recipients := keyRecipients(c.StringSlice("add-key"))
+
+		if id := c.String("add-passphrase"); id != "" {
+			passphrase := os.Getenv(envNewPassName)
+			if passphrase == "" {
+				services.Log.Fatalf("please specify the new passphrase via %s", envNewPassName)
+			}
+			recipients = append(recipients, &crypto.PassphraseRecipient{
+				ID:         id,
+				Passphrase: []byte(passphrase),
+			})
+			// required to re-wrap the data key for the new passphrase when rotating
+			identities = append(identities, &crypto.PassphraseIdentity{Passphrase: []byte(passphrase)})
+		}
+
+		if len(recipients) > 0 {
+			if dataKey, err := wrappedKeys.DataKey(identities); err != nil {
+				services.Log.Fatal(err)
+			} else if wrappedKeys, err = wrappedKeys.Add(dataKey, recipients); err != nil {
+				services.Log.Fatal(err)
+			}
+		}
+
+		for _, id := range c.StringSlice("remove") {
+			var err error
+			if wrappedKeys, err = wrappedKeys.Remove(id); err != nil {
+				services.Log.Fatal(err)
+			}
+		}
+
+		if c.Bool("rotate") {
+			recipients, dropped, err := wrappedKeys.Recipients(identities)
+			if err != nil {
+				services.Log.Fatal(err)
+			}
+			for _, id := range dropped {
+				services.Log.Warningf("Dropped recipient '%s' as we do not know their passphrase.", id)
+			}
+			rawData = sealStream(data, recipients)
+		} else {
+			// only the header changes, the encrypted chunks stay the same
+			var err error
+			if rawData, err = crypto.ReplaceStreamRecipients(rawData, wrappedKeys); err != nil {
+				services.Log.Fatal(err)
+			}
+		}
+
+		writeSettingsFile(path, rawData, data, mode, identities)
+
+		wrappedKeys = streamRecipients(rawData)
+		ids := make([]string, len(wrappedKeys))
+		for i, wrappedKey := range wrappedKeys {
+			ids[i] = wrappedKey.ID
+		}
+
+		services.Log.Infof("Re-keyed '%s', recipients: %v", path, ids)
+
+		return nil
+	}
+}
+
+func settingsCommands(settings *services.Settings) cli.Command {
+	return cli.Command{
+		Name:  "settings",
+		Flags: []cli.Flag{},
+		Usage: "Encrypt, decrypt and re-key settings files (uses KIEBITZ_PASSPHRASE and/or KIEBITZ_IDENTITY).",
+		Subcommands: []cli.Command{
+			{
+				Name: "encrypt",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "id",
+						Value: "admin",
+						Usage: "recipient ID for the passphrase",
+					},
+					&cli.StringSliceFlag{
+						Name:  "key",
+						Usage: "file with a public ECDH or X25519 key to encrypt for (can be repeated)",
+					},
+				},
+				Usage:  "encrypt a settings file",
+				Action: encryptSettings(settings),
+			},
+			{
+				Name:   "decrypt",
+				Flags:  []cli.Flag{},
+				Usage:  "decrypt a settings file",
+				Action: decryptSettings(settings),
+			},
+			{
+				Name: "rekey",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "id",
+						Value: "admin",
+						Usage: "recipient ID for the passphrase when converting legacy files",
+					},
+					&cli.StringSliceFlag{
+						Name:  "add-key",
+						Usage: "file with a public ECDH or X25519 key to add as recipient (can be repeated)",
+					},
+					&cli.StringFlag{
+						Name:  "add-passphrase",
+						Usage: fmt.Sprintf("recipient ID for a new passphrase (read from %s)", envNewPassName),
+					},
+					&cli.StringSliceFlag{
+						Name:  "remove",
+						Usage: "recipient ID to remove (can be repeated)",
+					},
+					&cli.BoolFlag{
+						Name:  "rotate",
+						Usage: "re-encrypt the file with a new data key",
+					},
+				},
+				Usage:  "add or remove recipients of a settings file or rotate its data key",
+				Action: rekeySettings(settings),
+			},
+		},
+	}
+}
@@ -32,12 +32,18 @@ func Settings(definitions *services.Definitions) (*services.Settings, error) {
 		return nil, err
 	} else {
 
-		key, err := crypto.BuildKeyFromEnv()
+		patterns := helpers.PlaintextSettingsPatterns()
+
+		identities, err := crypto.IdentitiesFromEnv()
 		if err != nil {
+			// without identities we cannot decrypt anything anyway
 			services.Log.Warning(err)
+			if len(patterns) == 0 {
+				patterns = []string{"*"}
+			}
 		}
 
-		encFs := encryptFs.New(fs, key)
+		encFs := encryptFs.New(fs, identities, encryptFs.AllowPlaintext(patterns))
 		return helpers.Settings(settingsPaths, encFs, definitions)
 	}
 }
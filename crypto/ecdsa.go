@@ -36,6 +36,20 @@ func GenerateKey() (*ecdsa.PrivateKey, error) {
 }
 
 func GenerateWebKey(name, keyType string) (*Key, error) {
+	switch keyType {
+	case "ed25519":
+		if key, err := GenerateEd25519Key(); err != nil {
+			return nil, err
+		} else {
+			return AsEd25519SettingsKey(key, name)
+		}
+	case "x25519":
+		if key, err := GenerateX25519Key(); err != nil {
+			return nil, err
+		} else {
+			return AsX25519SettingsKey(key, name)
+		}
+	}
 	if key, err := GenerateKey(); err != nil {
 		return nil, err
 	} else {
@@ -155,14 +169,6 @@ func (e *ECDSASignature) Serialize() []byte {
 	return append(pad(e.R.Bytes(), 32), pad(e.S.Bytes(), 32)...)
 }
 
-func VerifyWithBytes(message, signature, publicKeyData []byte) (bool, error) {
-	if publicKey, err := LoadPublicKey(publicKeyData); err != nil {
-		return false, err
-	} else {
-		return Verify(message, signature, publicKey)
-	}
-}
-
 func Verify(message []byte, signatureBytes []byte, publicKey *ecdsa.PublicKey) (bool, error) {
 	sig := &ECDSASignature{
 		R: &big.Int{},
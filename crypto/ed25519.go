@@ -0,0 +1,91 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package crypto
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"fmt"
+)
+
+func GenerateEd25519Key() (ed25519.PrivateKey, error) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	return privateKey, err
+}
+
+func AsEd25519SettingsKey(key ed25519.PrivateKey, name string) (*Key, error) {
+	marshalledPublicKey, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return nil, err
+	}
+	marshalledPrivateKey, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Key{
+		Type:       "ed25519",
+		PublicKey:  marshalledPublicKey,
+		PrivateKey: marshalledPrivateKey,
+		Purposes:   []string{"sign", "verify"},
+		Params: map[string]interface{}{
+			"curve": "ed25519",
+		},
+		Name:   name,
+		Format: "spki-pkcs8",
+	}, nil
+}
+
+func LoadEd25519PublicKey(publicKey []byte) (ed25519.PublicKey, error) {
+	pub, err := x509.ParsePKIXPublicKey(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse public key")
+	}
+	switch pub := pub.(type) {
+	case ed25519.PublicKey:
+		return pub, nil
+	}
+	return nil, fmt.Errorf("invalid public key type")
+}
+
+func LoadEd25519PrivateKey(privateKey []byte) (ed25519.PrivateKey, error) {
+	priv, err := x509.ParsePKCS8PrivateKey(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse private key")
+	}
+	switch priv := priv.(type) {
+	case ed25519.PrivateKey:
+		return priv, nil
+	}
+	return nil, fmt.Errorf("invalid private key type")
+}
+
+// Ed25519 signs the message itself (no pre-hashing), which is compatible
+// with the Ed25519 algorithm of the subtle crypto API
+func SignEd25519(message []byte, privateKey ed25519.PrivateKey) []byte {
+	return ed25519.Sign(privateKey, message)
+}
+
+func VerifyEd25519(message, signature []byte, publicKey ed25519.PublicKey) (bool, error) {
+	if len(signature) != ed25519.SignatureSize {
+		return false, fmt.Errorf("expected %d bytes for signature, but got %d", ed25519.SignatureSize, len(signature))
+	}
+	return ed25519.Verify(publicKey, message, signature), nil
+}
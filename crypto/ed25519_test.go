@@ -0,0 +1,109 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package crypto
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEd25519SignAndVerify(t *testing.T) {
+
+	key, err := GenerateWebKey("signing", "ed25519")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := []byte(`{"zipCode":"10707"}`)
+
+	if signedData, err := key.Sign(data); err != nil {
+		t.Fatal(err)
+	} else if ok, err := VerifyWithBytes(data, signedData.Signature, key.PublicKey); err != nil {
+		t.Fatal(err)
+	} else if !ok {
+		t.Fatalf("Expected a valid signature")
+	} else if ok, _ := VerifyWithBytes([]byte(`{"zipCode":"10708"}`), signedData.Signature, key.PublicKey); ok {
+		t.Fatalf("Expected an invalid signature")
+	}
+
+	// P-256 keys must keep working through the same code path
+	ecdsaKey, err := GenerateWebKey("signing", "ecdsa")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if signedData, err := ecdsaKey.Sign(data); err != nil {
+		t.Fatal(err)
+	} else if ok, err := ecdsaKey.Verify(signedData); err != nil {
+		t.Fatal(err)
+	} else if !ok {
+		t.Fatalf("Expected a valid signature")
+	}
+
+}
+
+func TestX25519DeriveKey(t *testing.T) {
+
+	a, err := GenerateWebKey("encryption", "x25519")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := GenerateWebKey("encryption", "x25519")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadX25519PublicKey(a.PublicKey); err != nil {
+		t.Fatal(err)
+	}
+
+	abKey, err := a.DeriveKey(b)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	baKey, err := b.DeriveKey(a)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(abKey, baKey) {
+		t.Fatalf("Expected derived keys to match")
+	}
+
+	encryptedData, err := a.Encrypt([]byte("test"), b)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if data, err := Decrypt(&EncryptedData{IV: encryptedData.IV, Data: encryptedData.Data}, baKey); err != nil {
+		t.Fatal(err)
+	} else if string(data) != "test" {
+		t.Fatalf("Expected decrypted data to match")
+	}
+
+}
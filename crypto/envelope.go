@@ -0,0 +1,383 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package crypto
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"golang.org/x/crypto/scrypt"
+	"io/ioutil"
+	"os"
+)
+
+/*
+An envelope encrypts data with a random per-file data key, which is then
+wrapped for each recipient individually. Recipients are either passphrases
+(stretched via scrypt) or ECDH / X25519 public keys. Adding or removing a
+recipient only touches the list of wrapped keys, the data itself does not
+need to be re-encrypted.
+*/
+
+const EnvelopeVersion = 1
+const envIdentityName = "KIEBITZ_IDENTITY"
+
+// scrypt parameters for new passphrase recipients (stored with each wrapped
+// key, so we can increase them later without breaking existing files)
+const scryptN = 1 << 15
+const scryptR = 8
+const scryptP = 1
+
+// upper bounds for the scrypt parameters of files we open, so that a crafted
+// file cannot make us use excessive amounts of memory (128 * N * r bytes) or
+// CPU time
+const scryptMaxMemory = 256 * 1024 * 1024
+const scryptMaxP = 4
+
+type Envelope struct {
+	Version    int         `json:"version"`
+	Recipients WrappedKeys `json:"recipients"`
+	IV         []byte      `json:"iv"`
+	Data       []byte      `json:"data"`
+}
+
+type WrappedKey struct {
+	// an arbitrary, human-readable name of the recipient (e.g. "alice")
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	// scrypt parameters (only for passphrase recipients)
+	Salt []byte `json:"salt,omitempty"`
+	N    int    `json:"n,omitempty"`
+	R    int    `json:"r,omitempty"`
+	P    int    `json:"p,omitempty"`
+	// public key of the recipient and ephemeral key (only for public key recipients)
+	KeyType      string `json:"keyType,omitempty"`
+	PublicKey    []byte `json:"publicKey,omitempty"`
+	EphemeralKey []byte `json:"ephemeralKey,omitempty"`
+	IV           []byte `json:"iv"`
+	Data         []byte `json:"data"`
+}
+
+// A recipient wraps the data key of an envelope
+type Recipient interface {
+	Wrap(dataKey []byte) (*WrappedKey, error)
+}
+
+// An identity unwraps the data key of an envelope
+type Identity interface {
+	Unwrap(wrappedKey *WrappedKey) ([]byte, error)
+}
+
+type PassphraseRecipient struct {
+	ID         string
+	Passphrase []byte
+}
+
+func (p *PassphraseRecipient) Wrap(dataKey []byte) (*WrappedKey, error) {
+	salt, err := RandomBytes(16)
+	if err != nil {
+		return nil, err
+	}
+	wrappedKey := &WrappedKey{
+		ID:   p.ID,
+		Type: "passphrase",
+		Salt: salt,
+		N:    scryptN,
+		R:    scryptR,
+		P:    scryptP,
+	}
+	if key, err := scrypt.Key(p.Passphrase, salt, scryptN, scryptR, scryptP, 32); err != nil {
+		return nil, err
+	} else if encryptedKey, err := Encrypt(dataKey, key); err != nil {
+		return nil, err
+	} else {
+		wrappedKey.IV = encryptedKey.IV
+		wrappedKey.Data = encryptedKey.Data
+		return wrappedKey, nil
+	}
+}
+
+type PassphraseIdentity struct {
+	Passphrase []byte
+}
+
+func (p *PassphraseIdentity) Unwrap(wrappedKey *WrappedKey) ([]byte, error) {
+	if wrappedKey.Type != "passphrase" {
+		return nil, nil
+	}
+	if wrappedKey.N <= 0 || wrappedKey.R <= 0 || wrappedKey.P <= 0 || wrappedKey.P > scryptMaxP ||
+		int64(wrappedKey.N) > scryptMaxMemory/128/int64(wrappedKey.R) {
+		return nil, fmt.Errorf("scrypt parameters of recipient '%s' exceed the limits", wrappedKey.ID)
+	}
+	if key, err := scrypt.Key(p.Passphrase, wrappedKey.Salt, wrappedKey.N, wrappedKey.R, wrappedKey.P, 32); err != nil {
+		return nil, err
+	} else if dataKey, err := Decrypt(&EncryptedData{IV: wrappedKey.IV, Data: wrappedKey.Data}, key); err != nil {
+		// wrong passphrase for this recipient
+		return nil, nil
+	} else {
+		return dataKey, nil
+	}
+}
+
+// opens files in the legacy format, which were encrypted directly with a
+// PBKDF2-derived key
+func (p *PassphraseIdentity) DecryptLegacy(data *EncryptedData) ([]byte, error) {
+	return Decrypt(data, LegacyKey(p.Passphrase))
+}
+
+// the key needs to be an ECDH or X25519 key, only the public key is required
+type PublicKeyRecipient struct {
+	ID  string
+	Key *Key
+}
+
+func (p *PublicKeyRecipient) Wrap(dataKey []byte) (*WrappedKey, error) {
+	if ephemeralKey, err := GenerateWebKey("ephemeral", p.Key.Type); err != nil {
+		return nil, err
+	} else if encryptedKey, err := ephemeralKey.Encrypt(dataKey, p.Key); err != nil {
+		return nil, err
+	} else {
+		return &WrappedKey{
+			ID:           p.ID,
+			Type:         "publicKey",
+			KeyType:      p.Key.Type,
+			PublicKey:    p.Key.PublicKey,
+			EphemeralKey: encryptedKey.PublicKey,
+			IV:           encryptedKey.IV,
+			Data:         encryptedKey.Data,
+		}, nil
+	}
+}
+
+type PrivateKeyIdentity struct {
+	Key *Key
+}
+
+func (p *PrivateKeyIdentity) Unwrap(wrappedKey *WrappedKey) ([]byte, error) {
+	if wrappedKey.Type != "publicKey" || !bytes.Equal(wrappedKey.PublicKey, p.Key.PublicKey) {
+		return nil, nil
+	}
+	return p.Key.Decrypt(&ECDHEncryptedData{
+		IV:        wrappedKey.IV,
+		Data:      wrappedKey.Data,
+		PublicKey: wrappedKey.EphemeralKey,
+	})
+}
+
+// the data keys of an envelope or stream, wrapped for each recipient
+type WrappedKeys []*WrappedKey
+
+// Returns the data key unwrapped by the first matching identity. Recipients
+// that cannot be unwrapped (e.g. due to invalid parameters) are skipped.
+func (w WrappedKeys) DataKey(identities []Identity) ([]byte, error) {
+	var lastErr error
+	for _, wrappedKey := range w {
+		for _, identity := range identities {
+			if dataKey, err := identity.Unwrap(wrappedKey); err != nil {
+				lastErr = err
+			} else if dataKey != nil {
+				return dataKey, nil
+			}
+		}
+	}
+	if lastErr != nil {
+		return nil, fmt.Errorf("no matching identity for envelope: %w", lastErr)
+	}
+	return nil, fmt.Errorf("no matching identity for envelope")
+}
+
+func (w WrappedKeys) Add(dataKey []byte, recipients []Recipient) (WrappedKeys, error) {
+	for _, recipient := range recipients {
+		if wrappedKey, err := recipient.Wrap(dataKey); err != nil {
+			return nil, err
+		} else {
+			w = append(w, wrappedKey)
+		}
+	}
+	return w, nil
+}
+
+// Removes all wrapped keys with the given ID. Note that a removed recipient
+// might have kept a copy of the data key, so the data should be re-encrypted
+// (i.e. sealed anew) if it must no longer be readable by them.
+func (w WrappedKeys) Remove(id string) (WrappedKeys, error) {
+	wrappedKeys := make(WrappedKeys, 0, len(w))
+	for _, wrappedKey := range w {
+		if wrappedKey.ID != id {
+			wrappedKeys = append(wrappedKeys, wrappedKey)
+		}
+	}
+	if len(wrappedKeys) == len(w) {
+		return nil, fmt.Errorf("unknown recipient: '%s'", id)
+	}
+	if len(wrappedKeys) == 0 {
+		return nil, fmt.Errorf("cannot remove the last recipient")
+	}
+	return wrappedKeys, nil
+}
+
+// Returns recipients for all public key recipients and for the passphrase
+// recipients that can be opened with the given identities, so that we can
+// wrap a new data key for them. Also returns the IDs of the recipients that
+// cannot be re-wrapped (as we do not know their passphrase).
+func (w WrappedKeys) Recipients(identities []Identity) ([]Recipient, []string, error) {
+	recipients := make([]Recipient, 0, len(w))
+	dropped := make([]string, 0)
+wrappedKeys:
+	for _, wrappedKey := range w {
+		switch wrappedKey.Type {
+		case "publicKey":
+			recipients = append(recipients, &PublicKeyRecipient{
+				ID:  wrappedKey.ID,
+				Key: &Key{Type: wrappedKey.KeyType, PublicKey: wrappedKey.PublicKey},
+			})
+			continue wrappedKeys
+		case "passphrase":
+			for _, identity := range identities {
+				if passphraseIdentity, ok := identity.(*PassphraseIdentity); ok {
+					if dataKey, err := passphraseIdentity.Unwrap(wrappedKey); err != nil {
+						return nil, nil, err
+					} else if dataKey != nil {
+						recipients = append(recipients, &PassphraseRecipient{
+							ID:         wrappedKey.ID,
+							Passphrase: passphraseIdentity.Passphrase,
+						})
+						continue wrappedKeys
+					}
+				}
+			}
+		}
+		dropped = append(dropped, wrappedKey.ID)
+	}
+	return recipients, dropped, nil
+}
+
+func Seal(data []byte, recipients []Recipient) (*Envelope, error) {
+	if len(recipients) == 0 {
+		return nil, fmt.Errorf("at least one recipient is required")
+	}
+	dataKey, err := RandomBytes(32)
+	if err != nil {
+		return nil, err
+	}
+	encryptedData, err := Encrypt(data, dataKey)
+	if err != nil {
+		return nil, err
+	}
+	wrappedKeys, err := WrappedKeys{}.Add(dataKey, recipients)
+	if err != nil {
+		return nil, err
+	}
+	return &Envelope{
+		Version:    EnvelopeVersion,
+		Recipients: wrappedKeys,
+		IV:         encryptedData.IV,
+		Data:       encryptedData.Data,
+	}, nil
+}
+
+func (e *Envelope) Open(identities []Identity) ([]byte, error) {
+	if e.Version != EnvelopeVersion {
+		return nil, fmt.Errorf("unsupported envelope version: %d", e.Version)
+	}
+	if dataKey, err := e.Recipients.DataKey(identities); err != nil {
+		return nil, err
+	} else {
+		return Decrypt(&EncryptedData{IV: e.IV, Data: e.Data}, dataKey)
+	}
+}
+
+// Adds recipients, which requires one of the existing identities to unwrap the data key
+func (e *Envelope) AddRecipients(identities []Identity, recipients []Recipient) error {
+	if dataKey, err := e.Recipients.DataKey(identities); err != nil {
+		return err
+	} else if wrappedKeys, err := e.Recipients.Add(dataKey, recipients); err != nil {
+		return err
+	} else {
+		e.Recipients = wrappedKeys
+		return nil
+	}
+}
+
+// Returns a new envelope with a fresh data key (see WrappedKeys.Recipients),
+// as well as the IDs of the recipients that were dropped.
+func (e *Envelope) Rekey(identities []Identity) (*Envelope, []string, error) {
+	if data, err := e.Open(identities); err != nil {
+		return nil, nil, err
+	} else if recipients, dropped, err := e.Recipients.Recipients(identities); err != nil {
+		return nil, nil, err
+	} else if envelope, err := Seal(data, recipients); err != nil {
+		return nil, nil, err
+	} else {
+		return envelope, dropped, nil
+	}
+}
+
+func (e *Envelope) RemoveRecipient(id string) error {
+	if wrappedKeys, err := e.Recipients.Remove(id); err != nil {
+		return err
+	} else {
+		e.Recipients = wrappedKeys
+		return nil
+	}
+}
+
+// Parses an envelope, returns nil if the data is not in envelope format
+func ParseEnvelope(data []byte) *Envelope {
+	var envelope Envelope
+	if err := json.Unmarshal(data, &envelope); err != nil || envelope.Version == 0 || envelope.Recipients == nil {
+		return nil
+	}
+	return &envelope
+}
+
+func PassphraseRecipientFromEnv(id string) (*PassphraseRecipient, error) {
+	passphrase := os.Getenv(envPassName)
+	if passphrase == "" {
+		return nil, fmt.Errorf("no passphrase in environment")
+	}
+	return &PassphraseRecipient{
+		ID:         id,
+		Passphrase: []byte(passphrase),
+	}, nil
+}
+
+// Returns the identities that are configured in the environment, i.e. a
+// passphrase and/or a file containing a private ECDH or X25519 key.
+func IdentitiesFromEnv() ([]Identity, error) {
+	identities := make([]Identity, 0)
+	if passphrase := os.Getenv(envPassName); passphrase != "" {
+		identities = append(identities, &PassphraseIdentity{Passphrase: []byte(passphrase)})
+	}
+	if path := os.Getenv(envIdentityName); path != "" {
+		var key *Key
+		if data, err := ioutil.ReadFile(path); err != nil {
+			return nil, err
+		} else if err := json.Unmarshal(data, &key); err != nil {
+			return nil, err
+		} else if key == nil || key.PrivateKey == nil {
+			return nil, fmt.Errorf("identity file does not contain a private key")
+		}
+		identities = append(identities, &PrivateKeyIdentity{Key: key})
+	}
+	if len(identities) == 0 {
+		return nil, fmt.Errorf("no passphrase or identity in environment")
+	}
+	return identities, nil
+}
@@ -0,0 +1,114 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package crypto
+
+import (
+	"testing"
+)
+
+func TestEnvelope(t *testing.T) {
+
+	aliceKey, err := GenerateWebKey("alice", "x25519")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bob := &PassphraseRecipient{ID: "bob", Passphrase: []byte("bob's secret")}
+	alice := &PublicKeyRecipient{ID: "alice", Key: aliceKey}
+
+	envelope, err := Seal([]byte("secret settings"), []Recipient{alice, bob})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aliceIdentity := &PrivateKeyIdentity{Key: aliceKey}
+	bobIdentity := &PassphraseIdentity{Passphrase: []byte("bob's secret")}
+
+	for _, identity := range []Identity{aliceIdentity, bobIdentity} {
+		if data, err := envelope.Open([]Identity{identity}); err != nil {
+			t.Fatal(err)
+		} else if string(data) != "secret settings" {
+			t.Fatalf("Expected decrypted data to match")
+		}
+	}
+
+	if _, err := envelope.Open([]Identity{&PassphraseIdentity{Passphrase: []byte("wrong")}}); err == nil {
+		t.Fatalf("Expected an error for a wrong passphrase")
+	}
+
+	if err := envelope.RemoveRecipient("bob"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := envelope.Open([]Identity{bobIdentity}); err == nil {
+		t.Fatalf("Expected an error for a removed recipient")
+	}
+
+	if err := envelope.RemoveRecipient("alice"); err == nil {
+		t.Fatalf("Expected an error when removing the last recipient")
+	}
+
+	// alice can add bob again using her own identity
+	if err := envelope.AddRecipients([]Identity{aliceIdentity}, []Recipient{bob}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := envelope.Open([]Identity{bobIdentity}); err != nil {
+		t.Fatal(err)
+	}
+
+}
+
+func TestEnvelopeScryptLimits(t *testing.T) {
+
+	aliceKey, err := GenerateWebKey("alice", "x25519")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bob := &PassphraseRecipient{ID: "bob", Passphrase: []byte("bob's secret")}
+	alice := &PublicKeyRecipient{ID: "alice", Key: aliceKey}
+
+	envelope, err := Seal([]byte("secret settings"), []Recipient{bob, alice})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a crafted file that would make scrypt allocate huge amounts of memory
+	envelope.Recipients[0].N = 1 << 30
+
+	bobIdentity := &PassphraseIdentity{Passphrase: []byte("bob's secret")}
+	aliceIdentity := &PrivateKeyIdentity{Key: aliceKey}
+
+	if _, err := envelope.Open([]Identity{bobIdentity}); err == nil {
+		t.Fatalf("Expected an error for excessive scrypt parameters")
+	}
+
+	// the remaining identities are still tried
+	if data, err := envelope.Open([]Identity{bobIdentity, aliceIdentity}); err != nil {
+		t.Fatal(err)
+	} else if string(data) != "secret settings" {
+		t.Fatalf("Expected decrypted data to match")
+	}
+
+}
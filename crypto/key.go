@@ -30,20 +30,46 @@ type Key struct {
 }
 
 func (k *Key) Encrypt(data []byte, recipient *Key) (*ECDHEncryptedData, error) {
-	if privateKey, err := LoadPrivateKey(k.PrivateKey); err != nil {
+	if key, err := k.DeriveKey(recipient); err != nil {
 		return nil, err
-	} else if publicKey, err := LoadPublicKey(recipient.PublicKey); err != nil {
+	} else if encryptedData, err := Encrypt(data, key); err != nil {
 		return nil, err
 	} else {
-		key := DeriveKey(publicKey, privateKey)
-		if encryptedData, err := Encrypt(data, key); err != nil {
+		return &ECDHEncryptedData{
+			IV:        encryptedData.IV,
+			Data:      encryptedData.Data,
+			PublicKey: k.PublicKey,
+		}, nil
+	}
+}
+
+// decrypts data that was encrypted for this key, using the sender's public key
+func (k *Key) Decrypt(data *ECDHEncryptedData) ([]byte, error) {
+	if key, err := k.DeriveKey(&Key{Type: k.Type, PublicKey: data.PublicKey}); err != nil {
+		return nil, err
+	} else {
+		return Decrypt(&EncryptedData{IV: data.IV, Data: data.Data}, key)
+	}
+}
+
+// derives a shared key using the private key and the recipient's public key
+func (k *Key) DeriveKey(recipient *Key) ([]byte, error) {
+	switch k.Type {
+	case "x25519":
+		if privateKey, err := LoadX25519PrivateKey(k.PrivateKey); err != nil {
+			return nil, err
+		} else if publicKey, err := LoadX25519PublicKey(recipient.PublicKey); err != nil {
+			return nil, err
+		} else {
+			return DeriveX25519Key(publicKey, privateKey)
+		}
+	default:
+		if privateKey, err := LoadPrivateKey(k.PrivateKey); err != nil {
+			return nil, err
+		} else if publicKey, err := LoadPublicKey(recipient.PublicKey); err != nil {
 			return nil, err
 		} else {
-			return &ECDHEncryptedData{
-				IV:        encryptedData.IV,
-				Data:      encryptedData.Data,
-				PublicKey: k.PublicKey,
-			}, nil
+			return DeriveKey(publicKey, privateKey), nil
 		}
 	}
 }
@@ -61,31 +87,35 @@ func (k *Key) SignString(data string) (*SignedStringData, error) {
 }
 
 func (k *Key) Sign(data []byte) (*SignedData, error) {
-	if privateKey, err := LoadPrivateKey(k.PrivateKey); err != nil {
-		return nil, err
-	} else if signature, err := Sign(data, privateKey); err != nil {
-		return nil, err
-	} else {
-		return &SignedData{
-			Data:      data,
-			Signature: signature.Serialize(),
-			PublicKey: k.PublicKey,
-		}, nil
+	var signature []byte
+	switch k.Type {
+	case "ed25519":
+		if privateKey, err := LoadEd25519PrivateKey(k.PrivateKey); err != nil {
+			return nil, err
+		} else {
+			signature = SignEd25519(data, privateKey)
+		}
+	default:
+		if privateKey, err := LoadPrivateKey(k.PrivateKey); err != nil {
+			return nil, err
+		} else if ecdsaSignature, err := Sign(data, privateKey); err != nil {
+			return nil, err
+		} else {
+			signature = ecdsaSignature.Serialize()
+		}
 	}
+	return &SignedData{
+		Data:      data,
+		Signature: signature,
+		PublicKey: k.PublicKey,
+	}, nil
 }
 
+// the key type is encoded in the public key, so we do not need to check it
 func (k *Key) Verify(data *SignedData) (bool, error) {
-	if publicKey, err := LoadPublicKey(k.PublicKey); err != nil {
-		return false, err
-	} else {
-		return Verify(data.Data, data.Signature, publicKey)
-	}
+	return VerifyWithBytes(data.Data, data.Signature, k.PublicKey)
 }
 
 func (k *Key) VerifyString(data *SignedStringData) (bool, error) {
-	if publicKey, err := LoadPublicKey(k.PublicKey); err != nil {
-		return false, err
-	} else {
-		return Verify([]byte(data.Data), data.Signature, publicKey)
-	}
+	return VerifyWithBytes([]byte(data.Data), data.Signature, k.PublicKey)
 }
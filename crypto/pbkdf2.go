@@ -30,11 +30,18 @@ const rounds = 100_000
 const base64Salt = "tlsfpYaKiH/WZUnWkoeE2g=="
 const envPassName = "KIEBITZ_PASSPHRASE"
 
+// Derives the key for the legacy (single key) settings encryption format.
+// New files use envelopes (see envelope.go), we only keep this to be able to
+// read existing files.
 func BuildKeyFromEnv() ([]byte, error) {
-	salt, _ := base64.StdEncoding.DecodeString(base64Salt)
 	passphrase := os.Getenv(envPassName)
 	if passphrase == "" {
 		return nil, fmt.Errorf("no passphrase in environment")
 	}
-	return pbkdf2.Key([]byte(passphrase), salt, rounds, 32, sha256.New), nil
+	return LegacyKey([]byte(passphrase)), nil
+}
+
+func LegacyKey(passphrase []byte) []byte {
+	salt, _ := base64.StdEncoding.DecodeString(base64Salt)
+	return pbkdf2.Key(passphrase, salt, rounds, 32, sha256.New)
 }
@@ -20,8 +20,27 @@ package crypto
 
 import (
 	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/x509"
+	"fmt"
 )
 
+// Verifies a signature with a public key in SPKI format. The signature
+// algorithm (ECDSA P-256 or Ed25519) is determined by the public key type.
+func VerifyWithBytes(message, signature, publicKeyData []byte) (bool, error) {
+	pub, err := x509.ParsePKIXPublicKey(publicKeyData)
+	if err != nil {
+		return false, fmt.Errorf("cannot parse public key")
+	}
+	switch pub := pub.(type) {
+	case *ecdsa.PublicKey:
+		return Verify(message, signature, pub)
+	case ed25519.PublicKey:
+		return VerifyEd25519(message, signature, pub)
+	}
+	return false, fmt.Errorf("invalid public key type")
+}
+
 type SignedStringData struct {
 	Data      string `json:"data"`
 	Signature []byte `json:"signature"`
@@ -0,0 +1,339 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package crypto
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+/*
+The stream format encrypts data in authenticated chunks, so that it can be
+decrypted without holding the whole file in memory and any truncation or
+modification is detected. A stream starts with a header:
+
+	magic ("KBZS", 4 bytes) | version (1 byte) | nonce prefix (7 bytes) |
+	chunk size (uint32) | recipients length (uint32) | recipients (JSON)
+
+The first 16 bytes of the header are authenticated as additional data with
+every chunk. The recipients (i.e. the wrapped data keys) are not, as each of
+them is authenticated on its own, which allows us to add and remove
+recipients without re-encrypting the data.
+
+Each chunk is encrypted with AES-GCM using a nonce that consists of the nonce
+prefix, a 32-bit chunk counter and a flag that marks the last chunk (STREAM
+construction), so chunks can neither be reordered nor dropped.
+*/
+
+const StreamVersion = 1
+const StreamMagic = "KBZS"
+const streamChunkSize = 64 * 1024
+const streamMaxChunkSize = 1024 * 1024
+const streamMaxRecipientsSize = 1024 * 1024
+const streamAADSize = 16
+const streamNoncePrefixSize = 7
+
+type StreamHeader struct {
+	Version    byte
+	ChunkSize  int
+	Nonce      []byte
+	Recipients WrappedKeys
+}
+
+func (h *StreamHeader) aad() []byte {
+	aad := make([]byte, 0, streamAADSize)
+	aad = append(aad, []byte(StreamMagic)...)
+	aad = append(aad, h.Version)
+	aad = append(aad, h.Nonce...)
+	aad = append(aad, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(aad[12:], uint32(h.ChunkSize))
+	return aad
+}
+
+func (h *StreamHeader) Marshal() ([]byte, error) {
+	recipients, err := json.Marshal(h.Recipients)
+	if err != nil {
+		return nil, err
+	}
+	data := h.aad()
+	data = append(data, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(data[streamAADSize:], uint32(len(recipients)))
+	return append(data, recipients...), nil
+}
+
+// Checks whether the data starts with the stream magic
+func IsStream(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(StreamMagic))
+}
+
+func ReadStreamHeader(r io.Reader) (*StreamHeader, error) {
+	prefix := make([]byte, streamAADSize+4)
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		return nil, fmt.Errorf("cannot read stream header: %w", err)
+	}
+	if !IsStream(prefix) {
+		return nil, fmt.Errorf("not an encrypted stream")
+	}
+	header := &StreamHeader{
+		Version:   prefix[4],
+		Nonce:     prefix[5 : 5+streamNoncePrefixSize],
+		ChunkSize: int(binary.BigEndian.Uint32(prefix[12:16])),
+	}
+	if header.Version != StreamVersion {
+		return nil, fmt.Errorf("unsupported stream version: %d", header.Version)
+	}
+	if header.ChunkSize <= 0 || header.ChunkSize > streamMaxChunkSize {
+		return nil, fmt.Errorf("invalid chunk size: %d", header.ChunkSize)
+	}
+	recipientsSize := binary.BigEndian.Uint32(prefix[16:])
+	if recipientsSize > streamMaxRecipientsSize {
+		return nil, fmt.Errorf("recipients too large")
+	}
+	recipients := make([]byte, recipientsSize)
+	if _, err := io.ReadFull(r, recipients); err != nil {
+		return nil, fmt.Errorf("cannot read stream recipients: %w", err)
+	}
+	if err := json.Unmarshal(recipients, &header.Recipients); err != nil {
+		return nil, fmt.Errorf("invalid stream recipients: %w", err)
+	}
+	return header, nil
+}
+
+func streamCipher(dataKey []byte) (cipher.AEAD, error) {
+	if block, err := aes.NewCipher(dataKey); err != nil {
+		return nil, err
+	} else {
+		return cipher.NewGCM(block)
+	}
+}
+
+func (h *StreamHeader) nonce(counter uint32, last bool) []byte {
+	nonce := make([]byte, 12)
+	copy(nonce, h.Nonce)
+	binary.BigEndian.PutUint32(nonce[streamNoncePrefixSize:], counter)
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+type streamWriter struct {
+	w       io.Writer
+	header  *StreamHeader
+	aead    cipher.AEAD
+	aad     []byte
+	buffer  []byte
+	counter uint32
+	closed  bool
+}
+
+// Returns a writer that encrypts data for the given recipients. The writer
+// must be closed to write the last chunk.
+func NewStreamWriter(w io.Writer, recipients []Recipient) (io.WriteCloser, error) {
+	if len(recipients) == 0 {
+		return nil, fmt.Errorf("at least one recipient is required")
+	}
+	dataKey, err := RandomBytes(32)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := RandomBytes(streamNoncePrefixSize)
+	if err != nil {
+		return nil, err
+	}
+	wrappedKeys, err := WrappedKeys{}.Add(dataKey, recipients)
+	if err != nil {
+		return nil, err
+	}
+	header := &StreamHeader{
+		Version:    StreamVersion,
+		ChunkSize:  streamChunkSize,
+		Nonce:      nonce,
+		Recipients: wrappedKeys,
+	}
+	aead, err := streamCipher(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	if headerData, err := header.Marshal(); err != nil {
+		return nil, err
+	} else if _, err := w.Write(headerData); err != nil {
+		return nil, err
+	}
+	return &streamWriter{
+		w:      w,
+		header: header,
+		aead:   aead,
+		aad:    header.aad(),
+		buffer: make([]byte, 0, streamChunkSize),
+	}, nil
+}
+
+func (s *streamWriter) writeChunk(data []byte, last bool) error {
+	if s.counter == ^uint32(0) {
+		return fmt.Errorf("stream too long")
+	}
+	chunk := s.aead.Seal(nil, s.header.nonce(s.counter, last), data, s.aad)
+	s.counter++
+	_, err := s.w.Write(chunk)
+	return err
+}
+
+func (s *streamWriter) Write(p []byte) (int, error) {
+	if s.closed {
+		return 0, fmt.Errorf("stream already closed")
+	}
+	s.buffer = append(s.buffer, p...)
+	// we always keep the last chunk in the buffer until the stream is closed
+	for len(s.buffer) > s.header.ChunkSize {
+		if err := s.writeChunk(s.buffer[:s.header.ChunkSize], false); err != nil {
+			return 0, err
+		}
+		s.buffer = s.buffer[s.header.ChunkSize:]
+	}
+	return len(p), nil
+}
+
+func (s *streamWriter) Close() error {
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	return s.writeChunk(s.buffer, true)
+}
+
+type streamReader struct {
+	r       *bufio.Reader
+	header  *StreamHeader
+	aead    cipher.AEAD
+	aad     []byte
+	chunk   []byte
+	buffer  []byte
+	counter uint32
+	done    bool
+}
+
+// Returns a reader that decrypts and authenticates a stream chunk by chunk.
+// Any modification or truncation of the stream results in an error.
+func NewStreamReader(r io.Reader, identities []Identity) (io.Reader, error) {
+	header, err := ReadStreamHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	dataKey, err := header.Recipients.DataKey(identities)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := streamCipher(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return &streamReader{
+		r:      bufio.NewReader(r),
+		header: header,
+		aead:   aead,
+		aad:    header.aad(),
+		chunk:  make([]byte, header.ChunkSize+aead.Overhead()),
+	}, nil
+}
+
+func (s *streamReader) readChunk() error {
+	n, err := io.ReadFull(s.r, s.chunk)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return err
+	}
+	// this is the last chunk if there is no more data after it
+	last := err != nil
+	if !last {
+		if _, err := s.r.Peek(1); err == io.EOF {
+			last = true
+		} else if err != nil {
+			return err
+		}
+	}
+	data, err := s.aead.Open(nil, s.header.nonce(s.counter, last), s.chunk[:n], s.aad)
+	if err != nil {
+		if last {
+			return fmt.Errorf("stream is truncated or corrupted")
+		}
+		return fmt.Errorf("stream is corrupted")
+	}
+	s.counter++
+	s.buffer = data
+	s.done = last
+	return nil
+}
+
+func (s *streamReader) Read(p []byte) (int, error) {
+	for len(s.buffer) == 0 {
+		if s.done {
+			return 0, io.EOF
+		}
+		if err := s.readChunk(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, s.buffer)
+	s.buffer = s.buffer[n:]
+	return n, nil
+}
+
+// Encrypts data in the stream format
+func SealStream(data []byte, recipients []Recipient) ([]byte, error) {
+	buffer := &bytes.Buffer{}
+	if writer, err := NewStreamWriter(buffer, recipients); err != nil {
+		return nil, err
+	} else if _, err := writer.Write(data); err != nil {
+		return nil, err
+	} else if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// Decrypts data in the stream format
+func OpenStream(data []byte, identities []Identity) ([]byte, error) {
+	if reader, err := NewStreamReader(bytes.NewReader(data), identities); err != nil {
+		return nil, err
+	} else {
+		return io.ReadAll(reader)
+	}
+}
+
+// Replaces the recipients of a stream, which does not require re-encrypting
+// the chunks. The data key must be wrapped for all new recipients.
+func ReplaceStreamRecipients(data []byte, recipients WrappedKeys) ([]byte, error) {
+	reader := bytes.NewReader(data)
+	if header, err := ReadStreamHeader(reader); err != nil {
+		return nil, err
+	} else {
+		header.Recipients = recipients
+		if headerData, err := header.Marshal(); err != nil {
+			return nil, err
+		} else {
+			return append(headerData, data[len(data)-reader.Len():]...), nil
+		}
+	}
+}
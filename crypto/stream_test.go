@@ -0,0 +1,96 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package crypto
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestStream(t *testing.T) {
+
+	recipient := &PassphraseRecipient{ID: "admin", Passphrase: []byte("secret")}
+	identities := []Identity{&PassphraseIdentity{Passphrase: []byte("secret")}}
+
+	// we use data that spans several chunks
+	data := bytes.Repeat([]byte("0123456789"), streamChunkSize/4)
+
+	streamData, err := SealStream(data, []Recipient{recipient})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if decData, err := OpenStream(streamData, identities); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(decData, data) {
+		t.Fatalf("Expected decrypted data to match")
+	}
+
+	header, err := ReadStreamHeader(bytes.NewReader(streamData))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	headerData, err := header.Marshal()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chunkSize := streamChunkSize + 16
+
+	// dropping the last chunk must be detected
+	if _, err := OpenStream(streamData[:len(headerData)+2*chunkSize], identities); err == nil {
+		t.Fatalf("Expected an error for a truncated stream")
+	}
+
+	// modifying a chunk must be detected
+	modifiedData := append([]byte{}, streamData...)
+	modifiedData[len(headerData)+10] ^= 1
+
+	if _, err := OpenStream(modifiedData, identities); err == nil {
+		t.Fatalf("Expected an error for a modified stream")
+	}
+
+	// recipients can be replaced without re-encrypting the data
+	dataKey, err := header.Recipients.DataKey(identities)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wrappedKeys, err := WrappedKeys{}.Add(dataKey, []Recipient{&PassphraseRecipient{ID: "bob", Passphrase: []byte("bob")}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rekeyedData, err := ReplaceStreamRecipients(streamData, wrappedKeys); err != nil {
+		t.Fatal(err)
+	} else if _, err := OpenStream(rekeyedData, identities); err == nil {
+		t.Fatalf("Expected an error for a removed recipient")
+	} else if decData, err := OpenStream(rekeyedData, []Identity{&PassphraseIdentity{Passphrase: []byte("bob")}}); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(decData, data) {
+		t.Fatalf("Expected decrypted data to match")
+	}
+
+}
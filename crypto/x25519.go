@@ -0,0 +1,138 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package crypto
+
+import (
+	"crypto/rand"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"golang.org/x/crypto/curve25519"
+	"io"
+)
+
+// RFC 8410 object identifier for X25519 keys
+var oidX25519 = asn1.ObjectIdentifier{1, 3, 101, 110}
+
+// the x509 package cannot (un)marshal X25519 keys, so we implement the
+// (very simple) SPKI & PKCS8 structures from RFC 8410 ourselves
+
+type x25519PublicKeyInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	PublicKey asn1.BitString
+}
+
+type x25519PrivateKeyInfo struct {
+	Version    int
+	Algorithm  pkix.AlgorithmIdentifier
+	PrivateKey []byte
+}
+
+func GenerateX25519Key() ([]byte, error) {
+	privateKey := make([]byte, curve25519.ScalarSize)
+	if _, err := io.ReadFull(rand.Reader, privateKey); err != nil {
+		return nil, err
+	}
+	return privateKey, nil
+}
+
+func AsX25519SettingsKey(key []byte, name string) (*Key, error) {
+	publicKey, err := curve25519.X25519(key, curve25519.Basepoint)
+	if err != nil {
+		return nil, err
+	}
+	marshalledPublicKey, err := MarshalX25519PublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	marshalledPrivateKey, err := MarshalX25519PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Key{
+		Type:       "x25519",
+		PublicKey:  marshalledPublicKey,
+		PrivateKey: marshalledPrivateKey,
+		Purposes:   []string{"deriveKey"},
+		Params: map[string]interface{}{
+			"curve": "x25519",
+		},
+		Name:   name,
+		Format: "spki-pkcs8",
+	}, nil
+}
+
+func MarshalX25519PublicKey(publicKey []byte) ([]byte, error) {
+	return asn1.Marshal(x25519PublicKeyInfo{
+		Algorithm: pkix.AlgorithmIdentifier{Algorithm: oidX25519},
+		PublicKey: asn1.BitString{Bytes: publicKey, BitLength: len(publicKey) * 8},
+	})
+}
+
+func MarshalX25519PrivateKey(privateKey []byte) ([]byte, error) {
+	// the private key is wrapped in another octet string (CurvePrivateKey)
+	if curvePrivateKey, err := asn1.Marshal(privateKey); err != nil {
+		return nil, err
+	} else {
+		return asn1.Marshal(x25519PrivateKeyInfo{
+			Algorithm:  pkix.AlgorithmIdentifier{Algorithm: oidX25519},
+			PrivateKey: curvePrivateKey,
+		})
+	}
+}
+
+func LoadX25519PublicKey(publicKey []byte) ([]byte, error) {
+	var info x25519PublicKeyInfo
+	if rest, err := asn1.Unmarshal(publicKey, &info); err != nil || len(rest) > 0 {
+		return nil, fmt.Errorf("cannot parse public key")
+	}
+	if !info.Algorithm.Algorithm.Equal(oidX25519) {
+		return nil, fmt.Errorf("invalid public key type")
+	}
+	if len(info.PublicKey.Bytes) != curve25519.PointSize {
+		return nil, fmt.Errorf("invalid public key length")
+	}
+	return info.PublicKey.Bytes, nil
+}
+
+func LoadX25519PrivateKey(privateKey []byte) ([]byte, error) {
+	var info x25519PrivateKeyInfo
+	var curvePrivateKey []byte
+	if rest, err := asn1.Unmarshal(privateKey, &info); err != nil || len(rest) > 0 {
+		return nil, fmt.Errorf("cannot parse private key")
+	}
+	if !info.Algorithm.Algorithm.Equal(oidX25519) {
+		return nil, fmt.Errorf("invalid private key type")
+	}
+	if _, err := asn1.Unmarshal(info.PrivateKey, &curvePrivateKey); err != nil {
+		return nil, fmt.Errorf("cannot parse private key")
+	}
+	if len(curvePrivateKey) != curve25519.ScalarSize {
+		return nil, fmt.Errorf("invalid private key length")
+	}
+	return curvePrivateKey, nil
+}
+
+// Derives a key from a public and private X25519 key pair. Like for P-256 we
+// directly use the shared secret as the AES key, which is compatible to the
+// bits derived by the subtle crypto API
+func DeriveX25519Key(publicKey, privateKey []byte) ([]byte, error) {
+	return curve25519.X25519(privateKey, publicKey)
+}
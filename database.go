@@ -59,6 +59,19 @@ type Database interface {
 	DatabaseOps
 }
 
+// Databases that support publish/subscribe messaging, e.g. to notify other
+// server instances about changes
+type PubSub interface {
+	Publish(channel string, message []byte) error
+	Subscribe(channel string) (Subscription, error)
+}
+
+type Subscription interface {
+	// the channel is closed when the subscription is closed
+	Messages() <-chan []byte
+	Close() error
+}
+
 type Object interface {
 }
 
@@ -30,6 +30,7 @@ type TTL struct {
 }
 
 type InMemory struct {
+	*InMemoryPubSub
 	Data map[string][][]byte
 	TTLs []*TTL
 }
@@ -57,8 +58,9 @@ func ValidateInMemorySettings(settings map[string]interface{}) (interface{}, err
 
 func MakeInMemory(settings interface{}) (services.Database, error) {
 	return &InMemory{
-		Data: make(map[string][][]byte),
-		TTLs: make([]*TTL, 0, 100),
+		InMemoryPubSub: MakeInMemoryPubSub(),
+		Data:           make(map[string][][]byte),
+		TTLs:           make([]*TTL, 0, 100),
 	}, nil
 }
 
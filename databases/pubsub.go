@@ -0,0 +1,146 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package databases
+
+import (
+	"github.com/go-redis/redis/v8"
+	"github.com/impfen/services-inoeg"
+	"sync"
+)
+
+// number of messages that we buffer for a slow subscriber before dropping
+const subscriptionBufferSize = 100
+
+type InMemoryPubSub struct {
+	mutex         sync.Mutex
+	subscriptions map[string]map[*InMemorySubscription]bool
+}
+
+type InMemorySubscription struct {
+	pubSub   *InMemoryPubSub
+	channel  string
+	messages chan []byte
+	closed   bool
+}
+
+func MakeInMemoryPubSub() *InMemoryPubSub {
+	return &InMemoryPubSub{
+		subscriptions: make(map[string]map[*InMemorySubscription]bool),
+	}
+}
+
+var _ services.PubSub = &InMemoryPubSub{}
+
+func (p *InMemoryPubSub) Publish(channel string, message []byte) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for subscription := range p.subscriptions[channel] {
+		select {
+		case subscription.messages <- message:
+		default:
+			services.Log.Warningf("subscription buffer full, dropping message on channel '%s'", channel)
+		}
+	}
+	return nil
+}
+
+func (p *InMemoryPubSub) Subscribe(channel string) (services.Subscription, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	subscription := &InMemorySubscription{
+		pubSub:   p,
+		channel:  channel,
+		messages: make(chan []byte, subscriptionBufferSize),
+	}
+	if _, ok := p.subscriptions[channel]; !ok {
+		p.subscriptions[channel] = make(map[*InMemorySubscription]bool)
+	}
+	p.subscriptions[channel][subscription] = true
+	return subscription, nil
+}
+
+func (s *InMemorySubscription) Messages() <-chan []byte {
+	return s.messages
+}
+
+func (s *InMemorySubscription) Close() error {
+	s.pubSub.mutex.Lock()
+	defer s.pubSub.mutex.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	delete(s.pubSub.subscriptions[s.channel], s)
+	if len(s.pubSub.subscriptions[s.channel]) == 0 {
+		delete(s.pubSub.subscriptions, s.channel)
+	}
+	close(s.messages)
+	return nil
+}
+
+type RedisSubscription struct {
+	pubSub   *redis.PubSub
+	messages chan []byte
+}
+
+var _ services.PubSub = &Redis{}
+
+// Channels are assigned to shards like keys, so publishers and subscribers
+// of a channel always use the same shard.
+func (d *Redis) Publish(channel string, message []byte) error {
+	return d.Client(channel).Publish(d.Ctx, channel, message).Err()
+}
+
+func (d *Redis) Subscribe(channel string) (services.Subscription, error) {
+
+	pubSub := d.Client(channel).Subscribe(d.Ctx, channel)
+
+	// we wait for the confirmation so that no messages get lost afterwards
+	if _, err := pubSub.Receive(d.Ctx); err != nil {
+		pubSub.Close()
+		return nil, err
+	}
+
+	subscription := &RedisSubscription{
+		pubSub:   pubSub,
+		messages: make(chan []byte, subscriptionBufferSize),
+	}
+
+	go func() {
+		// the channel is closed when the subscription is closed
+		for message := range pubSub.Channel() {
+			select {
+			case subscription.messages <- []byte(message.Payload):
+			default:
+				services.Log.Warningf("subscription buffer full, dropping message on channel '%s'", channel)
+			}
+		}
+		close(subscription.messages)
+	}()
+
+	return subscription, nil
+}
+
+func (s *RedisSubscription) Messages() <-chan []byte {
+	return s.messages
+}
+
+func (s *RedisSubscription) Close() error {
+	return s.pubSub.Close()
+}
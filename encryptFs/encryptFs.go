@@ -23,41 +23,99 @@
 package encryptFs
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"github.com/impfen/services-inoeg/crypto"
 	"io"
 	"io/fs"
+	"io/ioutil"
+	"path"
 )
 
 type EncryptedFS struct {
-	envfs fs.FS
-	key   []byte
+	envfs          fs.FS
+	identities     []crypto.Identity
+	allowPlaintext func(name string) bool
 }
 
 type EncryptedFile struct {
 	file   fs.File
-	key    []byte
-	buffer []byte
-	isEOF  bool
+	reader io.Reader
 }
 
-func New(fs fs.FS, key []byte) fs.FS {
+// Returns a file system that decrypts files with the given identities.
+// Unencrypted files are only accepted if allowPlaintext returns true for
+// their name, so that a corrupted encrypted file never gets loaded as is.
+func New(fs fs.FS, identities []crypto.Identity, allowPlaintext func(name string) bool) fs.FS {
+	if allowPlaintext == nil {
+		allowPlaintext = AllowPlaintext(nil)
+	}
 	return &EncryptedFS{
-		envfs: fs,
-		key:   key,
+		envfs:          fs,
+		identities:     identities,
+		allowPlaintext: allowPlaintext,
+	}
+}
+
+// Allows unencrypted files whose base name matches one of the given glob patterns
+func AllowPlaintext(patterns []string) func(name string) bool {
+	return func(name string) bool {
+		for _, pattern := range patterns {
+			if ok, err := path.Match(pattern, path.Base(name)); err == nil && ok {
+				return true
+			}
+		}
+		return false
 	}
 }
 
 func (e *EncryptedFS) Open(name string) (fs.File, error) {
-	if file, err := e.envfs.Open(name); err != nil {
+	file, err := e.envfs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if stat, err := file.Stat(); err != nil {
+		file.Close()
+		return nil, err
+	} else if stat.IsDir() {
+		return file, nil
+	}
+
+	reader := bufio.NewReader(file)
+
+	if prefix, err := reader.Peek(len(crypto.StreamMagic)); err == nil && crypto.IsStream(prefix) {
+		// streams are decrypted chunk by chunk while reading
+		if streamReader, err := crypto.NewStreamReader(reader, e.identities); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("cannot decrypt '%s': %w", name, err)
+		} else {
+			return &EncryptedFile{
+				file:   file,
+				reader: streamReader,
+			}, nil
+		}
+	}
+
+	// envelopes, legacy and unencrypted files are small, so we read them at once
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		file.Close()
 		return nil, err
+	}
+
+	if decData, encrypted, err := Decrypt(data, e.identities); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("cannot decrypt '%s': %w", name, err)
+	} else if !encrypted && !e.allowPlaintext(name) {
+		file.Close()
+		return nil, fmt.Errorf("'%s' is not encrypted and unencrypted settings are not allowed", name)
 	} else {
 		return &EncryptedFile{
 			file:   file,
-			key:    e.key,
-			buffer: []byte{},
-			isEOF:  false,
+			reader: bytes.NewReader(decData),
 		}, nil
 	}
 }
@@ -74,45 +132,46 @@ func (e *EncryptedFile) Stat() (fs.FileInfo, error) {
 	return e.file.Stat()
 }
 
-// this is not efficient and should only be used for relatively small files
 func (e *EncryptedFile) Read(p []byte) (int, error) {
-	if len(e.buffer) == 0 && !e.isEOF {
-
-		var data []byte
-		var buffer = make([]byte, 32)
+	return e.reader.Read(p)
+}
 
-		for {
-			size, err := e.file.Read(buffer)
-			if err == io.EOF {
-				break
-			} else if err != nil {
-				return 0, err
-			}
-			data = append(data, buffer[:size]...)
+// Decrypts the contents of a settings file, which can be a stream, an
+// envelope, a file in the legacy format or unencrypted. Also returns whether
+// the data was encrypted.
+func Decrypt(data []byte, identities []crypto.Identity) ([]byte, bool, error) {
+	var encData crypto.EncryptedData
+	if crypto.IsStream(data) {
+		decData, err := crypto.OpenStream(data, identities)
+		if err != nil {
+			return nil, true, fmt.Errorf("decrypt failed: %w", err)
 		}
-
-		var encData crypto.EncryptedData
-		if err := json.Unmarshal(data, &encData); err != nil || encData.IV == nil || encData.Data == nil {
-			e.buffer = data
-		} else {
-			decData, err := crypto.Decrypt(&encData, e.key)
-			if err != nil {
-				return 0, fmt.Errorf("decrypt failed")
-			}
-			e.buffer = decData
+		return decData, true, nil
+	} else if envelope := crypto.ParseEnvelope(data); envelope != nil {
+		decData, err := envelope.Open(identities)
+		if err != nil {
+			return nil, true, fmt.Errorf("decrypt failed: %w", err)
 		}
-
-	}
-	if e.isEOF {
-		return 0, io.EOF
+		return decData, true, nil
+	} else if err := json.Unmarshal(data, &encData); err != nil || encData.IV == nil || encData.Data == nil {
+		return data, false, nil
+	} else {
+		decData, err := decryptLegacy(&encData, identities)
+		if err != nil {
+			return nil, true, fmt.Errorf("decrypt failed")
+		}
+		return decData, true, nil
 	}
+}
 
-	size := copy(p, e.buffer)
-	e.buffer = e.buffer[size:]
-	if len(e.buffer) == 0 {
-		e.isEOF = true
+// files in the legacy format are encrypted with a key derived from a passphrase
+func decryptLegacy(data *crypto.EncryptedData, identities []crypto.Identity) ([]byte, error) {
+	for _, identity := range identities {
+		if passphraseIdentity, ok := identity.(*crypto.PassphraseIdentity); ok {
+			if decData, err := passphraseIdentity.DecryptLegacy(data); err == nil {
+				return decData, nil
+			}
+		}
 	}
-
-	return size, nil
-
+	return nil, fmt.Errorf("no matching passphrase")
 }
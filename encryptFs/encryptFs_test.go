@@ -0,0 +1,71 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package encryptFs
+
+import (
+	"github.com/impfen/services-inoeg/crypto"
+	"io/ioutil"
+	"testing"
+	"testing/fstest"
+)
+
+func TestPlaintextSettings(t *testing.T) {
+
+	passphrase := []byte("secret")
+
+	encData, err := crypto.SealStream([]byte("secret: true"), []crypto.Recipient{&crypto.PassphraseRecipient{ID: "admin", Passphrase: passphrase}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mapFS := fstest.MapFS{
+		"002_admin.json":  &fstest.MapFile{Data: encData},
+		"001_default.yml": &fstest.MapFile{Data: []byte("name: test")},
+	}
+
+	identities := []crypto.Identity{&crypto.PassphraseIdentity{Passphrase: passphrase}}
+
+	// without an allow list unencrypted files are rejected
+	encFs := New(mapFS, identities, nil)
+
+	if _, err := encFs.Open("001_default.yml"); err == nil {
+		t.Fatalf("Expected an error for an unencrypted file")
+	}
+
+	if file, err := encFs.Open("002_admin.json"); err != nil {
+		t.Fatal(err)
+	} else if data, err := ioutil.ReadAll(file); err != nil {
+		t.Fatal(err)
+	} else if string(data) != "secret: true" {
+		t.Fatalf("Expected decrypted data to match")
+	}
+
+	// files matching the allow list may be unencrypted
+	encFs = New(mapFS, identities, AllowPlaintext([]string{"001_*.yml"}))
+
+	if file, err := encFs.Open("001_default.yml"); err != nil {
+		t.Fatal(err)
+	} else if data, err := ioutil.ReadAll(file); err != nil {
+		t.Fatal(err)
+	} else if string(data) != "name: test" {
+		t.Fatalf("Expected plaintext data to match")
+	}
+
+}
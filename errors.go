@@ -0,0 +1,156 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package services
+
+import (
+	"strconv"
+	"time"
+)
+
+// An entry of the error catalog. The code is stable and meant for programs,
+// the message is meant for humans and may change.
+type APIError struct {
+	Code   string `json:"code"`
+	Status int    `json:"status"`
+	// the JSON-RPC error code, if it differs from the HTTP status
+	RPCCode int    `json:"rpcCode,omitempty"`
+	Message string `json:"message"`
+	// for temporary errors, the number of seconds after which to retry
+	RetryAfter int `json:"retryAfter,omitempty"`
+}
+
+// The data of error responses
+type ErrorData struct {
+	Code       string      `json:"code"`
+	ServerTime time.Time   `json:"serverTime"`
+	RetryAfter int         `json:"retryAfter,omitempty"`
+	Details    interface{} `json:"details,omitempty"`
+}
+
+var (
+	// protocol errors
+	ErrNotFound           = &APIError{Code: "not_found", Status: 404, Message: "not found"}
+	ErrMethodNotFound     = &APIError{Code: "method_not_found", Status: 404, RPCCode: -32601, Message: "method not found"}
+	ErrInvalidParams      = &APIError{Code: "invalid_params", Status: 400, RPCCode: -32602, Message: "invalid params"}
+	ErrInternal           = &APIError{Code: "internal_error", Status: 500, RPCCode: -32603, Message: "internal error"}
+	ErrInvalidJSON        = &APIError{Code: "invalid_json", Status: 400, RPCCode: -32700, Message: "invalid JSON"}
+	ErrDuplicateParameter = &APIError{Code: "duplicate_parameter", Status: 400, Message: "parameter supplied twice"}
+
+	// authentication errors
+	ErrNotAuthorized    = &APIError{Code: "not_authorized", Status: 401, Message: "not authorized"}
+	ErrInvalidSignature = &APIError{Code: "invalid_signature", Status: 403, Message: "invalid signature"}
+	ErrSignatureExpired = &APIError{Code: "signature_expired", Status: 410, Message: "signature expired"}
+	ErrInvalidToken     = &APIError{Code: "invalid_token", Status: 400, Message: "invalid token"}
+	ErrInvalidKey       = &APIError{Code: "invalid_key", Status: 400, Message: "invalid key"}
+	ErrTooManyTokens    = &APIError{Code: "too_many_tokens", Status: 401, Message: "maximum number of tokens exceeded"}
+
+	// request errors
+	ErrProviderNotFound             = &APIError{Code: "provider_not_found", Status: 404, Message: "provider not found"}
+	ErrTooManyAppointments          = &APIError{Code: "too_many_appointments", Status: 429, Message: "max number of appointments per post exceeded"}
+	ErrPersistentConnectionRequired = &APIError{Code: "persistent_connection_required", Status: 400, Message: "persistent connection required"}
+	ErrNotATestSystem               = &APIError{Code: "not_a_test_system", Status: 400, Message: "not a test system, will not reset database..."}
+	ErrDuplicateAppointment         = &APIError{Code: "duplicate_appointment", Status: 400, Message: "appointment submitted more than once"}
+	ErrBookedSlotsRemoved           = &APIError{Code: "booked_slots_removed", Status: 409, Message: "booked slots would be removed, set force to remove them"}
+	ErrIdempotencyKeyReused         = &APIError{Code: "idempotency_key_reused", Status: 409, Message: "idempotency key was used for a different request"}
+	ErrTooManySubscriptions         = &APIError{Code: "too_many_subscriptions", Status: 429, Message: "maximum number of subscriptions per connection exceeded"}
+
+	// temporary errors
+	ErrLockTimeout            = &APIError{Code: "lock_timeout", Status: 503, Message: "lock timeout", RetryAfter: 1}
+	ErrPrivacyBudgetExhausted = &APIError{Code: "privacy_budget_exhausted", Status: 429, Message: "privacy budget exhausted"}
+	ErrRateLimitExceeded      = &APIError{Code: "rate_limit_exceeded", Status: 429, Message: "rate limit exceeded"}
+)
+
+// All errors that the APIs return
+var ErrorCatalog = []*APIError{
+	ErrNotFound,
+	ErrMethodNotFound,
+	ErrInvalidParams,
+	ErrInternal,
+	ErrInvalidJSON,
+	ErrDuplicateParameter,
+	ErrNotAuthorized,
+	ErrInvalidSignature,
+	ErrSignatureExpired,
+	ErrInvalidToken,
+	ErrInvalidKey,
+	ErrTooManyTokens,
+	ErrProviderNotFound,
+	ErrTooManyAppointments,
+	ErrPersistentConnectionRequired,
+	ErrNotATestSystem,
+	ErrDuplicateAppointment,
+	ErrBookedSlotsRemoved,
+	ErrIdempotencyKeyReused,
+	ErrTooManySubscriptions,
+	ErrLockTimeout,
+	ErrPrivacyBudgetExhausted,
+	ErrRateLimitExceeded,
+}
+
+// Returns the catalog entry with the given code or nil
+func LookupError(code string) *APIError {
+	for _, err := range ErrorCatalog {
+		if err.Code == code {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+// The code of the error in JSON-RPC responses
+func (e *APIError) JSONRPCCode() int {
+	if e.RPCCode != 0 {
+		return e.RPCCode
+	}
+	return e.Status
+}
+
+// Returns a copy of the error with the given retry delay
+func (e *APIError) WithRetryAfter(delay time.Duration) *APIError {
+	retryable := *e
+	retryable.RetryAfter = int(delay.Seconds())
+	if delay > 0 && retryable.RetryAfter == 0 {
+		retryable.RetryAfter = 1
+	}
+	return &retryable
+}
+
+// Returns the data of an error response with the given details
+func (e *APIError) Data(details interface{}) *ErrorData {
+	return &ErrorData{
+		Code:       e.Code,
+		ServerTime: time.Now().UTC(),
+		RetryAfter: e.RetryAfter,
+		Details:    details,
+	}
+}
+
+// Returns the HTTP headers of an error response
+func (e *APIError) Headers() map[string]string {
+	if e.RetryAfter == 0 {
+		return nil
+	}
+	return map[string]string{
+		"Retry-After": strconv.Itoa(e.RetryAfter),
+	}
+}
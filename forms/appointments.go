@@ -71,6 +71,15 @@ func (j JSON) Validate(value interface{}, values map[string]interface{}) (interf
 	return jsonValue, nil
 }
 
+// Describes the field as a JSON string, following validators apply to its content
+func (j JSON) DescribeSchema(schema map[string]interface{}) map[string]interface{} {
+	content := map[string]interface{}{}
+	schema["type"] = "string"
+	schema["contentMediaType"] = "application/json"
+	schema["contentSchema"] = content
+	return content
+}
+
 type IsValidVaccine struct {}
 
 func (f IsValidVaccine) Validate(input interface{}, inputs map[string]interface{}) (interface{}, error) {
@@ -226,6 +235,14 @@ func (f IsValidAppointmentDuration) ValidateWithContext(
 
 
 var PublicKeyValidators = []forms.Validator{
+	forms.IsBytes{
+		Encoding:  "base64",
+		MaxLength: 128,
+		MinLength: 44, // Ed25519 & X25519 SPKI keys
+	},
+}
+
+var SignatureValidators = []forms.Validator{
 	forms.IsBytes{
 		Encoding:  "base64",
 		MaxLength: 128,
@@ -233,18 +250,36 @@ var PublicKeyValidators = []forms.Validator{
 	},
 }
 
+var SigningTypeField = forms.Field{
+	Name:        "signingType",
+	Description: "Type of the signing key (ecdsa or ed25519), defaults to ecdsa.",
+	Validators: []forms.Validator{
+		forms.IsOptional{Default: "ecdsa"},
+		forms.IsIn{Choices: []interface{}{"ecdsa", "ed25519"}},
+	},
+}
+
+var EncryptionTypeField = forms.Field{
+	Name:        "encryptionType",
+	Description: "Type of the encryption key (ecdh or x25519), defaults to ecdh.",
+	Validators: []forms.Validator{
+		forms.IsOptional{Default: "ecdh"},
+		forms.IsIn{Choices: []interface{}{"ecdh", "x25519"}},
+	},
+}
+
 var PublicKeyField = forms.Field{
 	Name:        "publicKey",
 	Global:      true,
-	Description: "An ECDSA or ECDH public key.",
+	Description: "An ECDSA, ECDH, Ed25519 or X25519 public key.",
 	Validators:  PublicKeyValidators,
 }
 
 var SignatureField = forms.Field{
 	Name:        "signature",
 	Global:      true,
-	Description: "An ECDSA signature.",
-	Validators:  PublicKeyValidators,
+	Description: "An ECDSA or Ed25519 signature.",
+	Validators:  SignatureValidators,
 }
 
 var OptionalIDField = forms.Field{
@@ -286,6 +321,18 @@ var TimestampField = forms.Field{
 	},
 }
 
+// clients can retry write requests with the same idempotency key without
+// executing them twice, the server then returns the original response
+var IdempotencyKeyField = forms.Field{
+	Name:        "idempotencyKey",
+	Global:      true,
+	Description: "An optional client-chosen key (e.g. a UUID) that makes retries of the request safe.",
+	Validators: []forms.Validator{
+		forms.IsOptional{},
+		forms.MatchesRegex{Regexp: regexp.MustCompile(`^[\w\-]{1,128}$`)},
+	},
+}
+
 var SignedDataFields = func(form *forms.Form) []forms.Field {
 	return []forms.Field{
 		forms.Field{
@@ -332,6 +379,7 @@ var ConfirmProviderDataForm = forms.Form{
 	Name: "confirmProviderData",
 	Fields: []forms.Field{
 		TimestampField,
+		IdempotencyKeyField,
 		{
 			Name:        "confirmedProviderData",
 			Description: "Confirmed provider data for review by the provider.",
@@ -436,6 +484,8 @@ var ProviderKeyDataForm = forms.Form{
 			Description: "Public encryption key of the provider.",
 			Validators:  PublicKeyValidators,
 		},
+		SigningTypeField,
+		EncryptionTypeField,
 		{
 			Name:        "queueData",
 			Description: "Public information of the provider.",
@@ -484,6 +534,34 @@ var ResetDBDataForm = forms.Form{
 	},
 }
 
+var GetEventsForm = forms.Form{
+	Name:   "getEvents",
+	Fields: SignedDataFields(&GetEventsDataForm),
+}
+
+var GetEventsDataForm = forms.Form{
+	Name: "getEventsData",
+	Fields: []forms.Field{
+		{
+			Name:        "cursor",
+			Description: "ID of the last event that was received, only newer events will be returned.",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: 0},
+				forms.IsInteger{HasMin: true, Min: 0},
+			},
+		},
+		{
+			Name:        "limit",
+			Description: "Maximum number of events to return.",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: 100},
+				forms.IsInteger{HasMin: true, Min: 1, HasMax: true, Max: 1000},
+			},
+		},
+		TimestampField,
+	},
+}
+
 var AddMediatorPublicKeysForm = forms.Form{
 	Name:   "addMediatorPublicKeys",
 	Fields: SignedDataFields(&AddMediatorPublicKeysDataForm),
@@ -502,6 +580,7 @@ var AddMediatorPublicKeysDataForm = forms.Form{
 			},
 		},
 		TimestampField,
+		IdempotencyKeyField,
 	},
 }
 
@@ -518,6 +597,8 @@ var MediatorKeyDataForm = forms.Form{
 			Description: "Public encryption key of the mediator.",
 			Validators:  PublicKeyValidators,
 		},
+		SigningTypeField,
+		EncryptionTypeField,
 	},
 }
 
@@ -532,6 +613,7 @@ var CodesDataForm = forms.Form{
 	Name: "codesData",
 	Fields: []forms.Field{
 		TimestampField,
+		IdempotencyKeyField,
 		{
 			Name:        "actor",
 			Description: "The actor for which to store signup codes.",
@@ -567,6 +649,7 @@ var DistancesDataForm = forms.Form{
 	Name: "distancesData",
 	Fields: []forms.Field{
 		TimestampField,
+		IdempotencyKeyField,
 		{
 			Name:        "type",
 			Description: "The type of distance information to store.",
@@ -743,6 +826,36 @@ var GetAppointmentsAggregatedForm = forms.Form{
 	},
 }
 
+var SubscribeAvailabilityForm = forms.Form{
+	Name: "subscribeAvailability",
+	Fields: []forms.Field{
+		{
+			Name:        "radius",
+			Description: "The radius around the given zip code for which to send updates.",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: 50},
+				forms.IsInteger{
+					HasMin:  true,
+					HasMax:  true,
+					Min:     5,
+					Max:     80,
+					Convert: true,
+				},
+			},
+		},
+		{
+			Name:        "zipCode",
+			Description: "The zip code to use as the user location.",
+			Validators: []forms.Validator{
+				forms.IsString{
+					MaxLength: 5,
+					MinLength: 5,
+				},
+			},
+		},
+	},
+}
+
 var GetAppointmentsByZipCodeForm = forms.Form{
 	Name: "getAppointmentsByZipCode",
 	Fields: []forms.Field{
@@ -849,6 +962,18 @@ var GetProviderAppointmentsDataForm = forms.Form{
 	},
 }
 
+var StreamProviderAppointmentsForm = forms.Form{
+	Name:   "streamProviderAppointments",
+	Fields: SignedDataFields(&StreamProviderAppointmentsDataForm),
+}
+
+var StreamProviderAppointmentsDataForm = forms.Form{
+	Name: "streamProviderAppointmentsData",
+	Fields: []forms.Field{
+		TimestampField,
+	},
+}
+
 var GetProviderAppointmentsByPropertyForm = forms.Form{
 	Name:   "getProviderAppointmentsByProperty",
 	Fields: SignedDataFields(&GetProviderAppointmentsByPropertyDataForm),
@@ -884,6 +1009,23 @@ var PublishAppointmentsDataForm = forms.Form{
 	Name: "publishAppointmentsData",
 	Fields: []forms.Field{
 		TimestampField,
+		IdempotencyKeyField,
+		{
+			Name:        "atomic",
+			Description: "Whether to publish either all or none of the appointments.",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: false},
+				forms.IsBoolean{},
+			},
+		},
+		{
+			Name:        "force",
+			Description: "Whether to remove slots that have been booked.",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: false},
+				forms.IsBoolean{},
+			},
+		},
 		{
 			Name:        "appointments",
 			Description: "The appointments to publish.",
@@ -1057,6 +1199,7 @@ var BookAppointmentDataForm = forms.Form{
 		ProviderIDField,
 		IDField,
 		TimestampField,
+		IdempotencyKeyField,
 		{
 			Name:        "signedTokenData",
 			Description: "Signed token data of the user.",
@@ -1096,6 +1239,28 @@ var CancelAppointmentDataForm = forms.Form{
 	Fields: []forms.Field{
 		IDField,
 		ProviderIDField,
+		TimestampField,
+		IdempotencyKeyField,
+		{
+			Name:        "signedTokenData",
+			Description: "Signed token data of the user.",
+			Validators: []forms.Validator{
+				forms.IsStringMap{
+					Form: &SignedTokenDataForm,
+				},
+			},
+		},
+	},
+}
+
+var GetCancellationNoticesForm = forms.Form{
+	Name:   "getCancellationNotices",
+	Fields: SignedDataFields(&GetCancellationNoticesDataForm),
+}
+
+var GetCancellationNoticesDataForm = forms.Form{
+	Name: "getCancellationNoticesData",
+	Fields: []forms.Field{
 		TimestampField,
 		{
 			Name:        "signedTokenData",
@@ -1156,6 +1321,7 @@ var StoreProviderDataDataForm = forms.Form{
 	Name: "storeProviderDataData",
 	Fields: []forms.Field{
 		TimestampField,
+		IdempotencyKeyField,
 		{
 			Name:        "code",
 			Description: "Optional signup code.",
@@ -1283,6 +1449,30 @@ var GetStatsForm = forms.Form{
 				forms.IsInteger{HasMin: true, Min: 1, HasMax: true, Max: 500, Convert: true},
 			},
 		},
+		{
+			Name:        "groupBy",
+			Description: "Optional data dimension (e.g. 'zipCode') to group the statistics by.",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: ""},
+				forms.MatchesRegex{Regexp: regexp.MustCompile(`^[\w\d\-]{0,50}$`)},
+			},
+		},
+		{
+			Name:        "aggregate",
+			Description: "Optional aggregation of the statistics across all time windows.",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: ""},
+				forms.IsIn{Choices: []interface{}{"", "sum", "max"}},
+			},
+		},
+		{
+			Name:        "topN",
+			Description: "Only return the N largest values of each metric.",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsInteger{HasMin: true, Min: 1, HasMax: true, Max: 500, Convert: true},
+			},
+		},
 	},
 	Transforms: []forms.Transform{},
 	Validator:  UsageValidator,
@@ -41,5 +41,12 @@ var HTTPServerSettingsForm = forms.Form{
 				},
 			},
 		},
+		{
+			Name: "trusted_proxies",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: []interface{}{}},
+				forms.IsStringList{},
+			},
+		},
 	},
 }
@@ -87,6 +87,13 @@ var JSONRPCServerSettingsForm = forms.Form{
 				},
 			},
 		},
+		{
+			Name: "max_batch_size",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: 50},
+				forms.IsInteger{HasMin: true, Min: 1, HasMax: true, Max: 1000},
+			},
+		},
 	},
 }
 
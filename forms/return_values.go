@@ -40,6 +40,102 @@ var BookAppointmentRVV = []forms.Validator{
 	},
 }
 
+var PublishAppointmentsRVV = []forms.Validator{
+	forms.IsList{
+		Validators: []forms.Validator{
+			forms.IsStringMap{
+				Form: &PublishAppointmentResultForm,
+			},
+		},
+	},
+}
+
+var PublishAppointmentResultForm = forms.Form{
+	Name: "publishAppointmentResult",
+	Fields: []forms.Field{
+		IDField,
+		{
+			Name:        "status",
+			Description: "What happened to the appointment.",
+			Validators: []forms.Validator{
+				forms.IsIn{Choices: []interface{}{"created", "updated", "unchanged", "skipped", "error"}},
+			},
+		},
+		{
+			Name:        "error",
+			Description: "Error code of a failed appointment.",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsString{},
+			},
+		},
+		{
+			Name:        "reason",
+			Description: "Why the appointment failed.",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsString{},
+			},
+		},
+	},
+}
+
+var GetCancellationNoticesRVV = []forms.Validator{
+	forms.IsList{
+		Validators: []forms.Validator{
+			forms.IsStringMap{
+				Form: &CancellationNoticeForm,
+			},
+		},
+	},
+}
+
+var CancellationNoticeForm = forms.Form{
+	Name: "cancellationNotice",
+	Fields: []forms.Field{
+		ProviderIDField,
+		{
+			Name:        "appointmentID",
+			Description: "ID of the appointment that was booked.",
+			Validators: []forms.Validator{
+				ID,
+			},
+		},
+		{
+			Name:        "slotID",
+			Description: "ID of the slot that was booked.",
+			Validators: []forms.Validator{
+				ID,
+			},
+		},
+		{
+			Name:        "timestamp",
+			Description: "Time of the appointment.",
+			Validators: []forms.Validator{
+				forms.IsTime{
+					Format: "rfc3339",
+				},
+			},
+		},
+		{
+			Name:        "cancelledAt",
+			Description: "Time the booking was cancelled.",
+			Validators: []forms.Validator{
+				forms.IsTime{
+					Format: "rfc3339",
+				},
+			},
+		},
+		{
+			Name:        "reason",
+			Description: "Why the booking was cancelled.",
+			Validators: []forms.Validator{
+				forms.IsIn{Choices: []interface{}{"slotRemoved"}},
+			},
+		},
+	},
+}
+
 var GetProviderAppointmentsRVV = []forms.Validator{
 	forms.IsStringMap{
 		Form: &ProviderAppointmentsForm,
@@ -253,7 +349,7 @@ var KeyChainForm = forms.Form{
 }
 
 var AggregatedProviderAppointmentsForm = forms.Form{
-	Name: "providerAppointments",
+	Name: "aggregatedProviderAppointments",
 	Fields: []forms.Field{
 		{
 			Name:        "provider",
@@ -307,3 +403,70 @@ var ProviderAppointmentsForm = forms.Form{
 	},
 }
 
+
+var GetEventsRVV = []forms.Validator{
+	forms.IsStringMap{
+		Form: &EventsFeedForm,
+	},
+}
+
+var EventsFeedForm = forms.Form{
+	Name: "eventsFeed",
+	Fields: []forms.Field{
+		{
+			Name:        "events",
+			Description: "The events, ordered by ID.",
+			Validators: []forms.Validator{
+				forms.IsList{
+					Validators: []forms.Validator{
+						forms.IsStringMap{
+							Form: &OutboxEventForm,
+						},
+					},
+				},
+			},
+		},
+		{
+			Name:        "cursor",
+			Description: "Cursor to pass in the next request.",
+			Validators: []forms.Validator{
+				forms.IsInteger{HasMin: true, Min: 0},
+			},
+		},
+	},
+}
+
+var OutboxEventForm = forms.Form{
+	Name: "outboxEvent",
+	Fields: []forms.Field{
+		{
+			Name:        "id",
+			Description: "Sequential ID of the event.",
+			Validators: []forms.Validator{
+				forms.IsInteger{HasMin: true, Min: 1},
+			},
+		},
+		{
+			Name:        "type",
+			Description: "Type of the event.",
+			Validators: []forms.Validator{
+				forms.IsString{},
+			},
+		},
+		{
+			Name:        "timestamp",
+			Description: "Time at which the event occurred.",
+			Validators: []forms.Validator{
+				forms.IsTime{Format: "rfc3339"},
+			},
+		},
+		{
+			Name:        "data",
+			Description: "Non-personal data associated with the event.",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsStringMap{},
+			},
+		},
+	},
+}
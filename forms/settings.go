@@ -20,6 +20,7 @@ package forms
 
 import (
 	"github.com/kiprotect/go-helpers/forms"
+	"regexp"
 )
 
 var AdminForm = forms.Form{
@@ -129,6 +130,94 @@ var MeterForm = forms.Form{
 				AreValidMeterSettings{},
 			},
 		},
+		{
+			Name: "retention",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsStringMap{
+					Form: &RetentionForm,
+				},
+			},
+		},
+		{
+			Name: "approximate",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsStringList{},
+			},
+		},
+	},
+}
+
+var TimeWindowTypes = []interface{}{"minute", "quarterHour", "hour", "day", "week", "month"}
+
+var RetentionForm = forms.Form{
+	Name: "retention",
+	Fields: []forms.Field{
+		{
+			Name: "policies",
+			Validators: []forms.Validator{
+				forms.IsList{
+					Validators: []forms.Validator{
+						forms.IsStringMap{
+							Form: &RetentionPolicyForm,
+						},
+					},
+				},
+			},
+		},
+		{
+			Name: "gauges",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: []interface{}{"open", "booked"}},
+				forms.IsStringList{},
+			},
+		},
+		{
+			Name: "unique",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: []interface{}{"active"}},
+				forms.IsStringList{},
+			},
+		},
+		{
+			Name: "interval",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: 3600},
+				forms.IsInteger{
+					HasMin: true,
+					Min:    60,
+				},
+			},
+		},
+	},
+}
+
+var RetentionPolicyForm = forms.Form{
+	Name: "retentionPolicy",
+	Fields: []forms.Field{
+		{
+			Name: "type",
+			Validators: []forms.Validator{
+				forms.IsIn{Choices: TimeWindowTypes},
+			},
+		},
+		{
+			Name: "days",
+			Validators: []forms.Validator{
+				forms.IsInteger{
+					HasMin: true,
+					Min:    1,
+				},
+			},
+		},
+		{
+			Name: "rollup_to",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: ""},
+				forms.IsIn{Choices: append([]interface{}{""}, TimeWindowTypes...)},
+			},
+		},
 	},
 }
 
@@ -254,13 +343,39 @@ var ECDSAParamsForm = forms.Form{
 	},
 }
 
+var Ed25519ParamsForm = forms.Form{
+	Name: "ed25519Params",
+	Fields: []forms.Field{
+		{
+			Name: "curve",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: "ed25519"},
+				forms.IsIn{Choices: []interface{}{"ed25519"}},
+			},
+		},
+	},
+}
+
+var X25519ParamsForm = forms.Form{
+	Name: "x25519Params",
+	Fields: []forms.Field{
+		{
+			Name: "curve",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: "x25519"},
+				forms.IsIn{Choices: []interface{}{"x25519"}},
+			},
+		},
+	},
+}
+
 var KeyForm = forms.Form{
 	Name: "key",
 	Fields: []forms.Field{
 		{
 			Name: "type",
 			Validators: []forms.Validator{
-				forms.IsIn{Choices: []interface{}{"ecdsa", "ecdh"}}, // we only support ECDSA & ECDH for now
+				forms.IsIn{Choices: []interface{}{"ecdsa", "ecdh", "ed25519", "x25519"}}, // P-256 or Curve25519 keys
 			},
 		},
 		{
@@ -314,6 +429,16 @@ var KeyForm = forms.Form{
 								Form: &ECDSAParamsForm,
 							},
 						},
+						"ed25519": []forms.Validator{
+							forms.IsStringMap{
+								Form: &Ed25519ParamsForm,
+							},
+						},
+						"x25519": []forms.Validator{
+							forms.IsStringMap{
+								Form: &X25519ParamsForm,
+							},
+						},
 					},
 				},
 			},
@@ -502,6 +627,19 @@ var AppointmentsForm = forms.Form{
 				},
 			},
 		},
+		// how long we remember responses to requests with an idempotency key
+		{
+			Name: "idempotency_ttl_hours",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: 24},
+				forms.IsInteger{
+					HasMin: true,
+					Min:    1,
+					HasMax: true,
+					Max:    24 * 7,
+				},
+			},
+		},
 		{
 			Name: "secret",
 			Validators: []forms.Validator{
@@ -539,6 +677,288 @@ var AppointmentsForm = forms.Form{
 				},
 			},
 		},
+		{
+			Name: "signer",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsStringMap{
+					Form: &RemoteSignerForm,
+				},
+			},
+		},
+		{
+			Name: "stats_privacy",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsStringMap{
+					Form: &StatsPrivacyForm,
+				},
+			},
+		},
+		{
+			Name: "webhooks",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsStringMap{
+					Form: &WebhooksForm,
+				},
+			},
+		},
+	},
+}
+
+var WebhooksForm = forms.Form{
+	Name: "webhooks",
+	Fields: []forms.Field{
+		{
+			Name: "batch_size",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: 100},
+				forms.IsInteger{HasMin: true, Min: 1, HasMax: true, Max: 1000},
+			},
+		},
+		{
+			Name: "max_attempts",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: 8},
+				forms.IsInteger{HasMin: true, Min: 1},
+			},
+		},
+		{
+			Name: "backoff",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: 1000},
+				forms.IsInteger{HasMin: true, Min: 1},
+			},
+		},
+		{
+			Name: "max_backoff",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: 300000},
+				forms.IsInteger{HasMin: true, Min: 1},
+			},
+		},
+		{
+			Name: "interval",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: 5000},
+				forms.IsInteger{HasMin: true, Min: 10},
+			},
+		},
+		{
+			Name: "timeout",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: 10000},
+				forms.IsInteger{HasMin: true, Min: 1},
+			},
+		},
+		{
+			Name: "subscribers",
+			Validators: []forms.Validator{
+				forms.IsList{
+					Validators: []forms.Validator{
+						forms.IsStringMap{
+							Form: &WebhookSubscriberForm,
+						},
+					},
+				},
+			},
+		},
+	},
+}
+
+var WebhookSubscriberForm = forms.Form{
+	Name: "webhookSubscriber",
+	Fields: []forms.Field{
+		{
+			Name: "name",
+			Validators: []forms.Validator{
+				forms.MatchesRegex{Regexp: regexp.MustCompile(`^[\w\d\-]{1,50}$`)},
+			},
+		},
+		{
+			Name: "url",
+			Validators: []forms.Validator{
+				forms.MatchesRegex{Regexp: regexp.MustCompile(`^https?://`)},
+			},
+		},
+		{
+			Name: "events",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsStringList{},
+			},
+		},
+		{
+			Name: "secret",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsBytes{
+					Encoding:  "base64",
+					MinLength: 16,
+					MaxLength: 64,
+				},
+			},
+		},
+		{
+			Name: "key",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsString{},
+			},
+		},
+	},
+}
+
+var StatsPrivacyForm = forms.Form{
+	Name: "statsPrivacy",
+	Fields: []forms.Field{
+		{
+			Name: "epsilon",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: 0.5},
+				forms.IsFloat{
+					HasMin: true,
+					Min:    0.001,
+				},
+			},
+		},
+		{
+			Name: "budget",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: 10.0},
+				forms.IsFloat{
+					HasMin: true,
+					Min:    0.001,
+				},
+			},
+		},
+		{
+			Name: "budget_period",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: 86400},
+				forms.IsInteger{
+					HasMin: true,
+					Min:    1,
+				},
+			},
+		},
+		{
+			Name: "min_count",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: 5},
+				forms.IsInteger{
+					HasMin: true,
+					Min:    0,
+				},
+			},
+		},
+		{
+			Name: "metrics",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: []interface{}{}},
+				forms.IsList{
+					Validators: []forms.Validator{
+						forms.IsStringMap{
+							Form: &MetricPrivacyForm,
+						},
+					},
+				},
+			},
+		},
+		{
+			Name: "rate_limit",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsStringMap{
+					Form: &PrivacyRateLimitForm,
+				},
+			},
+		},
+	},
+}
+
+var PrivacyRateLimitForm = forms.Form{
+	Name: "privacyRateLimit",
+	Fields: []forms.Field{
+		{
+			Name: "type",
+			Validators: []forms.Validator{
+				forms.IsIn{Choices: []interface{}{"minute", "hour", "day"}},
+			},
+		},
+		{
+			Name: "limit",
+			Validators: []forms.Validator{
+				forms.IsInteger{HasMin: true, Min: 1},
+			},
+		},
+	},
+}
+
+var MetricPrivacyForm = forms.Form{
+	Name: "metricPrivacy",
+	Fields: []forms.Field{
+		{
+			Name: "name",
+			Validators: []forms.Validator{
+				forms.IsString{MinLength: 1},
+			},
+		},
+		{
+			// by how much a single user can change the value of the metric
+			Name: "sensitivity",
+			Validators: []forms.Validator{
+				forms.IsOptional{Default: 1.0},
+				forms.IsFloat{
+					HasMin: true,
+					Min:    0.001,
+				},
+			},
+		},
+	},
+}
+
+var SignerForm = forms.Form{
+	Name: "signer",
+	Fields: []forms.Field{
+		{
+			Name: "socket",
+			Validators: []forms.Validator{
+				forms.IsString{MinLength: 1},
+			},
+		},
+		{
+			Name: "keys",
+			Validators: []forms.Validator{
+				forms.IsList{
+					Validators: []forms.Validator{
+						forms.IsStringMap{
+							Form: &KeyForm,
+						},
+					},
+				},
+			},
+		},
+	},
+}
+
+var RemoteSignerForm = forms.Form{
+	Name: "remoteSigner",
+	Fields: []forms.Field{
+		{
+			Name: "socket",
+			Validators: []forms.Validator{
+				forms.IsString{MinLength: 1},
+			},
+		},
+		{
+			// names of the keys that should be signed by the daemon
+			Name: "keys",
+			Validators: []forms.Validator{
+				forms.IsStringList{},
+			},
+		},
 	},
 }
 
@@ -624,5 +1044,14 @@ var SettingsForm = forms.Form{
 				},
 			},
 		},
+		{
+			Name: "signer",
+			Validators: []forms.Validator{
+				forms.IsOptional{},
+				forms.IsStringMap{
+					Form: &SignerForm,
+				},
+			},
+		},
 	},
 }
@@ -28,6 +28,8 @@ import (
 	"github.com/kiprotect/go-helpers/forms"
 	"io"
 	"net/http"
+	"strconv"
+	"sync/atomic"
 	"time"
 )
 
@@ -122,6 +124,10 @@ func MakeAPIClient(url string, client *http.Client) Requester {
 	}
 }
 
+// the ID of the last request, like the API client we send an ID with every
+// request, as calls without an ID are notifications in JSON-RPC 2.0
+var requestID int64
+
 func Request(url, method string, params interface{}, key *crypto.Key, client *http.Client) (*Response, error) {
 
 	if params == nil {
@@ -150,6 +156,7 @@ func Request(url, method string, params interface{}, key *crypto.Key, client *ht
 		"method":  method,
 		"jsonrpc": "2.0",
 		"params":  params,
+		"id":      strconv.FormatInt(atomic.AddInt64(&requestID, 1), 10),
 	}
 
 	jsonData, err := json.Marshal(jsonrpcRequest)
@@ -327,16 +334,31 @@ func (a *AppointmentsClient) PublishAppointments(params *services.PublishAppoint
 	return a.requester("publishAppointments", params, provider.Actor.SigningKey)
 }
 
-func (a *AppointmentsClient) BookAppointment(params interface{}) (*Response, error) {
-	return nil, nil
+func (a *AppointmentsClient) PublishAppointmentsV2(params *services.PublishAppointmentsParams, provider *Provider) (*Response, error) {
+	return a.requester("publishAppointments.v2", params, provider.Actor.SigningKey)
+}
+
+type User struct {
+	Actor           *crypto.Actor
+	SignedTokenData *services.SignedTokenData
+}
+
+func (a *AppointmentsClient) BookAppointment(params *services.BookAppointmentParams, user *User) (*Response, error) {
+	params.SignedTokenData = user.SignedTokenData
+	return a.requester("bookAppointment", params, user.Actor.SigningKey)
 }
 
 func (a *AppointmentsClient) CancelAppointment(params interface{}) (*Response, error) {
 	return nil, nil
 }
 
-func (a *AppointmentsClient) GetToken(params interface{}) (*Response, error) {
-	return nil, nil
+func (a *AppointmentsClient) GetToken(params *services.GetTokenParams) (*Response, error) {
+	return a.requester("getToken", params, nil)
+}
+
+func (a *AppointmentsClient) GetCancellationNotices(params *services.GetCancellationNoticesParams, user *User) (*Response, error) {
+	params.SignedTokenData = user.SignedTokenData
+	return a.requester("getCancellationNotices", params, user.Actor.SigningKey)
 }
 
 type ConfirmProviderData struct {
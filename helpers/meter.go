@@ -27,5 +27,15 @@ func InitializeMeter(settings *services.Settings) (services.Meter, error) {
 		return nil, nil
 	}
 	definition := settings.Definitions.MeterDefinitions[settings.Meter.Type]
-	return definition.Maker(settings.Meter.Settings)
+	meter, err := definition.Maker(settings.Meter.Settings)
+	if err != nil {
+		return nil, err
+	}
+	if retentionMeter, ok := meter.(services.RetentionMeter); ok && settings.Meter.Retention != nil {
+		retentionMeter.SetRetention(settings.Meter.Retention.Policies)
+	}
+	if approximateMeter, ok := meter.(services.ApproximateMeter); ok && settings.Meter.Approximate != nil {
+		approximateMeter.SetApproximate(settings.Meter.Approximate)
+	}
+	return meter, nil
 }
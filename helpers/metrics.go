@@ -32,6 +32,9 @@ func InitializeMetricsServer(settings *services.Settings) (*metrics.PrometheusMe
 	if prometheusMetricsServer, err := metrics.MakePrometheusMetricsServer(settings.Metrics.BindAddress); err != nil {
 		return nil, err
 	} else {
+		if settings.MeterObj != nil {
+			prometheusMetricsServer.AddCollector(metrics.MakeStatsCollector(settings.MeterObj, "day"))
+		}
 		return prometheusMetricsServer, nil
 	}
 
@@ -34,6 +34,20 @@ import (
 )
 
 var EnvSettingsName = "KIEBITZ_SETTINGS"
+var EnvPlaintextSettingsName = "KIEBITZ_PLAINTEXT_SETTINGS"
+
+// Returns the glob patterns of settings files that may be unencrypted
+// (e.g. "001_default.json:003_*.json", or "*" to allow all).
+func PlaintextSettingsPatterns() []string {
+	envValue := os.Getenv(EnvPlaintextSettingsName)
+	patterns := make([]string, 0)
+	for _, value := range strings.Split(envValue, ":") {
+		if value != "" {
+			patterns = append(patterns, value)
+		}
+	}
+	return patterns
+}
 
 func SettingsPaths() ([]string, fs.FS, error) {
 	if paths, err := RealSettingsPaths(); err != nil {
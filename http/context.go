@@ -21,7 +21,10 @@ package http
 import (
 	"encoding/json"
 	"github.com/impfen/services-inoeg"
+	"io"
+	"net"
 	"net/http"
+	"strings"
 )
 
 type Context struct {
@@ -32,6 +35,7 @@ type Context struct {
 	currentHandler int
 	Aborted        bool
 	HeaderWritten  bool
+	TrustedProxies []string
 	values         map[string]interface{}
 }
 
@@ -43,6 +47,48 @@ func MakeContext(writer http.ResponseWriter, request *http.Request) *Context {
 	}
 }
 
+// Returns the IP address of the client. If the request comes from a trusted
+// proxy we use the last address in the X-Forwarded-For header that does not
+// belong to a trusted proxy, as earlier entries can be forged by the client.
+func (c *Context) RemoteAddress() string {
+	address := c.Request.RemoteAddr
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		address = host
+	}
+	if !c.isTrustedProxy(address) {
+		return address
+	}
+	forwardedFor := strings.Split(strings.Join(c.Request.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwardedFor) - 1; i >= 0; i-- {
+		forwardedAddress := strings.TrimSpace(forwardedFor[i])
+		if forwardedAddress == "" {
+			continue
+		}
+		address = forwardedAddress
+		if !c.isTrustedProxy(address) {
+			break
+		}
+	}
+	return address
+}
+
+func (c *Context) isTrustedProxy(address string) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+	for _, proxy := range c.TrustedProxies {
+		if _, network, err := net.ParseCIDR(proxy); err == nil {
+			if network.Contains(ip) {
+				return true
+			}
+		} else if proxyIP := net.ParseIP(proxy); proxyIP != nil && proxyIP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
 func (c *Context) Set(key string, value interface{}) {
 	c.values[key] = value
 }
@@ -92,3 +138,61 @@ func (c *Context) JSON(status int, data interface{}) {
 	c.Abort()
 
 }
+
+func (c *Context) Data(status int, contentType string, data []byte) {
+
+	if c.HeaderWritten {
+		// the header was already written, we ignore this...
+		services.Log.Error("Header was already written")
+		return
+	}
+
+	c.Writer.Header().Set("Content-Type", contentType)
+	c.Writer.WriteHeader(status)
+	c.HeaderWritten = true
+
+	c.Writer.Write(data)
+
+	c.Abort()
+
+}
+
+type flushWriter struct {
+	writer io.Writer
+}
+
+// flushes every write so that streamed data reaches the client immediately
+func (f *flushWriter) Write(data []byte) (int, error) {
+	n, err := f.writer.Write(data)
+	if flusher, ok := f.writer.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return n, err
+}
+
+func (c *Context) Stream(status int, contentType string, stream func(done <-chan struct{}, writer io.Writer) error) {
+
+	if c.HeaderWritten {
+		// the header was already written, we ignore this...
+		services.Log.Error("Header was already written")
+		return
+	}
+
+	c.Writer.Header().Set("Content-Type", contentType)
+	c.Writer.Header().Set("Cache-Control", "no-cache")
+	// we disable response buffering in nginx
+	c.Writer.Header().Set("X-Accel-Buffering", "no")
+	c.Writer.WriteHeader(status)
+	c.HeaderWritten = true
+
+	writer := &flushWriter{writer: c.Writer}
+	// we make sure the header reaches the client before the first message
+	writer.Write(nil)
+
+	if err := stream(c.Request.Context().Done(), writer); err != nil {
+		services.Log.Error(err)
+	}
+
+	c.Abort()
+
+}
@@ -182,6 +182,7 @@ func (s *HTTPServer) ServeHTTP(writer http.ResponseWriter, request *http.Request
 	statusWriter := metrics.MakeStatusResponseWriter(writer)
 
 	context := MakeContext(statusWriter, request)
+	context.TrustedProxies = s.settings.TrustedProxies
 
 	for _, routeGroup := range s.routeGroups {
 		handleRouteGroup(context, routeGroup, []Handler{})
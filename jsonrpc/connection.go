@@ -0,0 +1,198 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package jsonrpc
+
+import (
+	"encoding/json"
+	"github.com/impfen/services-inoeg"
+	"github.com/impfen/services-inoeg/http"
+	"sync"
+	"time"
+)
+
+// interval of the pings that keep idle connections open through proxies
+var pingInterval = 30 * time.Second
+
+// A notification is a request without an ID, the client does not respond
+type Notification struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+}
+
+// A persistent JSON-RPC connection over a WebSocket
+type Connection struct {
+	webSocket     *WebSocket
+	mutex         sync.Mutex
+	closeHandlers []func()
+	closed        bool
+	done          chan bool
+}
+
+func MakeConnection(webSocket *WebSocket) *Connection {
+	return &Connection{
+		webSocket: webSocket,
+		done:      make(chan bool),
+	}
+}
+
+func (c *Connection) write(data interface{}) error {
+	if bytes, err := json.Marshal(data); err != nil {
+		return err
+	} else {
+		return c.webSocket.WriteMessage(TextFrame, bytes)
+	}
+}
+
+func (c *Connection) Notify(method string, params interface{}) error {
+	return c.write(&Notification{
+		JSONRPC: "2.0",
+		Method:  method,
+		Params:  params,
+	})
+}
+
+func (c *Connection) OnClose(handler func()) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.closed {
+		// the connection is already closed, we call the handler right away
+		defer handler()
+		return
+	}
+	c.closeHandlers = append(c.closeHandlers, handler)
+}
+
+func (c *Connection) Close() error {
+	c.mutex.Lock()
+	if c.closed {
+		c.mutex.Unlock()
+		return nil
+	}
+	c.closed = true
+	handlers := c.closeHandlers
+	c.closeHandlers = nil
+	close(c.done)
+	c.mutex.Unlock()
+
+	for _, handler := range handlers {
+		handler()
+	}
+
+	return c.webSocket.Close()
+}
+
+func (c *Connection) keepAlive() {
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.webSocket.Ping(); err != nil {
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// Returns the response to a single request or a batch, or nil if there is
+// nothing to respond (i.e. for notifications)
+func (s *JSONRPCServer) handleMessage(connection *Connection, handler Handler, data []byte, remoteAddr string) interface{} {
+
+	var jsonData interface{}
+
+	if err := json.Unmarshal(data, &jsonData); err != nil {
+		return &Response{JSONRPC: "2.0", Error: &Error{Code: -32700, Message: "JSON required"}}
+	}
+
+	switch v := jsonData.(type) {
+	case []interface{}:
+		if responses, errorResponse := s.callBatch(handler, v, connection, remoteAddr); errorResponse != nil {
+			return errorResponse
+		} else if len(responses) > 0 {
+			return responses
+		}
+	case map[string]interface{}:
+		if request, _, response := ParseRequest(v); response != nil {
+			return response
+		} else if response := s.call(handler, request, connection, remoteAddr); !request.Notification {
+			return response
+		}
+	default:
+		return &Response{JSONRPC: "2.0", Error: &Error{Code: -32700, Message: "JSON required"}}
+	}
+
+	return nil
+}
+
+// Accepts JSON-RPC requests over a WebSocket. Requests are processed in the
+// order in which they arrive, and handlers can send notifications to the
+// client for as long as the connection is open.
+func (s *JSONRPCServer) WebSocket(handler Handler) http.Handler {
+
+	return func(c *http.Context) {
+
+		webSocket, err := UpgradeWebSocket(c.Writer, c.Request)
+
+		if err != nil {
+			c.JSON(400, Response{JSONRPC: "2.0", Error: &Error{Code: -1, Message: err.Error()}})
+			return
+		}
+
+		// the connection has been hijacked, so we must not write to it anymore
+		c.HeaderWritten = true
+		c.Abort()
+
+		connection := MakeConnection(webSocket)
+		remoteAddr := c.RemoteAddress()
+
+		s.mutex.Lock()
+		s.connections[connection] = true
+		s.mutex.Unlock()
+
+		defer func() {
+			s.mutex.Lock()
+			delete(s.connections, connection)
+			s.mutex.Unlock()
+			connection.Close()
+		}()
+
+		go connection.keepAlive()
+
+		for {
+
+			_, data, err := webSocket.ReadMessage()
+
+			if err != nil {
+				if err != ErrWebSocketClosed {
+					services.Log.Debugf("Closing websocket: %v", err)
+				}
+				return
+			}
+
+			if response := s.handleMessage(connection, handler, data, remoteAddr); response != nil {
+				if err := connection.write(response); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
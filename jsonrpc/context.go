@@ -31,6 +31,35 @@ var idNRegexp = regexp.MustCompile(`^(n+):(-?\d{1,32})$`)
 
 type Context struct {
 	Request *Request
+	// only defined for requests over persistent connections
+	Connection *Connection
+	// IP address of the client
+	RemoteAddr string
+}
+
+var _ services.RemoteContext = &Context{}
+
+func (c *Context) RemoteAddress() string {
+	return c.RemoteAddr
+}
+
+// The context of a request over a persistent connection
+type ConnectionContext struct {
+	*Context
+}
+
+var _ services.NotifyingContext = &ConnectionContext{}
+
+func (c *ConnectionContext) Notify(method string, params interface{}) error {
+	return c.Connection.Notify(method, params)
+}
+
+func (c *ConnectionContext) OnClose(handler func()) {
+	c.Connection.OnClose(handler)
+}
+
+func (c *ConnectionContext) ConnectionKey() interface{} {
+	return c.Connection
 }
 
 func convertID(id interface{}) interface{} {
@@ -75,12 +104,26 @@ func (c *Context) Error(code int, message string, data interface{}) services.Res
 	}
 }
 
+func (c *Context) Fail(err *services.APIError, details interface{}) services.Response {
+	return &Response{
+		Error: &Error{
+			Code:    err.JSONRPCCode(),
+			Message: err.Message,
+			Data:    err.Data(details),
+		},
+		JSONRPC: "2.0",
+		ID:      convertID(c.Request.ID),
+		Headers: err.Headers(),
+		Status:  err.Status,
+	}
+}
+
 func (c *Context) Params() map[string]interface{} {
 	return c.Request.Params
 }
 
 func (c *Context) NotFound() services.Response {
-	return c.Error(404, "not found", nil)
+	return c.Fail(services.ErrNotFound, nil)
 }
 
 func (c *Context) Acknowledge() services.Response {
@@ -92,15 +135,15 @@ func (c *Context) Nil() services.Response {
 }
 
 func (c *Context) MethodNotFound() services.Response {
-	return c.Error(-32601, "method not found", nil)
+	return c.Fail(services.ErrMethodNotFound, nil)
 }
 
 func (c *Context) InvalidParams(err error) services.Response {
-	return c.Error(-32602, "invalid params", err)
+	return c.Fail(services.ErrInvalidParams, err)
 }
 
 func (c *Context) InternalError() services.Response {
-	return c.Error(-32603, "internal error", nil)
+	return c.Fail(services.ErrInternal, nil)
 }
 
 func (c *Context) IsInternalError(resp services.Response) bool {
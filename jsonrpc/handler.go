@@ -27,6 +27,8 @@ import (
 type Method struct {
 	Form    *forms.Form
 	Handler interface{}
+	// headers that are added to all HTTP responses of the method
+	Headers map[string]string
 }
 
 func MethodsHandler(
@@ -47,7 +49,16 @@ func MethodsHandler(
 		if method, ok := methods[context.Request.Method]; !ok {
 			return context.MethodNotFound().(*Response)
 		} else {
-			return services.HandleAPICall(method.Handler, method.Form, validateSettings, context).(*Response)
+			var apiContext services.Context = context
+			if context.Connection != nil {
+				// handlers can send notifications over persistent connections
+				apiContext = &ConnectionContext{context}
+			}
+			response := services.HandleAPICall(method.Handler, method.Form, validateSettings, apiContext).(*Response)
+			if response != nil && method.Headers != nil {
+				response.Headers = services.MergeHeaders(response.Headers, method.Headers)
+			}
+			return response
 		}
 	}, nil
 }
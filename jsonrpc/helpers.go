@@ -38,10 +38,6 @@ func ExtractJSONRequest(c *http.Context) {
 	services.Log.Debugf("Extracting JSON data...")
 
 	invalidJSONResponse := Response{JSONRPC: "2.0,", Error: &Error{Code: -32700, Message: "JSON required"}}
-	invalidRequestResponse := func(err error) *Response {
-		return &Response{JSONRPC: "2.0,", Error: &Error{Code: -32600, Message: "invalid request", Data: err}}
-	}
-	serverErrorResponse := Response{JSONRPC: "2.0,", Error: &Error{Code: -32603, Message: "internal server error"}}
 
 	if c.Request.Method != "POST" {
 		c.JSON(405, Response{JSONRPC: "2.0", Error: &Error{Code: -1, Message: "method not allowed"}})
@@ -53,7 +49,7 @@ func ExtractJSONRequest(c *http.Context) {
 		return
 	}
 
-	var jsonData map[string]interface{}
+	var jsonData interface{}
 
 	decoder := json.NewDecoder(c.Request.Body)
 
@@ -62,20 +58,44 @@ func ExtractJSONRequest(c *http.Context) {
 		return
 	}
 
+	switch data := jsonData.(type) {
+	case []interface{}:
+		// batches are validated call by call by the server
+		c.Set("batch", data)
+	case map[string]interface{}:
+		if request, code, response := ParseRequest(data); response != nil {
+			c.JSON(code, response)
+		} else {
+			c.Set("request", request)
+		}
+	default:
+		c.JSON(400, invalidJSONResponse)
+	}
+
+}
+
+// validates the request data and converts it into a request, returns an
+// error response with the corresponding HTTP status code if this fails
+func ParseRequest(jsonData map[string]interface{}) (*Request, int, *Response) {
+
+	invalidRequestResponse := func(err error) *Response {
+		return &Response{JSONRPC: "2.0,", Error: &Error{Code: -32600, Message: "invalid request", Data: err}}
+	}
+	serverErrorResponse := &Response{JSONRPC: "2.0,", Error: &Error{Code: -32603, Message: "internal server error"}}
+
 	if validJSON, err := JSONRPCRequestForm.Validate(jsonData); err != nil {
 		// validation errors are safe to pass back to the client
-		c.JSON(400, invalidRequestResponse(err))
-		return
+		return nil, 400, invalidRequestResponse(err)
 	} else {
 		var request Request
 
 		id, ok := validJSON["id"]
 
-		// if no ID is contained we generate a random UUID
+		// if no ID is contained we generate a random UUID, which we only use
+		// internally as we do not respond to notifications
 		if !ok {
 			if randomID, err := crypto.RandomBytes(16); err != nil {
-				c.JSON(500, serverErrorResponse)
-				return
+				return nil, 500, serverErrorResponse
 			} else {
 				validJSON["id"] = hex.EncodeToString(randomID)
 			}
@@ -95,11 +115,12 @@ func ExtractJSONRequest(c *http.Context) {
 		// this should never happen if the form validation is correct...
 		if err := JSONRPCRequestForm.Coerce(&request, validJSON); err != nil {
 			services.Log.Error(err)
-			c.JSON(500, serverErrorResponse)
-			return
+			return nil, 500, serverErrorResponse
 		}
 
-		c.Set("request", &request)
+		request.Notification = !ok
+
+		return &request, 200, nil
 	}
 
 }
@@ -24,6 +24,7 @@ import (
 	"github.com/impfen/services-inoeg/http"
 	"github.com/prometheus/client_golang/prometheus"
 	"strconv"
+	"sync"
 	"time"
 )
 
@@ -32,49 +33,177 @@ type Handler func(*Context) *Response
 type JSONRPCServer struct {
 	metricsPrefix string
 	httpDurations *prometheus.HistogramVec
+	calls         *prometheus.CounterVec
+	batchSizes    prometheus.Histogram
 	settings      *services.JSONRPCServerSettings
 	server        *http.HTTPServer
 	ownServer     bool
 	handler       Handler
+	connections   map[*Connection]bool
+	mutex         sync.Mutex
 }
 
-func (s *JSONRPCServer) JSONRPC(handler Handler) http.Handler {
+// the maximum number of calls in a batch if no limit is configured
+const defaultMaxBatchSize = 50
 
-	return func(c *http.Context) {
+func (s *JSONRPCServer) maxBatchSize() int {
+	if s.settings == nil || s.settings.MaxBatchSize <= 0 {
+		return defaultMaxBatchSize
+	}
+	return int(s.settings.MaxBatchSize)
+}
 
-		startTime := time.Now()
+// Calls the handler with a single request and records the metrics
+func (s *JSONRPCServer) call(handler Handler, request *Request, connection *Connection, remoteAddr string) *Response {
 
-		// the request data has been validated by the 'ExtractJSONRequest' handler
-		request := c.Get("request").(*Request)
+	startTime := time.Now()
+
+	context := &Context{
+		Request:    request,
+		Connection: connection,
+		RemoteAddr: remoteAddr,
+	}
+
+	response := handler(context)
 
-		context := &Context{
-			Request: request,
+	if response == nil {
+		response = context.Nil().(*Response)
+	}
+
+	// people will forget this so we add it here in that case
+	if response.JSONRPC == "" {
+		response.JSONRPC = "2.0"
+	}
+
+	code := 200
+	outcome := "success"
+	method := request.Method
+
+	// if there was an error we return a 400 status instead of 200
+	if response.Error != nil {
+		code = 400
+		outcome = "error"
+		if response.Error.Code == -32601 {
+			// we do not want arbitrary method names in our metrics
+			method = "unknown"
 		}
+	}
+
+	elapsedTime := time.Since(startTime)
+	codeString := strconv.Itoa(code)
+
+	s.httpDurations.WithLabelValues(method, codeString).Observe(elapsedTime.Seconds())
+	s.calls.WithLabelValues(method, outcome).Inc()
+
+	return response
+}
 
-		response := handler(context)
+// Processes the calls of a batch in parallel. Returns the responses to all
+// calls that are not notifications in the order of the calls, or an error
+// response if the batch itself is invalid.
+func (s *JSONRPCServer) callBatch(handler Handler, batch []interface{}, connection *Connection, remoteAddr string) ([]*Response, *Response) {
 
-		if response == nil {
-			response = context.Nil().(*Response)
+	if len(batch) == 0 {
+		return nil, &Response{JSONRPC: "2.0", Error: &Error{Code: -32600, Message: "empty batch"}}
+	}
+
+	if len(batch) > s.maxBatchSize() {
+		return nil, &Response{JSONRPC: "2.0", Error: &Error{Code: -32600, Message: "batch too large", Data: map[string]interface{}{"maxBatchSize": s.maxBatchSize()}}}
+	}
+
+	s.batchSizes.Observe(float64(len(batch)))
+
+	responses := make([]*Response, len(batch))
+
+	var wg sync.WaitGroup
+
+	for i, entry := range batch {
+
+		data, ok := entry.(map[string]interface{})
+
+		if !ok {
+			responses[i] = &Response{JSONRPC: "2.0", Error: &Error{Code: -32600, Message: "invalid request"}}
+			continue
 		}
 
-		// people will forget this so we add it here in that case
-		if response.JSONRPC == "" {
-			response.JSONRPC = "2.0"
+		request, _, response := ParseRequest(data)
+
+		if response != nil {
+			responses[i] = response
+			continue
 		}
 
+		wg.Add(1)
+
+		go func(i int, request *Request) {
+			defer wg.Done()
+			response := s.call(handler, request, connection, remoteAddr)
+			if !request.Notification {
+				responses[i] = response
+			}
+		}(i, request)
+	}
+
+	wg.Wait()
+
+	results := make([]*Response, 0, len(responses))
+
+	for _, response := range responses {
+		if response != nil {
+			results = append(results, response)
+		}
+	}
+
+	return results, nil
+}
+
+func setHeaders(c *http.Context, response *Response) {
+	for key, value := range response.Headers {
+		c.Writer.Header().Set(key, value)
+	}
+}
+
+func (s *JSONRPCServer) JSONRPC(handler Handler) http.Handler {
+
+	return func(c *http.Context) {
+
+		// the request data has been validated by the 'ExtractJSONRequest' handler
+		if batch, ok := c.Get("batch").([]interface{}); ok {
+
+			// we do not set the headers of the individual calls (e.g.
+			// Retry-After), as they would apply to all calls of the batch,
+			// errors contain the relevant information in their data
+			responses, errorResponse := s.callBatch(handler, batch, nil, c.RemoteAddress())
+
+			if errorResponse != nil {
+				c.JSON(400, errorResponse)
+			} else if len(responses) == 0 {
+				// the batch only contained notifications
+				c.AbortWithStatus(204)
+			} else {
+				c.JSON(200, responses)
+			}
+
+			return
+		}
+
+		request := c.Get("request").(*Request)
+
+		// we respond to single calls without an ID as well, as existing
+		// clients do not always send one
+		response := s.call(handler, request, nil, c.RemoteAddress())
+
+		setHeaders(c, response)
+
 		code := 200
 
-		// if there was an error we return a 400 status instead of 200
-		if response.Error != nil {
+		if response.Status != 0 {
+			code = response.Status
+		} else if response.Error != nil {
 			code = 400
 		}
 
 		c.JSON(code, response)
-
-		elapsedTime := time.Since(startTime)
-		codeString := strconv.Itoa(code)
-
-		s.httpDurations.WithLabelValues(request.Method, codeString).Observe(elapsedTime.Seconds())
 	}
 }
 
@@ -83,6 +212,7 @@ func MakeJSONRPCServer(settings *services.JSONRPCServerSettings, handler Handler
 	server := &JSONRPCServer{
 		settings:      settings,
 		metricsPrefix: metricsPrefix,
+		connections:   make(map[*Connection]bool),
 	}
 
 	routeGroups := []*http.RouteGroup{
@@ -99,6 +229,12 @@ func MakeJSONRPCServer(settings *services.JSONRPCServerSettings, handler Handler
 						server.JSONRPC(handler),
 					},
 				},
+				{
+					Pattern: "^/jsonrpc/ws$",
+					Handlers: []http.Handler{
+						server.WebSocket(handler),
+					},
+				},
 			},
 		},
 	}
@@ -137,8 +273,26 @@ func (s *JSONRPCServer) Start() error {
 		[]string{"method", "code"},
 	)
 
-	if err := prometheus.Register(s.httpDurations); err != nil {
-		return fmt.Errorf("error registering collector for jsonRPC server (%s): %v", s.metricsPrefix, err)
+	s.calls = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: fmt.Sprintf("%s_%s", s.metricsPrefix, "rpc_calls_total"),
+			Help: "RPC calls by method and outcome",
+		},
+		[]string{"method", "outcome"},
+	)
+
+	s.batchSizes = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    fmt.Sprintf("%s_%s", s.metricsPrefix, "rpc_batch_size"),
+			Help:    "Number of calls per RPC batch",
+			Buckets: []float64{1, 2, 5, 10, 20, 50, 100},
+		},
+	)
+
+	for _, collector := range []prometheus.Collector{s.httpDurations, s.calls, s.batchSizes} {
+		if err := prometheus.Register(collector); err != nil {
+			return fmt.Errorf("error registering collector for jsonRPC server (%s): %v", s.metricsPrefix, err)
+		}
 	}
 
 	if !s.ownServer {
@@ -149,7 +303,17 @@ func (s *JSONRPCServer) Start() error {
 }
 
 func (s *JSONRPCServer) Stop() error {
+
+	// hijacked connections are not closed by the HTTP server
+	s.mutex.Lock()
+	for connection := range s.connections {
+		connection.Close()
+	}
+	s.mutex.Unlock()
+
 	prometheus.Unregister(s.httpDurations)
+	prometheus.Unregister(s.calls)
+	prometheus.Unregister(s.batchSizes)
 
 	if !s.ownServer {
 		return nil
@@ -0,0 +1,189 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package jsonrpc
+
+import (
+	"encoding/json"
+	"github.com/impfen/services-inoeg"
+	"github.com/impfen/services-inoeg/http"
+	"github.com/prometheus/client_golang/prometheus"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func makeTestServer(settings *services.JSONRPCServerSettings) *JSONRPCServer {
+	return &JSONRPCServer{
+		settings:    settings,
+		connections: make(map[*Connection]bool),
+		httpDurations: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{Name: "test_durations"},
+			[]string{"method", "code"},
+		),
+		calls: prometheus.NewCounterVec(
+			prometheus.CounterOpts{Name: "test_calls"},
+			[]string{"method", "outcome"},
+		),
+		batchSizes: prometheus.NewHistogram(
+			prometheus.HistogramOpts{Name: "test_batch_sizes"},
+		),
+	}
+}
+
+func post(server *JSONRPCServer, body string) *httptest.ResponseRecorder {
+	return postTo(server, func(context *Context) *Response {
+		return context.Result("ok").(*Response)
+	}, body)
+}
+
+func postTo(server *JSONRPCServer, methodHandler Handler, body string) *httptest.ResponseRecorder {
+
+	handler := server.JSONRPC(methodHandler)
+
+	request := httptest.NewRequest("POST", "/jsonrpc", strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	context := http.MakeContext(recorder, request)
+
+	if ExtractJSONRequest(context); !context.Aborted {
+		handler(context)
+	}
+
+	return recorder
+}
+
+func TestBatch(t *testing.T) {
+
+	server := makeTestServer(&services.JSONRPCServerSettings{MaxBatchSize: 3})
+
+	recorder := post(server, `[
+		{"jsonrpc": "2.0", "method": "a", "params": {}, "id": "1"},
+		{"jsonrpc": "2.0", "method": "b", "params": {}},
+		"invalid"
+	]`)
+
+	if recorder.Code != 200 {
+		t.Fatalf("expected status 200, got %d", recorder.Code)
+	}
+
+	var responses []map[string]interface{}
+
+	if err := json.Unmarshal(recorder.Body.Bytes(), &responses); err != nil {
+		t.Fatal(err)
+	}
+
+	// the notification does not receive a response
+	if len(responses) != 2 {
+		t.Fatalf("expected 2 responses, got %d", len(responses))
+	}
+
+	if responses[0]["result"] != "ok" || responses[1]["error"] == nil {
+		t.Fatalf("unexpected responses: %v", responses)
+	}
+}
+
+func TestBatchLimits(t *testing.T) {
+
+	server := makeTestServer(&services.JSONRPCServerSettings{MaxBatchSize: 1})
+
+	if recorder := post(server, `[]`); recorder.Code != 400 {
+		t.Fatalf("expected status 400 for an empty batch, got %d", recorder.Code)
+	}
+
+	call := `{"jsonrpc": "2.0", "method": "a", "params": {}, "id": "1"}`
+
+	if recorder := post(server, "["+call+", "+call+"]"); recorder.Code != 400 {
+		t.Fatalf("expected status 400 for a large batch, got %d", recorder.Code)
+	}
+}
+
+func TestNotification(t *testing.T) {
+
+	server := makeTestServer(nil)
+
+	// single calls without an ID still receive a response
+	if recorder := post(server, `{"jsonrpc": "2.0", "method": "a", "params": {}}`); recorder.Code != 200 || recorder.Body.Len() == 0 {
+		t.Fatalf("expected a response, got %d", recorder.Code)
+	}
+
+	if recorder := post(server, `[{"jsonrpc": "2.0", "method": "a", "params": {}}]`); recorder.Code != 204 {
+		t.Fatalf("expected an empty response, got %d", recorder.Code)
+	}
+}
+
+func TestCatalogError(t *testing.T) {
+
+	server := makeTestServer(nil)
+
+	recorder := postTo(server, func(context *Context) *Response {
+		return context.Fail(services.ErrLockTimeout, nil).(*Response)
+	}, `{"jsonrpc": "2.0", "method": "a", "params": {}, "id": "1"}`)
+
+	// the status of the error is used instead of 400
+	if recorder.Code != 503 {
+		t.Fatalf("expected status 503, got %d", recorder.Code)
+	}
+
+	if retryAfter := recorder.Header().Get("Retry-After"); retryAfter != "1" {
+		t.Fatalf("expected a Retry-After header, got '%s'", retryAfter)
+	}
+
+	response := struct {
+		Error struct {
+			Code int                 `json:"code"`
+			Data *services.ErrorData `json:"data"`
+		} `json:"error"`
+	}{}
+
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+
+	if response.Error.Code != 503 || response.Error.Data == nil {
+		t.Fatalf("unexpected error: %s", recorder.Body.String())
+	}
+
+	if data := response.Error.Data; data.Code != "lock_timeout" || data.RetryAfter != 1 || data.ServerTime.IsZero() {
+		t.Fatalf("unexpected error data: %v", data)
+	}
+}
+
+func TestBatchHeaders(t *testing.T) {
+
+	server := makeTestServer(nil)
+
+	recorder := postTo(server, func(context *Context) *Response {
+		if context.Request.Method == "a" {
+			return context.Fail(services.ErrLockTimeout, nil).(*Response)
+		}
+		return context.Result("ok").(*Response)
+	}, `[
+		{"jsonrpc": "2.0", "method": "a", "params": {}, "id": "1"},
+		{"jsonrpc": "2.0", "method": "b", "params": {}, "id": "2"}
+	]`)
+
+	if recorder.Code != 200 {
+		t.Fatalf("expected status 200, got %d", recorder.Code)
+	}
+
+	// the headers of a single call do not apply to the whole batch
+	if retryAfter := recorder.Header().Get("Retry-After"); retryAfter != "" {
+		t.Fatalf("expected no Retry-After header, got '%s'", retryAfter)
+	}
+}
@@ -27,6 +27,8 @@ type Request struct {
 	Method  string                 `json:"method"`
 	Params  map[string]interface{} `json:"params"`
 	ID      string                 `json:"id"`
+	// notifications are requests without an ID, we do not respond to them
+	Notification bool `json:"-"`
 }
 
 func MakeRequest(method, id string, params map[string]interface{}) *Request {
@@ -43,6 +45,10 @@ type Response struct {
 	Result  interface{} `json:"result,omitempty"`
 	Error   *Error      `json:"error,omitempty"`
 	ID      interface{} `json:"id"`
+	// additional HTTP headers of the response
+	Headers map[string]string `json:"-"`
+	// the HTTP status of error responses (400 if not set)
+	Status int `json:"-"`
 }
 
 func (r *Response) AsJSON() string {
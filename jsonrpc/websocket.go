@@ -0,0 +1,302 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package jsonrpc
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A minimal implementation of the WebSocket protocol (RFC 6455) for the
+// server side, supporting text and binary messages as well as ping, pong and
+// close frames. Extensions and subprotocols are not supported.
+
+const (
+	continuationFrame = 0x0
+	TextFrame         = 0x1
+	BinaryFrame       = 0x2
+	closeFrame        = 0x8
+	pingFrame         = 0x9
+	pongFrame         = 0xa
+)
+
+// the magic value from the RFC that is used to compute the accept key
+const webSocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// the maximum size of a (possibly fragmented) message
+const maxWebSocketMessageSize = 1024 * 1024
+
+// how long we wait for a frame to be written before we give up on the
+// client, so that clients which stop reading do not block writers forever
+const webSocketWriteTimeout = 10 * time.Second
+
+var ErrWebSocketClosed = fmt.Errorf("websocket closed")
+
+type WebSocket struct {
+	conn         net.Conn
+	reader       *bufio.Reader
+	mutex        sync.Mutex
+	closed       bool
+	writeTimeout time.Duration
+}
+
+func webSocketAccept(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + webSocketGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+func headerContains(header http.Header, name, value string) bool {
+	for _, v := range header.Values(name) {
+		for _, token := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Performs the WebSocket handshake and takes over the connection
+func UpgradeWebSocket(writer http.ResponseWriter, request *http.Request) (*WebSocket, error) {
+
+	if request.Method != "GET" {
+		return nil, fmt.Errorf("method not allowed")
+	}
+
+	if !headerContains(request.Header, "Connection", "upgrade") || !headerContains(request.Header, "Upgrade", "websocket") {
+		return nil, fmt.Errorf("not a websocket handshake")
+	}
+
+	if request.Header.Get("Sec-WebSocket-Version") != "13" {
+		return nil, fmt.Errorf("unsupported websocket version")
+	}
+
+	key := request.Header.Get("Sec-WebSocket-Key")
+
+	if key == "" {
+		return nil, fmt.Errorf("websocket key missing")
+	}
+
+	hijacker, ok := writer.(http.Hijacker)
+
+	if !ok {
+		return nil, fmt.Errorf("connection cannot be hijacked")
+	}
+
+	conn, rw, err := hijacker.Hijack()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n", webSocketAccept(key)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &WebSocket{
+		conn:         conn,
+		reader:       rw.Reader,
+		writeTimeout: webSocketWriteTimeout,
+	}, nil
+}
+
+func (w *WebSocket) readFrame() (bool, byte, []byte, error) {
+
+	header := make([]byte, 2)
+
+	if _, err := io.ReadFull(w.reader, header); err != nil {
+		return false, 0, nil, err
+	}
+
+	fin := header[0]&0x80 != 0
+	opcode := header[0] & 0x0f
+	masked := header[1]&0x80 != 0
+	length := uint64(header[1] & 0x7f)
+
+	switch length {
+	case 126:
+		extended := make([]byte, 2)
+		if _, err := io.ReadFull(w.reader, extended); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(extended))
+	case 127:
+		extended := make([]byte, 8)
+		if _, err := io.ReadFull(w.reader, extended); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(extended)
+	}
+
+	// clients always have to mask their frames
+	if !masked {
+		return false, 0, nil, fmt.Errorf("unmasked client frame")
+	}
+
+	if length > maxWebSocketMessageSize {
+		return false, 0, nil, fmt.Errorf("frame too large")
+	}
+
+	mask := make([]byte, 4)
+
+	if _, err := io.ReadFull(w.reader, mask); err != nil {
+		return false, 0, nil, err
+	}
+
+	payload := make([]byte, length)
+
+	if _, err := io.ReadFull(w.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+
+	return fin, opcode, payload, nil
+}
+
+// Reads the next text or binary message, answering control frames on the way
+func (w *WebSocket) ReadMessage() (byte, []byte, error) {
+
+	var messageType byte
+	var message []byte
+
+	for {
+
+		fin, opcode, payload, err := w.readFrame()
+
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch opcode {
+		case pingFrame:
+			if err := w.writeFrame(pongFrame, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case pongFrame:
+			continue
+		case closeFrame:
+			// we answer with the status code of the client
+			if len(payload) > 2 {
+				payload = payload[:2]
+			}
+			w.writeFrame(closeFrame, payload)
+			return 0, nil, ErrWebSocketClosed
+		case TextFrame, BinaryFrame:
+			if messageType != 0 {
+				return 0, nil, fmt.Errorf("expected a continuation frame")
+			}
+			messageType = opcode
+			message = payload
+		case continuationFrame:
+			if messageType == 0 {
+				return 0, nil, fmt.Errorf("unexpected continuation frame")
+			}
+			if len(message)+len(payload) > maxWebSocketMessageSize {
+				return 0, nil, fmt.Errorf("message too large")
+			}
+			message = append(message, payload...)
+		default:
+			return 0, nil, fmt.Errorf("unknown opcode %d", opcode)
+		}
+
+		if fin {
+			return messageType, message, nil
+		}
+	}
+}
+
+func (w *WebSocket) writeFrame(opcode byte, payload []byte) error {
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.closed {
+		return ErrWebSocketClosed
+	}
+
+	// the server does not mask its frames
+	header := []byte{0x80 | opcode, 0}
+
+	switch length := len(payload); {
+	case length < 126:
+		header[1] = byte(length)
+	case length <= 0xffff:
+		header[1] = 126
+		header = append(header, 0, 0)
+		binary.BigEndian.PutUint16(header[2:], uint16(length))
+	default:
+		header[1] = 127
+		header = append(header, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(header[2:], uint64(length))
+	}
+
+	if err := w.conn.SetWriteDeadline(time.Now().Add(w.writeTimeout)); err != nil {
+		return err
+	}
+
+	if _, err := w.conn.Write(append(header, payload...)); err != nil {
+		// the frame might have been written partially, so the connection
+		// is unusable (e.g. because the client does not read anymore)
+		w.closed = true
+		w.conn.Close()
+		return err
+	}
+
+	if opcode == closeFrame {
+		w.closed = true
+	}
+
+	return nil
+}
+
+// Writes a message, it is safe to call this from different goroutines
+func (w *WebSocket) WriteMessage(messageType byte, data []byte) error {
+	return w.writeFrame(messageType, data)
+}
+
+func (w *WebSocket) Ping() error {
+	return w.writeFrame(pingFrame, nil)
+}
+
+// Sends a close frame (if we have not done so yet) and closes the connection
+func (w *WebSocket) Close() error {
+	// 1000 is the status code for a normal closure
+	w.writeFrame(closeFrame, []byte{0x03, 0xe8})
+	return w.conn.Close()
+}
@@ -0,0 +1,166 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package jsonrpc
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"github.com/impfen/services-inoeg/http"
+	"io"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	goHttp "net/http"
+)
+
+type testClient struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func dialWebSocket(t *testing.T, url string) *testClient {
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(url, "http://"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := "dGhlIHNhbXBsZSBub25jZQ=="
+
+	if _, err := io.WriteString(conn, "GET /jsonrpc/ws HTTP/1.1\r\nHost: localhost\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Key: "+key+"\r\nSec-WebSocket-Version: 13\r\n\r\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	reader := bufio.NewReader(conn)
+
+	response, err := goHttp.ReadResponse(reader, nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if response.StatusCode != 101 {
+		t.Fatalf("expected status 101, got %d", response.StatusCode)
+	}
+
+	// this is the example value from RFC 6455
+	if response.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("invalid accept key")
+	}
+
+	return &testClient{conn: conn, reader: reader}
+}
+
+func (c *testClient) write(t *testing.T, data []byte) {
+	mask := []byte{1, 2, 3, 4}
+	frame := []byte{0x80 | TextFrame, 0x80 | byte(len(data))}
+	frame = append(frame, mask...)
+	for i, b := range data {
+		frame = append(frame, b^mask[i%4])
+	}
+	if _, err := c.conn.Write(frame); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (c *testClient) read(t *testing.T) map[string]interface{} {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(c.reader, header); err != nil {
+		t.Fatal(err)
+	}
+	length := int(header[1] & 0x7f)
+	if length == 126 {
+		extended := make([]byte, 2)
+		io.ReadFull(c.reader, extended)
+		length = int(binary.BigEndian.Uint16(extended))
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		t.Fatal(err)
+	}
+	var message map[string]interface{}
+	if err := json.Unmarshal(payload, &message); err != nil {
+		t.Fatal(err)
+	}
+	return message
+}
+
+func TestWebSocketJSONRPC(t *testing.T) {
+
+	server := makeTestServer(nil)
+
+	handler := server.WebSocket(func(context *Context) *Response {
+		if err := context.Connection.Notify("hello", map[string]interface{}{"method": context.Request.Method}); err != nil {
+			t.Error(err)
+		}
+		return context.Result("ok").(*Response)
+	})
+
+	httpServer := httptest.NewServer(goHttp.HandlerFunc(func(w goHttp.ResponseWriter, r *goHttp.Request) {
+		handler(http.MakeContext(w, r))
+	}))
+	defer httpServer.Close()
+
+	client := dialWebSocket(t, httpServer.URL)
+	defer client.conn.Close()
+
+	client.write(t, []byte(`{"jsonrpc": "2.0", "method": "test", "id": "abc", "params": {}}`))
+
+	if notification := client.read(t); notification["method"] != "hello" || notification["id"] != nil {
+		t.Fatalf("expected a notification, got %v", notification)
+	}
+
+	if response := client.read(t); response["result"] != "ok" {
+		t.Fatalf("unexpected response: %v", response)
+	}
+
+	client.write(t, []byte(`not json`))
+
+	if response := client.read(t); response["error"] == nil {
+		t.Fatalf("expected an error, got %v", response)
+	}
+}
+
+func TestWebSocketWriteTimeout(t *testing.T) {
+
+	// writes to a pipe block until the other side reads
+	server, client := net.Pipe()
+	defer client.Close()
+
+	ws := &WebSocket{
+		conn:         server,
+		reader:       bufio.NewReader(server),
+		writeTimeout: 10 * time.Millisecond,
+	}
+
+	if err := ws.WriteMessage(TextFrame, []byte("test")); err == nil {
+		t.Fatalf("expected the write to time out")
+	}
+
+	// the connection is closed, so other writers do not block
+	if err := ws.Ping(); err != ErrWebSocketClosed {
+		t.Fatalf("expected the websocket to be closed, got %v", err)
+	}
+
+}
@@ -49,6 +49,10 @@ func (l *Logger) Fatal(args ...interface{}) {
 	log.Fatal(args...)
 }
 
+func (l *Logger) Fatalf(format string, args ...interface{}) {
+	log.Fatalf(format, args...)
+}
+
 func (l *Logger) Info(args ...interface{}) {
 	log.Info(args...)
 }
@@ -18,6 +18,11 @@
 
 package services
 
+import (
+	"fmt"
+	"sort"
+)
+
 type MeterDefinition struct {
 	Name              string            `json:"name"`
 	Description       string            `json:"description"`
@@ -47,4 +52,125 @@ type Meter interface {
 	// Return metrics for a given ID and time interval
 	Range(id string, from, to int64, name, twType string) ([]*Metric, error)
 	N(id string, to int64, n int64, name, twType string) ([]*Metric, error)
+	// Return metrics for a given ID and time interval, grouped and aggregated
+	RangeGrouped(id string, from, to int64, query *GroupQuery) ([]*Metric, error)
+}
+
+// Meters that can apply retention policies to the values they store
+type RetentionMeter interface {
+	Meter
+	// Sets the policies that determine when values expire
+	SetRetention(policies []*RetentionPolicy)
+	// Deletes all values of the given type in windows that end before the
+	// given time. Values in windows that end before 'from' may have been
+	// deleted by an earlier call already.
+	Cleanup(id string, twType string, from, before int64) error
+}
+
+// Meters that can count unique uids approximately
+type ApproximateMeter interface {
+	Meter
+	// AddOnce uses a HyperLogLog sketch instead of a set of uids for these metrics
+	SetApproximate(names []string)
+}
+
+// Describes how metrics should be grouped and aggregated
+type GroupQuery struct {
+	// name and time window type of the metrics
+	Name string
+	Type string
+	// optional filter that is applied before grouping
+	Filter func(*Metric) bool
+	// optional data dimension to group by, metrics without it are skipped
+	GroupBy string
+	// optional aggregation across time windows ("sum" or "max")
+	Aggregate string
+}
+
+// Groups metrics by the data dimension of the query. Values within the same
+// time window are summed up, if an aggregation is given we also combine the
+// values of all time windows into a single metric per group.
+func GroupMetrics(metrics []*Metric, query *GroupQuery) []*Metric {
+
+	groupData := func(metric *Metric) (map[string]string, bool) {
+		if query.GroupBy == "" {
+			return metric.Data, true
+		}
+		if v, ok := metric.Data[query.GroupBy]; ok {
+			return map[string]string{query.GroupBy: v}, true
+		}
+		return nil, false
+	}
+
+	groupKey := func(metric *Metric) string {
+		// fmt prints maps with sorted keys
+		key := fmt.Sprintf("%s:%v", metric.Name, metric.Data)
+		if query.Aggregate == "" {
+			key += fmt.Sprintf(":%d:%d", metric.TimeWindow.From, metric.TimeWindow.To)
+		}
+		return key
+	}
+
+	windowGroups := make(map[string]*Metric)
+	groups := make(map[string]*Metric)
+	grouped := make([]*Metric, 0)
+
+	for _, metric := range metrics {
+		if query.Filter != nil && !query.Filter(metric) {
+			continue
+		}
+		data, ok := groupData(metric)
+		if !ok {
+			continue
+		}
+		key := fmt.Sprintf("%s:%v:%d:%d", metric.Name, data, metric.TimeWindow.From, metric.TimeWindow.To)
+		if group, ok := windowGroups[key]; ok {
+			group.Value += metric.Value
+			continue
+		}
+		windowGroups[key] = &Metric{
+			Name:       metric.Name,
+			TimeWindow: metric.TimeWindow,
+			Value:      metric.Value,
+			Data:       data,
+		}
+	}
+
+	// we iterate over the window groups in a stable order
+	keys := make([]string, 0, len(windowGroups))
+	for key := range windowGroups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		metric := windowGroups[key]
+		gk := groupKey(metric)
+		group, ok := groups[gk]
+		if !ok {
+			if query.Aggregate != "" {
+				metric.TimeWindow.Type = "custom"
+			}
+			groups[gk] = metric
+			grouped = append(grouped, metric)
+			continue
+		}
+		// the group spans all of its time windows
+		if metric.TimeWindow.From < group.TimeWindow.From {
+			group.TimeWindow.From = metric.TimeWindow.From
+		}
+		if metric.TimeWindow.To > group.TimeWindow.To {
+			group.TimeWindow.To = metric.TimeWindow.To
+		}
+		switch query.Aggregate {
+		case "max":
+			if metric.Value > group.Value {
+				group.Value = metric.Value
+			}
+		default:
+			group.Value += metric.Value
+		}
+	}
+
+	return grouped
 }
@@ -0,0 +1,130 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package meters
+
+import (
+	"fmt"
+	"github.com/impfen/services-inoeg"
+	"time"
+)
+
+func windowLength(twType string) int64 {
+	tw := services.MakeTimeWindow(0, twType)
+	return tw.To - tw.From
+}
+
+// Compact applies the retention settings to the values of the given ID. Fine
+// time windows that have a rollup type are first summed up (or maximized for
+// gauges) into coarse windows that do not have a value yet, then all windows
+// beyond the retention period are deleted. Unique counts are not rolled up.
+// This assumes that compaction runs at least once per interval.
+func Compact(meter services.Meter, id string, settings *services.RetentionSettings, now int64) error {
+
+	for _, policy := range settings.Policies {
+
+		before := now - policy.Days*int64(24*time.Hour)
+		// windows that end before this have been handled by the last run
+		from := before - settings.Interval*int64(time.Second)
+
+		if policy.RollupTo != "" {
+			if windowLength(policy.RollupTo) <= windowLength(policy.Type) {
+				return fmt.Errorf("cannot roll up '%s' windows into finer '%s' windows", policy.Type, policy.RollupTo)
+			}
+			if err := rollup(meter, id, policy, settings, from, before, now); err != nil {
+				return err
+			}
+		}
+
+		if retentionMeter, ok := meter.(services.RetentionMeter); ok {
+			if err := retentionMeter.Cleanup(id, policy.Type, from, before); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func rollup(meter services.Meter, id string, policy *services.RetentionPolicy, settings *services.RetentionSettings, from, before, now int64) error {
+
+	aggregates := map[string]string{}
+
+	for _, gauge := range settings.Gauges {
+		aggregates[gauge] = "max"
+	}
+
+	// unique counts match neither aggregate, so they are never rolled up
+	for _, name := range settings.Unique {
+		aggregates[name] = ""
+	}
+
+	// we go through all complete coarse windows with fine values that are
+	// about to be deleted
+	for cw := services.MakeTimeWindow(from, policy.RollupTo); cw.From < before && cw.To <= now; cw.IncreaseBy(1) {
+
+		coarseMetrics, err := meter.Range(id, cw.From, cw.To, "", policy.RollupTo)
+
+		if err != nil {
+			return err
+		}
+
+		existing := map[string]bool{}
+
+		for _, metric := range coarseMetrics {
+			if metric.TimeWindow.From == cw.From {
+				existing[fmt.Sprintf("%s:%v", metric.Name, metric.Data)] = true
+			}
+		}
+
+		fineMetrics, err := meter.Range(id, cw.From, cw.To, "", policy.Type)
+
+		if err != nil {
+			return err
+		}
+
+		for _, aggregate := range []string{"sum", "max"} {
+
+			metrics := services.GroupMetrics(fineMetrics, &services.GroupQuery{
+				Aggregate: aggregate,
+				Filter: func(metric *services.Metric) bool {
+					// we only roll up windows that lie within the coarse window
+					if metric.TimeWindow.From < cw.From || metric.TimeWindow.To > cw.To {
+						return false
+					}
+					if a, ok := aggregates[metric.Name]; ok {
+						return a == aggregate
+					}
+					return aggregate == "sum"
+				},
+			})
+
+			for _, metric := range metrics {
+				if existing[fmt.Sprintf("%s:%v", metric.Name, metric.Data)] {
+					// the coarse window already has a value for this metric
+					continue
+				}
+				if err := meter.Add(id, metric.Name, metric.Data, cw, metric.Value); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
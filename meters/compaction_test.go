@@ -0,0 +1,120 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package meters
+
+import (
+	"fmt"
+	"github.com/impfen/services-inoeg"
+	"testing"
+	"time"
+)
+
+func TestCompact(t *testing.T) {
+
+	meter, err := MakeInMemory(map[string]interface{}{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2021, 6, 15, 10, 0, 0, 0, time.UTC)
+
+	// we write minute values only for two hours
+	for i := 0; i < 120; i++ {
+		tw := services.Minute(start.Add(time.Duration(i) * time.Minute).UnixNano())
+		if err := meter.Add("queues", "bookings", map[string]string{}, tw, 1); err != nil {
+			t.Fatal(err)
+		}
+		if err := meter.AddMax("queues", "open", "a", map[string]string{}, tw, int64(i%60)); err != nil {
+			t.Fatal(err)
+		}
+		if err := meter.AddOnce("queues", "active", fmt.Sprintf("%d", i%2), map[string]string{}, tw, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the second hour already has a value that should be kept
+	secondHour := services.Hour(start.Add(time.Hour).UnixNano())
+	if err := meter.Add("queues", "bookings", map[string]string{}, secondHour, 1000); err != nil {
+		t.Fatal(err)
+	}
+
+	settings := &services.RetentionSettings{
+		Policies: []*services.RetentionPolicy{
+			{Type: "minute", Days: 2, RollupTo: "hour"},
+		},
+		Gauges:   []string{"open"},
+		Unique:   []string{"active"},
+		Interval: 3600,
+	}
+
+	now := start.AddDate(0, 0, 2).Add(time.Hour).UnixNano()
+
+	if err := Compact(meter, "queues", settings, now); err != nil {
+		t.Fatal(err)
+	}
+
+	// the minutes of the second hour have not reached the retention period
+	// yet, so they are not rolled up, and unique counts are never rolled up
+	expected := map[int64]map[string]int64{
+		start.UnixNano(): {"bookings": 60, "open": 59, "active": 0},
+		secondHour.From:  {"bookings": 1000, "open": 0, "active": 0},
+	}
+
+	for from, values := range expected {
+		for name, value := range values {
+			if metric, err := meter.Get("queues", name, map[string]string{}, services.Hour(from)); err != nil {
+				t.Fatal(err)
+			} else if metric.Value != value {
+				t.Fatalf("expected %d for '%s', got %d", value, name, metric.Value)
+			}
+		}
+	}
+
+	// the minutes of the first hour have been deleted
+	if metrics, err := meter.Range("queues", start.UnixNano(), now, "", "minute"); err != nil {
+		t.Fatal(err)
+	} else if len(metrics) != 180 {
+		// three metrics for each of the remaining 60 minutes
+		t.Fatalf("expected 180 minute values, got %d", len(metrics))
+	}
+
+	// compacting again does not change the rolled up values
+	if err := Compact(meter, "queues", settings, now); err != nil {
+		t.Fatal(err)
+	}
+
+	if metric, err := meter.Get("queues", "bookings", map[string]string{}, services.Hour(start.UnixNano())); err != nil {
+		t.Fatal(err)
+	} else if metric.Value != 60 {
+		t.Fatalf("expected 60 bookings, got %d", metric.Value)
+	}
+
+	// an hour later the second hour is rolled up as well
+	if err := Compact(meter, "queues", settings, now+int64(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	if metric, err := meter.Get("queues", "open", map[string]string{}, secondHour); err != nil {
+		t.Fatal(err)
+	} else if metric.Value != 59 {
+		t.Fatalf("expected 59 open, got %d", metric.Value)
+	}
+
+}
@@ -0,0 +1,86 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package meters
+
+import (
+	"hash/fnv"
+	"math"
+	"math/bits"
+)
+
+// we use the same precision as Redis, which gives a standard error of 0.81 %
+const hllPrecision = 14
+const hllRegisters = 1 << hllPrecision
+
+// A HyperLogLog sketch for approximate unique counting
+type hyperLogLog struct {
+	registers []uint8
+}
+
+func newHyperLogLog() *hyperLogLog {
+	return &hyperLogLog{
+		registers: make([]uint8, hllRegisters),
+	}
+}
+
+func hllHash(data []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(data)
+	x := h.Sum64()
+	// we mix the bits (splitmix64 finalizer) as FNV does not distribute them well
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// Adds the data to the sketch and returns whether the sketch was changed
+func (h *hyperLogLog) Add(data []byte) bool {
+	x := hllHash(data)
+	index := x >> (64 - hllPrecision)
+	// the guard bit makes sure that rank is at most 64 - precision + 1
+	w := x<<hllPrecision | 1<<(hllPrecision-1)
+	rank := uint8(bits.LeadingZeros64(w) + 1)
+	if rank > h.registers[index] {
+		h.registers[index] = rank
+		return true
+	}
+	return false
+}
+
+// Returns the estimated number of unique elements
+func (h *hyperLogLog) Count() int64 {
+	m := float64(hllRegisters)
+	var sum float64
+	var zeros int
+	for _, register := range h.registers {
+		sum += math.Ldexp(1, -int(register))
+		if register == 0 {
+			zeros++
+		}
+	}
+	estimate := 0.7213 / (1 + 1.079/m) * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 {
+		// we use linear counting for small cardinalities
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return int64(math.Round(estimate))
+}
@@ -0,0 +1,42 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package meters
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestHyperLogLog(t *testing.T) {
+
+	for _, n := range []int{10, 1000, 100000} {
+		hll := newHyperLogLog()
+		for i := 0; i < n; i++ {
+			// we add every element twice
+			hll.Add([]byte(fmt.Sprintf("uid-%d", i)))
+			hll.Add([]byte(fmt.Sprintf("uid-%d", i)))
+		}
+		count := hll.Count()
+		if math.Abs(float64(count-int64(n)))/float64(n) > 0.03 {
+			t.Fatalf("estimate %d is too far from %d", count, n)
+		}
+	}
+
+}
@@ -0,0 +1,261 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package meters
+
+import (
+	"fmt"
+	"github.com/impfen/services-inoeg"
+	"sort"
+	"sync"
+)
+
+// InMemory is a meter that keeps all values in memory, it has the same
+// semantics as the Redis meter but values only expire through Cleanup.
+type InMemory struct {
+	mutex sync.Mutex
+	// id -> type -> metric key -> value
+	values map[string]map[string]map[string]int64
+	// control structures for AddOnce & AddMax, keyed by id & metric key
+	once map[string]map[string]bool
+	max  map[string]map[string]int64
+	// sketches for approximate unique counting
+	sketches    map[string]*hyperLogLog
+	approximate map[string]bool
+}
+
+func ValidateInMemorySettings(settings map[string]interface{}) (interface{}, error) {
+	return settings, nil
+}
+
+func MakeInMemory(settings interface{}) (services.Meter, error) {
+	return &InMemory{
+		values:      make(map[string]map[string]map[string]int64),
+		once:        make(map[string]map[string]bool),
+		max:         make(map[string]map[string]int64),
+		sketches:    make(map[string]*hyperLogLog),
+		approximate: make(map[string]bool),
+	}, nil
+}
+
+var _ services.RetentionMeter = &InMemory{}
+var _ services.ApproximateMeter = &InMemory{}
+
+func (m *InMemory) SetApproximate(names []string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.approximate = make(map[string]bool)
+	for _, name := range names {
+		m.approximate[name] = true
+	}
+}
+
+// values do not expire by themselves, so there is nothing to do here
+func (m *InMemory) SetRetention(policies []*services.RetentionPolicy) {
+}
+
+func (m *InMemory) Cleanup(id string, twType string, from, before int64) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	byType, ok := m.values[id]
+	if !ok {
+		return nil
+	}
+	for key := range byType[twType] {
+		metric, err := parseMetric(key, "0")
+		if err != nil {
+			continue
+		}
+		if metric.TimeWindow.To <= before {
+			delete(byType[twType], key)
+			ck := m.controlKey(id, key)
+			delete(m.once, ck)
+			delete(m.max, ck)
+			delete(m.sketches, ck)
+		}
+	}
+	return nil
+}
+
+func (m *InMemory) controlKey(id, key string) string {
+	return fmt.Sprintf("%s:%s", id, key)
+}
+
+func (m *InMemory) add(id string, key string, tw services.TimeWindow, value int64) {
+	byType, ok := m.values[id]
+	if !ok {
+		byType = make(map[string]map[string]int64)
+		m.values[id] = byType
+	}
+	values, ok := byType[tw.Type]
+	if !ok {
+		values = make(map[string]int64)
+		byType[tw.Type] = values
+	}
+	values[key] += value
+}
+
+func (m *InMemory) Add(id string, name string, data map[string]string, tw services.TimeWindow, value int64) error {
+	key, err := getKey(name, data, tw)
+	if err != nil {
+		return err
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.add(id, key, tw, value)
+	return nil
+}
+
+// Adds a value from a UID to the statistic, but only once
+func (m *InMemory) AddOnce(id string, name string, uid string, data map[string]string, tw services.TimeWindow, value int64) error {
+	key, err := getKey(name, data, tw)
+	if err != nil {
+		return err
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	ck := m.controlKey(id, key)
+	if m.approximate[name] {
+		m.addOnceApproximate(id, ck, uid, key, tw, value)
+		return nil
+	}
+	uids, ok := m.once[ck]
+	if !ok {
+		uids = make(map[string]bool)
+		m.once[ck] = uids
+	}
+	if uids[uid] {
+		// the UID has already been counted
+		return nil
+	}
+	uids[uid] = true
+	m.add(id, key, tw, value)
+	return nil
+}
+
+// Counts the UID using a HyperLogLog, the value of the statistic is the
+// estimated number of unique UIDs multiplied by the given value
+func (m *InMemory) addOnceApproximate(id string, ck string, uid string, key string, tw services.TimeWindow, value int64) {
+	sketch, ok := m.sketches[ck]
+	if !ok {
+		sketch = newHyperLogLog()
+		m.sketches[ck] = sketch
+	}
+	if !sketch.Add([]byte(uid)) {
+		// the estimate did not change
+		return
+	}
+	current := m.values[id][tw.Type][key]
+	if diff := sketch.Count()*value - current; diff > 0 {
+		m.add(id, key, tw, diff)
+	}
+}
+
+// Adds the maximum value from a given UID to a given statistic
+func (m *InMemory) AddMax(id string, name string, uid string, data map[string]string, tw services.TimeWindow, value int64) error {
+	key, err := getKey(name, data, tw)
+	if err != nil {
+		return err
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	ck := m.controlKey(id, key)
+	maxValues, ok := m.max[ck]
+	if !ok {
+		maxValues = make(map[string]int64)
+		m.max[ck] = maxValues
+	}
+	if oldValue, ok := maxValues[uid]; ok {
+		if oldValue >= value {
+			// the old value is larger than the current value, we do nothing
+			return nil
+		}
+		maxValues[uid] = value
+		// we only add the difference to the old maximum
+		value = value - oldValue
+	} else {
+		maxValues[uid] = value
+	}
+	m.add(id, key, tw, value)
+	return nil
+}
+
+func (m *InMemory) Get(id string, name string, data map[string]string, tw services.TimeWindow) (*services.Metric, error) {
+	key, err := getKey(name, data, tw)
+	if err != nil {
+		return nil, err
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	var value int64
+	if byType, ok := m.values[id]; ok {
+		value = byType[tw.Type][key]
+	}
+	return &services.Metric{
+		Value:      value,
+		TimeWindow: tw,
+		Name:       name,
+	}, nil
+}
+
+func (m *InMemory) N(id string, to, n int64, name, twType string) ([]*services.Metric, error) {
+	toTw := services.MakeTimeWindow(to, twType)
+	fromTw := toTw.Copy()
+	fromTw.IncreaseBy(-n + 1)
+	return m.get(id, fromTw.From, toTw.To, name, twType)
+}
+
+func (m *InMemory) Range(id string, from, to int64, name, twType string) ([]*services.Metric, error) {
+	return m.get(id, from, to, name, twType)
+}
+
+func (m *InMemory) RangeGrouped(id string, from, to int64, query *services.GroupQuery) ([]*services.Metric, error) {
+	if metrics, err := m.get(id, from, to, query.Name, query.Type); err != nil {
+		return nil, err
+	} else {
+		grouped := services.GroupMetrics(metrics, query)
+		sort.Sort(ByNameAndWindow(grouped))
+		return grouped, nil
+	}
+}
+
+func (m *InMemory) get(id string, from, to int64, name, twType string) ([]*services.Metric, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	metrics := make([]*services.Metric, 0)
+	byType, ok := m.values[id]
+	if !ok {
+		return metrics, nil
+	}
+	for k, v := range byType[twType] {
+		// we parse the metric exactly like the Redis meter does
+		metric, err := parseMetric(k, fmt.Sprintf("%d", v))
+		if err != nil {
+			continue
+		}
+		if metric.TimeWindow.To <= from || metric.TimeWindow.From >= to {
+			continue
+		}
+		if name != "" && metric.Name != name {
+			continue
+		}
+		metrics = append(metrics, metric)
+	}
+	sort.Sort(ByNameAndWindow(metrics))
+	return metrics, nil
+}
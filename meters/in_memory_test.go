@@ -0,0 +1,180 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package meters
+
+import (
+	"fmt"
+	"github.com/impfen/services-inoeg"
+	"testing"
+	"time"
+)
+
+func TestInMemory(t *testing.T) {
+
+	meter, err := MakeInMemory(map[string]interface{}{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2021, 6, 15, 12, 30, 0, 0, time.UTC).UnixNano()
+	data := map[string]string{"zipCode": "10707"}
+
+	for i := int64(0); i < 3; i++ {
+		tw := services.Day(now - i*int64(24*time.Hour))
+		if err := meter.Add("queues", "bookings", data, tw, 2); err != nil {
+			t.Fatal(err)
+		}
+		// only the first value for a given uid counts
+		for _, uid := range []string{"a", "a", "b"} {
+			if err := meter.AddOnce("queues", "active", uid, data, tw, 1); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// only the difference to the maximum gets added
+		for _, v := range []int64{3, 5, 4} {
+			if err := meter.AddMax("queues", "open", "a", data, tw, v); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	tw := services.Day(now)
+
+	for name, expected := range map[string]int64{"bookings": 2, "active": 2, "open": 5} {
+		if metric, err := meter.Get("queues", name, data, tw); err != nil {
+			t.Fatal(err)
+		} else if metric.Value != expected {
+			t.Fatalf("expected %d for '%s', got %d", expected, name, metric.Value)
+		}
+	}
+
+	if metrics, err := meter.N("queues", now, 2, "bookings", "day"); err != nil {
+		t.Fatal(err)
+	} else if len(metrics) != 2 {
+		t.Fatalf("expected 2 metrics, got %d", len(metrics))
+	} else if metrics[0].TimeWindow.From != tw.From || metrics[0].Data["zipCode"] != "10707" {
+		t.Fatalf("unexpected metric")
+	}
+
+	if metrics, err := meter.Range("queues", now-int64(72*time.Hour), now, "", "day"); err != nil {
+		t.Fatal(err)
+	} else if len(metrics) != 9 {
+		t.Fatalf("expected 9 metrics, got %d", len(metrics))
+	}
+
+	if metrics, err := meter.Range("queues", now-int64(72*time.Hour), now, "", "hour"); err != nil {
+		t.Fatal(err)
+	} else if len(metrics) != 0 {
+		t.Fatalf("expected no hourly metrics, got %d", len(metrics))
+	}
+
+}
+
+func TestInMemoryRangeGrouped(t *testing.T) {
+
+	meter, err := MakeInMemory(map[string]interface{}{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2021, 6, 15, 12, 30, 0, 0, time.UTC).UnixNano()
+
+	for i := int64(0); i < 3; i++ {
+		tw := services.Day(now - i*int64(24*time.Hour))
+		for zipCode, value := range map[string]int64{"10707": 1, "10115": 2} {
+			if err := meter.Add("queues", "bookings", map[string]string{"zipCode": zipCode}, tw, value+i); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// global values are skipped when grouping by zip code
+		if err := meter.Add("queues", "bookings", map[string]string{}, tw, 100); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	query := &services.GroupQuery{
+		Name:      "bookings",
+		Type:      "day",
+		GroupBy:   "zipCode",
+		Aggregate: "sum",
+	}
+
+	from, to := now-int64(72*time.Hour), now
+
+	metrics, err := meter.RangeGrouped("queues", from, to, query)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values := map[string]int64{}
+	for _, metric := range metrics {
+		values[metric.Data["zipCode"]] = metric.Value
+	}
+
+	if len(metrics) != 2 || values["10707"] != 6 || values["10115"] != 9 {
+		t.Fatalf("unexpected sums: %v", values)
+	}
+
+	query.Aggregate = "max"
+
+	if metrics, err = meter.RangeGrouped("queues", from, to, query); err != nil {
+		t.Fatal(err)
+	} else if len(metrics) != 2 || metrics[0].Value+metrics[1].Value != 7 {
+		t.Fatalf("unexpected maxima")
+	}
+
+	query.Aggregate = ""
+
+	if metrics, err = meter.RangeGrouped("queues", from, to, query); err != nil {
+		t.Fatal(err)
+	} else if len(metrics) != 6 {
+		t.Fatalf("expected one metric per zip code and day, got %d", len(metrics))
+	}
+
+}
+
+func TestInMemoryApproximateAddOnce(t *testing.T) {
+
+	meter, err := MakeInMemory(map[string]interface{}{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	meter.(services.ApproximateMeter).SetApproximate([]string{"searches"})
+
+	tw := services.Day(time.Date(2021, 6, 15, 12, 30, 0, 0, time.UTC).UnixNano())
+
+	for i := 0; i < 2000; i++ {
+		// every user is counted twice
+		if err := meter.AddOnce("queues", "searches", fmt.Sprintf("user-%d", i%1000), map[string]string{}, tw, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if metric, err := meter.Get("queues", "searches", map[string]string{}, tw); err != nil {
+		t.Fatal(err)
+	} else if metric.Value < 970 || metric.Value > 1030 {
+		t.Fatalf("expected around 1000 unique users, got %d", metric.Value)
+	}
+
+}
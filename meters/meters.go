@@ -24,6 +24,12 @@ import (
 )
 
 var Meters = services.MeterDefinitions{
+	"in-memory": services.MeterDefinition{
+		Name:              "In-Memory Meter Database",
+		Description:       "An in-memory meter database for testing only",
+		Maker:             MakeInMemory,
+		SettingsValidator: ValidateInMemorySettings,
+	},
 	"redis": services.MeterDefinition{
 		Name:              "Redis Meter Database",
 		Description:       "For Production Use",
@@ -33,6 +33,8 @@ import (
 
 type Redis struct {
 	*databases.Redis
+	retention   []*services.RetentionPolicy
+	approximate map[string]bool
 }
 
 func MakeRedisShards(settings interface{}) (services.Meter, error) {
@@ -42,7 +44,7 @@ func MakeRedisShards(settings interface{}) (services.Meter, error) {
 		return nil, err
 	}
 	meter := &Redis{
-		redisClient,
+		Redis: redisClient,
 	}
 
 	return meter, nil
@@ -56,7 +58,7 @@ func MakeRedis(settings interface{}) (services.Meter, error) {
 	}
 
 	meter := &Redis{
-		redisClient,
+		Redis: redisClient,
 	}
 
 	return meter, nil
@@ -106,6 +108,10 @@ func encodeData(name string, data map[string]string) (string, error) {
 }
 
 func (r *Redis) getKey(name string, data map[string]string, tw services.TimeWindow) (string, error) {
+	return getKey(name, data, tw)
+}
+
+func getKey(name string, data map[string]string, tw services.TimeWindow) (string, error) {
 	ed, err := encodeData(name, data)
 	if err != nil {
 		return "", err
@@ -184,6 +190,53 @@ func (r *Redis) getTimeWindowFromTimeId(timeId int64, twType string) services.Ti
 	}
 }
 
+var _ services.RetentionMeter = &Redis{}
+var _ services.ApproximateMeter = &Redis{}
+
+func (r *Redis) SetApproximate(names []string) {
+	r.approximate = make(map[string]bool)
+	for _, name := range names {
+		r.approximate[name] = true
+	}
+}
+
+func (r *Redis) SetRetention(policies []*services.RetentionPolicy) {
+	r.retention = policies
+}
+
+// Returns the time at which the bucket containing the time window expires
+func (r *Redis) expiresAt(tw services.TimeWindow) time.Time {
+	tId := r.getTimeId(tw.From, tw.Type)
+	for _, policy := range r.retention {
+		if policy.Type == tw.Type {
+			// we keep the bucket until its last time window has reached the retention period
+			bucketEnd := r.getTimeFromId(r.increaseTimeId(tId, 1, tw.Type), tw.Type)
+			return time.Unix(bucketEnd/1e9, 0).AddDate(0, 0, int(policy.Days))
+		}
+	}
+	// without a policy we keep n intervals at most
+	maxTw := r.getTimeWindowFromTimeId(r.increaseTimeId(tId, 10, tw.Type), tw.Type)
+	return time.Unix(maxTw.To/1e9, 0)
+}
+
+// Deletes all buckets of the given type that only contain time windows ending
+// before the given time, starting with the bucket that contains 'from'.
+// Buckets expire by themselves as well, so anything older is removed anyway.
+// Control structures of AddOnce & AddMax are left to expire.
+func (r *Redis) Cleanup(id string, twType string, from, before int64) error {
+	maxTId := r.getTimeId(before, twType)
+	for tId := r.getTimeId(from, twType); tId < maxTId; tId = r.increaseTimeId(tId, 1, twType) {
+		if r.getTimeFromId(r.increaseTimeId(tId, 1, twType), twType) > before {
+			break
+		}
+		fullKey := r.getFullIdByTimeId(id, tId, twType)
+		if err := r.Client(fullKey).Del(r.Ctx, fullKey).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (r *Redis) getFullId(id string, tw services.TimeWindow) string {
 	// we group meter values for a given ID by day
 	return r.getFullIdByTimeId(id, r.getTimeId(tw.From, tw.Type), tw.Type)
@@ -241,10 +294,7 @@ func (r *Redis) AddMax(id string, name string, uid string, data map[string]strin
 	}
 
 	// we set the expiration time of the control structure
-	tId := r.getTimeId(tw.From, tw.Type)
-	maxTw := r.getTimeWindowFromTimeId(r.increaseTimeId(tId, 10, tw.Type), tw.Type)
-
-	if _, err := c.ExpireAt(r.Ctx, fullKey, time.Unix(maxTw.To/1e9, 0)).Result(); err != nil {
+	if _, err := c.ExpireAt(r.Ctx, fullKey, r.expiresAt(tw)).Result(); err != nil {
 		return err
 	}
 
@@ -262,6 +312,10 @@ func (r *Redis) AddOnce(id string, name string, uid string, data map[string]stri
 		return err
 	}
 
+	if r.approximate[name] {
+		return r.addOnceApproximate(id, name, uid, data, tw, value, key)
+	}
+
 	fullId := r.getFullId(id, tw)
 	fullKey := fmt.Sprintf("addOnce:%s:%s", fullId, key)
 
@@ -273,10 +327,7 @@ func (r *Redis) AddOnce(id string, name string, uid string, data map[string]stri
 		return nil
 	}
 
-	tId := r.getTimeId(tw.From, tw.Type)
-	maxTw := r.getTimeWindowFromTimeId(r.increaseTimeId(tId, 10, tw.Type), tw.Type)
-
-	if _, err := c.ExpireAt(r.Ctx, fullKey, time.Unix(maxTw.To/1e9, 0)).Result(); err != nil {
+	if _, err := c.ExpireAt(r.Ctx, fullKey, r.expiresAt(tw)).Result(); err != nil {
 		return err
 	}
 
@@ -288,6 +339,51 @@ func (r *Redis) AddOnce(id string, name string, uid string, data map[string]stri
 
 }
 
+// sets a field of a hash to the given value unless it is already larger, and
+// sets the expiration date of the hash when the field is created
+var setMaxScript = redis.NewScript(`
+local current = tonumber(redis.call('HGET', KEYS[1], ARGV[1]) or '0')
+local value = tonumber(ARGV[2])
+if value > current then
+	redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+	if current == 0 then
+		redis.call('EXPIREAT', KEYS[1], ARGV[3])
+	end
+end
+return 0
+`)
+
+// Counts the UID using a HyperLogLog, the value of the statistic is the
+// estimated number of unique UIDs multiplied by the given value
+func (r *Redis) addOnceApproximate(id string, name string, uid string, data map[string]string, tw services.TimeWindow, value int64, key string) error {
+
+	fullId := r.getFullId(id, tw)
+	fullKey := fmt.Sprintf("addOnceApprox:%s:%s", fullId, key)
+
+	c := r.Client(fullKey)
+	if changed, err := c.PFAdd(r.Ctx, fullKey, uid).Result(); err != nil {
+		return err
+	} else if changed == 0 {
+		// the estimate did not change
+		return nil
+	}
+
+	if _, err := c.ExpireAt(r.Ctx, fullKey, r.expiresAt(tw)).Result(); err != nil {
+		return err
+	}
+
+	count, err := c.PFCount(r.Ctx, fullKey).Result()
+	if err != nil {
+		return err
+	}
+
+	// we set the value instead of adding the difference, as concurrent calls
+	// would otherwise count the same UIDs twice, and we never lower it so that
+	// a slower call cannot overwrite a newer estimate
+	metricKey := r.getFullId(id, tw)
+	return setMaxScript.Run(r.Ctx, r.Client(metricKey), []string{metricKey}, key, count*value, r.expiresAt(tw).Unix()).Err()
+}
+
 func (r *Redis) Add(id string, name string, data map[string]string, tw services.TimeWindow, value int64) error {
 	key, err := r.getKey(name, data, tw)
 	if err != nil {
@@ -303,10 +399,7 @@ func (r *Redis) Add(id string, name string, data map[string]string, tw services.
 	}
 	if res == value {
 		// we set the expiration date of the key
-		tId := r.getTimeId(tw.From, tw.Type)
-		// we keep n intervals at most
-		maxTw := r.getTimeWindowFromTimeId(r.increaseTimeId(tId, 10, tw.Type), tw.Type)
-		_, err = c.ExpireAt(r.Ctx, fullKey, time.Unix(maxTw.To/1e9, 0)).Result()
+		_, err = c.ExpireAt(r.Ctx, fullKey, r.expiresAt(tw)).Result()
 	}
 	return err
 }
@@ -369,6 +462,24 @@ func (r *Redis) Range(id string, from, to int64, name, twType string) ([]*servic
 
 }
 
+func (r *Redis) RangeGrouped(id string, from, to int64, query *services.GroupQuery) ([]*services.Metric, error) {
+
+	toTw := services.MakeTimeWindow(to, query.Type)
+	fromTw := services.MakeTimeWindow(from, query.Type)
+
+	maxTId := r.getTimeId(toTw.To, query.Type)
+	tId := r.getTimeId(fromTw.From, query.Type)
+
+	if metrics, err := r.GetByTimeIds(id, from, to, tId, maxTId, query.Name, query.Type); err != nil {
+		return nil, err
+	} else {
+		grouped := services.GroupMetrics(metrics, query)
+		sort.Sort(ByNameAndWindow(grouped))
+		return grouped, nil
+	}
+
+}
+
 func (r *Redis) GetByTimeIds(id string, from, to int64, tId, maxTId int64, name, twType string) ([]*services.Metric, error) {
 	metrics := make([]*services.Metric, 0)
 
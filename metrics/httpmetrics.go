@@ -19,7 +19,10 @@
 package metrics
 
 import (
+	"bufio"
 	"errors"
+	"fmt"
+	"net"
 	"net/http"
 )
 
@@ -48,3 +51,20 @@ func (r *StatusResponseWriter) WriteHeader(status int) {
 	r.status = status
 	r.ResponseWriter.WriteHeader(status)
 }
+
+// we pass flushes through so that streamed responses work
+func (r *StatusResponseWriter) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// we pass hijacking through so that connections can be upgraded (e.g. to
+// WebSockets)
+func (r *StatusResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hijacker, ok := r.ResponseWriter.(http.Hijacker); ok {
+		r.status = http.StatusSwitchingProtocols
+		return hijacker.Hijack()
+	}
+	return nil, nil, fmt.Errorf("response writer cannot be hijacked")
+}
@@ -21,6 +21,7 @@ package metrics
 import (
 	"context"
 	"github.com/impfen/services-inoeg"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"net/http"
 	"sync"
@@ -28,10 +29,11 @@ import (
 )
 
 type PrometheusMetricsServer struct {
-	server  *http.Server
-	mutex   sync.Mutex
-	err     error
-	running bool
+	server     *http.Server
+	mutex      sync.Mutex
+	err        error
+	running    bool
+	collectors []prometheus.Collector
 }
 
 type PrometheusMetricsServerSettings struct {
@@ -47,8 +49,19 @@ func MakePrometheusMetricsServer(bindAddress string) (*PrometheusMetricsServer,
 	return p, nil
 }
 
+// collectors are registered when the server starts
+func (p *PrometheusMetricsServer) AddCollector(collector prometheus.Collector) {
+	p.collectors = append(p.collectors, collector)
+}
+
 func (p *PrometheusMetricsServer) Start() error {
 
+	for _, collector := range p.collectors {
+		if err := prometheus.Register(collector); err != nil {
+			return err
+		}
+	}
+
 	go func() {
 
 		if err := p.server.ListenAndServe(); err != http.ErrServerClosed {
@@ -85,6 +98,10 @@ func (p *PrometheusMetricsServer) Start() error {
 
 func (p *PrometheusMetricsServer) Stop() error {
 
+	for _, collector := range p.collectors {
+		prometheus.Unregister(collector)
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	return p.server.Shutdown(ctx)
@@ -0,0 +1,88 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package metrics
+
+import (
+	"github.com/impfen/services-inoeg"
+	"github.com/prometheus/client_golang/prometheus"
+	"time"
+)
+
+// StatsCollector exposes the current open, booked and active gauges from the
+// meter as Prometheus metrics.
+type StatsCollector struct {
+	meter  services.Meter
+	twType string
+	descs  map[string]*prometheus.Desc
+}
+
+var statsGauges = map[string]string{
+	"open":   "Number of open appointment slots",
+	"booked": "Number of booked appointment slots",
+	"active": "Number of providers that published appointments",
+}
+
+func MakeStatsCollector(meter services.Meter, twType string) *StatsCollector {
+	descs := make(map[string]*prometheus.Desc)
+	for name, help := range statsGauges {
+		descs[name] = prometheus.NewDesc(
+			"appointments_"+name,
+			help+" in the current time window.",
+			[]string{"zip_code"},
+			prometheus.Labels{"time_window": twType},
+		)
+	}
+	return &StatsCollector{
+		meter:  meter,
+		twType: twType,
+		descs:  descs,
+	}
+}
+
+func (s *StatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range s.descs {
+		ch <- desc
+	}
+}
+
+func (s *StatsCollector) Collect(ch chan<- prometheus.Metric) {
+
+	metrics, err := s.meter.N("queues", time.Now().UTC().UnixNano(), 1, "", s.twType)
+
+	if err != nil {
+		services.Log.Error(err)
+		return
+	}
+
+	for _, metric := range metrics {
+		desc, ok := s.descs[metric.Name]
+		if !ok {
+			continue
+		}
+		zipCode := ""
+		if len(metric.Data) > 0 {
+			var ok bool
+			// we only expose global and per-zip code values
+			if zipCode, ok = metric.Data["zipCode"]; !ok || len(metric.Data) > 1 {
+				continue
+			}
+		}
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, float64(metric.Value), zipCode)
+	}
+}
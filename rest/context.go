@@ -32,6 +32,12 @@ type Context struct {
 	Request *Request
 }
 
+var _ services.RemoteContext = &Context{}
+
+func (c *Context) RemoteAddress() string {
+	return c.HTTP.RemoteAddress()
+}
+
 func (c *Context) Result(data interface{}) services.Response {
 
 	return &Response{
@@ -50,12 +56,23 @@ func (c *Context) Error(code int, message string, data interface{}) services.Res
 	}
 }
 
+func (c *Context) Fail(err *services.APIError, details interface{}) services.Response {
+	return &Response{
+		StatusCode: err.Status,
+		Data: &Error{
+			Message: err.Message,
+			Data:    err.Data(details),
+		},
+		Headers: err.Headers(),
+	}
+}
+
 func (c *Context) Params() map[string]interface{} {
 	return c.Request.Params
 }
 
 func (c *Context) NotFound() services.Response {
-	return c.Error(404, "not found", nil)
+	return c.Fail(services.ErrNotFound, nil)
 }
 
 func (c *Context) Acknowledge() services.Response {
@@ -67,15 +84,15 @@ func (c *Context) Nil() services.Response {
 }
 
 func (c *Context) MethodNotFound() services.Response {
-	return c.Error(404, "method not found", nil)
+	return c.Fail(services.ErrMethodNotFound, nil)
 }
 
 func (c *Context) InvalidParams(err error) services.Response {
-	return c.Error(400, "invalid params", err)
+	return c.Fail(services.ErrInvalidParams, err)
 }
 
 func (c *Context) InternalError() services.Response {
-	return c.Error(500, "internal error", nil)
+	return c.Fail(services.ErrInternal, nil)
 }
 
 func (c *Context) IsInternalError(resp services.Response) bool {
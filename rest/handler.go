@@ -27,8 +27,10 @@ import (
 )
 
 type Method struct {
-	Form       *forms.Form
-	Handler    interface{}
+	Form    *forms.Form
+	Handler interface{}
+	// headers that are added to all responses of the method
+	Headers    map[string]string
 	Path       string         `json:"path"`
 	Method     string         `json:"method"`
 	urlParams  []string       `json:"urlParams"`
@@ -106,6 +108,12 @@ func MethodsHandler(
 
 		context.Request = request
 
-		return services.HandleAPICall(request.Method.Handler, request.Method.Form, validateSettings, context).(*Response)
+		response = services.HandleAPICall(request.Method.Handler, request.Method.Form, validateSettings, context).(*Response)
+
+		if response != nil && request.Method.Headers != nil {
+			response.Headers = services.MergeHeaders(response.Headers, request.Method.Headers)
+		}
+
+		return response
 	}, nil
 }
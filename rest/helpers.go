@@ -20,7 +20,7 @@ package rest
 
 import (
 	"encoding/json"
-	"fmt"
+	"github.com/impfen/services-inoeg"
 	"net/url"
 	"regexp"
 )
@@ -46,12 +46,12 @@ func ExtractRESTRequest(c *Context, methods map[string]*Method) (*Request, *Resp
 	if c.HTTP.Request.Method != "GET" {
 
 		if !jsonContentTypeRegexp.MatchString(c.HTTP.Request.Header.Get("content-type")) {
-			return nil, c.Error(400, "invalid JSON", nil).(*Response)
+			return nil, c.Fail(services.ErrInvalidJSON, nil).(*Response)
 		}
 
 		decoder := json.NewDecoder(c.HTTP.Request.Body)
 		if err := decoder.Decode(&params); err != nil {
-			return nil, c.Error(400, "invalid JSON", nil).(*Response)
+			return nil, c.Fail(services.ErrInvalidJSON, nil).(*Response)
 		}
 	} else {
 		params = getParams(c.HTTP.Request.URL)
@@ -61,7 +61,7 @@ func ExtractRESTRequest(c *Context, methods map[string]*Method) (*Request, *Resp
 		if ok, pathParams := method.Matches(c.HTTP.Request.URL.EscapedPath(), c.HTTP.Request.Method); ok {
 			for k, v := range pathParams {
 				if _, ok := params[k]; ok {
-					return nil, c.Error(400, fmt.Sprintf("parameter '%s' supplied twice", k), nil).(*Response)
+					return nil, c.Fail(services.ErrDuplicateParameter, map[string]interface{}{"parameter": k}).(*Response)
 				}
 				params[k] = v
 			}
@@ -55,7 +55,17 @@ func (s *RESTServer) REST(handler Handler) http.Handler {
 			response = context.Nil().(*Response)
 		}
 
-		c.JSON(response.StatusCode, response.Data)
+		for key, value := range response.Headers {
+			c.Writer.Header().Set(key, value)
+		}
+
+		if raw, ok := response.Data.(*services.RawResult); ok {
+			c.Data(response.StatusCode, raw.ContentType, raw.Data)
+		} else if stream, ok := response.Data.(*services.StreamResult); ok {
+			c.Stream(response.StatusCode, stream.ContentType, stream.Stream)
+		} else {
+			c.JSON(response.StatusCode, response.Data)
+		}
 
 		elapsedTime := time.Since(startTime)
 		codeString := strconv.Itoa(response.StatusCode)
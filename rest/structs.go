@@ -26,6 +26,8 @@ type Request struct {
 type Response struct {
 	StatusCode int         `json:"statusCode"`
 	Data       interface{} `json:"result,omitempty"`
+	// additional HTTP headers of the response
+	Headers map[string]string `json:"-"`
 }
 
 type Error struct {
@@ -0,0 +1,99 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"github.com/impfen/services-inoeg"
+	"sort"
+	"time"
+)
+
+// public endpoint, returns the same values as getStats but in CSV format
+func (c *Appointments) exportStats(context services.Context, params *services.GetStatsParams) services.Response {
+
+	values, resp := c.stats(context, params)
+
+	if resp != nil {
+		return resp
+	}
+
+	data, err := statsCSV(values)
+
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	return context.Result(&services.RawResult{
+		ContentType: "text/csv; charset=utf-8",
+		Data:        data,
+	})
+}
+
+// Encodes the values as CSV, with one column for each data dimension
+func statsCSV(values []*services.StatsValue) ([]byte, error) {
+
+	dataKeys := make([]string, 0)
+	seen := make(map[string]bool)
+
+	for _, value := range values {
+		for k := range value.Data {
+			if !seen[k] {
+				seen[k] = true
+				dataKeys = append(dataKeys, k)
+			}
+		}
+	}
+
+	sort.Strings(dataKeys)
+
+	buf := new(bytes.Buffer)
+	writer := csv.NewWriter(buf)
+
+	if err := writer.Write(append([]string{"name", "from", "to", "value"}, dataKeys...)); err != nil {
+		return nil, err
+	}
+
+	for _, value := range values {
+		record := []string{
+			value.Name,
+			value.From.Format(time.RFC3339),
+			value.To.Format(time.RFC3339),
+			fmt.Sprintf("%d", value.Value),
+		}
+		for _, k := range dataKeys {
+			// missing values remain empty
+			record = append(record, value.Data[k])
+		}
+		if err := writer.Write(record); err != nil {
+			return nil, err
+		}
+	}
+
+	writer.Flush()
+
+	if err := writer.Error(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
@@ -27,17 +27,68 @@ import (
 
 // public endpoint
 func (c *Appointments) getStats(context services.Context, params *services.GetStatsParams) services.Response {
+	if values, resp := c.stats(context, params); resp != nil {
+		return resp
+	} else {
+		return context.Result(values)
+	}
+}
+
+// returns the statistics values or an error response
+func (c *Appointments) stats(context services.Context, params *services.GetStatsParams) ([]*services.StatsValue, services.Response) {
 
 	if c.meter == nil {
-		return context.InternalError()
+		return nil, context.InternalError()
 	}
 
 	toTime := time.Now().UTC().UnixNano()
 
+	filter := func(metric *services.Metric) bool {
+		if params.Metric != "" && metric.Name != params.Metric {
+			return false
+		}
+		if metric.Name[0] == '_' {
+			// we skip internal metrics (which start with a '_')
+			return false
+		}
+		for k, v := range params.Filter {
+			// if v is nil we only return metrics without a value for the given key
+			if v == nil {
+				if _, ok := metric.Data[k]; ok {
+					return false
+				}
+			} else if dv, ok := metric.Data[k]; !ok || dv != v {
+				// filter value is missing or does not match
+				return false
+			}
+		}
+		return true
+	}
+
 	var metrics []*services.Metric
 	var err error
 
-	if params.N != nil {
+	grouped := params.GroupBy != "" || params.Aggregate != ""
+
+	if grouped {
+		var from, to int64
+		if params.N != nil {
+			// we convert the number of time windows to a time range
+			toTw := services.MakeTimeWindow(toTime, params.Type)
+			fromTw := toTw.Copy()
+			fromTw.IncreaseBy(-*params.N + 1)
+			from, to = fromTw.From, toTw.To
+		} else {
+			from, to = params.From.UnixNano(), params.To.UnixNano()
+		}
+		metrics, err = c.meter.RangeGrouped(params.ID, from, to, &services.GroupQuery{
+			Name:      params.Name,
+			Type:      params.Type,
+			Filter:    filter,
+			GroupBy:   params.GroupBy,
+			Aggregate: params.Aggregate,
+		})
+	} else if params.N != nil {
 		metrics, err = c.meter.N(params.ID, toTime, *params.N, params.Name, params.Type)
 	} else {
 		metrics, err = c.meter.Range(params.ID, params.From.UnixNano(), params.To.UnixNano(), params.Name, params.Type)
@@ -45,35 +96,17 @@ func (c *Appointments) getStats(context services.Context, params *services.GetSt
 
 	if err != nil {
 		services.Log.Error(err)
-		return context.InternalError()
+		return nil, context.InternalError()
 	}
 
 	values := make([]*services.StatsValue, 0)
 
-addMetric:
 	for _, metric := range metrics {
-		if params.Metric != "" && metric.Name != params.Metric {
-			continue
-		}
-		if metric.Name[0] == '_' {
-			// we skip internal metrics (which start with a '_')
+		// grouped metrics have already been filtered
+		if !grouped && !filter(metric) {
 			continue
 		}
 
-		if params.Filter != nil {
-			for k, v := range params.Filter {
-				// if v is nil we only return metrics without a value for the given key
-				if v == nil {
-					if _, ok := metric.Data[k]; ok {
-						continue addMetric
-					}
-				} else if dv, ok := metric.Data[k]; !ok || dv != v {
-					// filter value is missing or does not match
-					continue addMetric
-				}
-			}
-		}
-
 		values = append(values, &services.StatsValue{
 			From:  time.Unix(metric.TimeWindow.From/1e9, metric.TimeWindow.From%1e9).UTC(),
 			To:    time.Unix(metric.TimeWindow.To/1e9, metric.TimeWindow.From%1e9).UTC(),
@@ -87,7 +120,22 @@ addMetric:
 	sortableValues := Values{values: values}
 	sort.Sort(sortableValues)
 
-	return context.Result(values)
+	if c.privacy != nil {
+		if values, err = c.privacy.Apply(values, services.RemoteAddress(context)); err == BudgetExhausted {
+			return nil, context.Fail(services.ErrPrivacyBudgetExhausted.WithRetryAfter(c.privacy.NextPeriod()), nil)
+		} else if err == RateLimitExceeded {
+			return nil, context.Fail(services.ErrRateLimitExceeded.WithRetryAfter(c.privacy.NextRateWindow()), nil)
+		} else if err != nil {
+			services.Log.Error(err)
+			return nil, context.InternalError()
+		}
+	}
+
+	if params.TopN != nil {
+		values = topN(values, *params.TopN)
+	}
+
+	return values, nil
 }
 
 type Values struct {
@@ -116,3 +164,25 @@ func (f Values) Swap(i, j int) {
 	f.values[i], f.values[j] = f.values[j], f.values[i]
 
 }
+
+// Returns the n largest values for each metric name
+func topN(values []*services.StatsValue, n int64) []*services.StatsValue {
+	sorted := make([]*services.StatsValue, len(values))
+	copy(sorted, values)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Name != sorted[j].Name {
+			return sorted[i].Name < sorted[j].Name
+		}
+		return sorted[i].Value > sorted[j].Value
+	})
+	top := make([]*services.StatsValue, 0, len(sorted))
+	counts := make(map[string]int64)
+	for _, value := range sorted {
+		if counts[value.Name] >= n {
+			continue
+		}
+		counts[value.Name]++
+		top = append(top, value)
+	}
+	return top
+}
@@ -0,0 +1,61 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"github.com/impfen/services-inoeg"
+)
+
+// subscribes a persistent connection to availability updates of providers
+// around the given zip code
+func (c *Appointments) subscribeAvailability(
+	context services.Context,
+	params *services.SubscribeAvailabilityParams,
+) services.Response {
+
+	notifyingContext, ok := context.(services.NotifyingContext)
+
+	if !ok {
+		return context.Fail(services.ErrPersistentConnectionRequired, nil)
+	}
+
+	neighbors, err := c.backend.Neighbors("zipCode", params.ZipCode).Range(0, -1)
+
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	zipCodes := map[string]bool{params.ZipCode: true}
+
+	for _, neighbor := range neighbors {
+		if neighbor.Score <= params.Radius {
+			zipCodes[string(neighbor.Data)] = true
+		}
+	}
+
+	if err := c.availability.Subscribe(notifyingContext, params.ZipCode, zipCodes); err == services.ErrTooManySubscriptions {
+		return context.Fail(services.ErrTooManySubscriptions, map[string]interface{}{"limit": maxAvailabilitySubscriptions})
+	} else if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	return context.Acknowledge()
+}
@@ -22,7 +22,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/impfen/services-inoeg"
+	"github.com/impfen/services-inoeg/databases"
 	"github.com/impfen/services-inoeg/forms"
+	"sort"
 	"time"
 )
 
@@ -125,12 +127,41 @@ func (a *AppointmentsBackend) AppointmentDatesByProperty(
 	}
 }
 
+func (a *AppointmentsBackend) Outbox() *Outbox {
+	return &Outbox{
+		events: a.db.SortedSet("outbox", []byte("events")),
+		seq:    a.db.Integer("outbox", []byte("seq")),
+	}
+}
+
+func (a *AppointmentsBackend) Webhooks() *Webhooks {
+	return &Webhooks{
+		db:     a.db,
+		outbox: a.Outbox(),
+	}
+}
+
 func (a *AppointmentsBackend) UsedTokens() *UsedTokens {
 	return &UsedTokens{
 		dbs: a.db.Set("bookings", []byte("tokens")),
 	}
 }
 
+// cancellation notices are stored by the token of the booking
+func (a *AppointmentsBackend) CancellationNotices(token []byte) *CancellationNotices {
+	return &CancellationNotices{
+		db:    a.db,
+		token: token,
+		dbs:   a.db.Map("cancellationNotices", token),
+	}
+}
+
+func (a *AppointmentsBackend) IdempotentResponses() *IdempotentResponses {
+	return &IdempotentResponses{
+		db: a.db,
+	}
+}
+
 type PriorityToken struct {
 	token services.Integer
 }
@@ -492,3 +523,187 @@ func (a *AppointmentsByDate) GetAll(validateSettings *services.ValidateSettings)
 		return signedAppointments, nil
 	}
 }
+
+// the outbox keeps at most this many events
+const maxOutboxEvents = 100000
+
+// IDs are allocated before events are stored, so a concurrent request can
+// store event N+1 before event N. Readers only move past a missing ID once
+// the event after it is older than this, as the missing event is lost then.
+const outboxSettleDelay = 10 * time.Second
+
+type Outbox struct {
+	events services.SortedSet
+	seq    services.Integer
+}
+
+func (o *Outbox) Add(event *services.Event) (int64, error) {
+	id, err := o.seq.IncrBy(1)
+	if err != nil {
+		return 0, err
+	}
+	data, err := json.Marshal(&services.OutboxEvent{
+		ID:    id,
+		Event: *event,
+	})
+	if err != nil {
+		return 0, err
+	}
+	if err := o.events.Add(data, id); err != nil {
+		return 0, err
+	}
+	if id > maxOutboxEvents {
+		// we remove the oldest events
+		if err := o.events.RemoveRangeByScore(0, id-maxOutboxEvents); err != nil {
+			return 0, err
+		}
+	}
+	return id, nil
+}
+
+// Returns up to limit events after the cursor, as well as the new cursor
+func (o *Outbox) Get(cursor, limit int64) ([]*services.OutboxEvent, int64, error) {
+	entries, err := o.events.RangeByScore(cursor+1, cursor+limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(entries) == 0 {
+		// all events after the cursor might be missing (e.g. because the
+		// outbox was trimmed), so we look for the events that follow them
+		if seq, err := o.seq.Get(); err != nil {
+			if err == databases.NotFound {
+				// no events have been written yet
+				return []*services.OutboxEvent{}, cursor, nil
+			}
+			return nil, 0, err
+		} else if seq > cursor+limit {
+			if entries, err = o.events.RangeByScore(cursor+1, seq); err != nil {
+				return nil, 0, err
+			}
+			if int64(len(entries)) > limit {
+				entries = entries[:limit]
+			}
+		}
+	}
+	events := make([]*services.OutboxEvent, 0, len(entries))
+	for _, entry := range entries {
+		event := &services.OutboxEvent{}
+		if err := json.Unmarshal(entry.Data, event); err != nil {
+			return nil, 0, err
+		}
+		if event.ID != cursor+1 && time.Since(event.Timestamp) < outboxSettleDelay {
+			// the missing events might still be stored
+			break
+		}
+		events = append(events, event)
+		cursor = event.ID
+	}
+	return events, cursor, nil
+}
+
+// Webhooks stores the delivery state of the webhook subscribers
+type Webhooks struct {
+	db     services.Database
+	outbox *Outbox
+}
+
+func (w *Webhooks) Events(cursor, limit int64) ([]*services.OutboxEvent, int64, error) {
+	return w.outbox.Get(cursor, limit)
+}
+
+func (w *Webhooks) Cursor(subscriber string) (int64, error) {
+	if cursor, err := w.db.Integer("webhookCursor", []byte(subscriber)).Get(); err != nil {
+		if err == databases.NotFound {
+			// new subscribers receive all events that are still in the outbox
+			return 0, nil
+		}
+		return 0, err
+	} else {
+		return cursor, nil
+	}
+}
+
+func (w *Webhooks) SetCursor(subscriber string, cursor int64) error {
+	return w.db.Integer("webhookCursor", []byte(subscriber)).Set(cursor, 0)
+}
+
+func (w *Webhooks) DeadLetter(subscriber string, deadLetter *DeadLetter) error {
+	if data, err := json.Marshal(deadLetter); err != nil {
+		return err
+	} else {
+		return w.db.SortedSet("webhookDeadLetters", []byte(subscriber)).Add(data, deadLetter.Timestamp.Unix())
+	}
+}
+
+func (w *Webhooks) Lock(subscriber string, ttl time.Duration) (services.Lock, error) {
+	return w.db.Lock("Lock::Webhook::"+subscriber, time.Millisecond*100, ttl)
+}
+
+// IdempotentResponses
+
+type IdempotentResponses struct {
+	db services.Database
+}
+
+func (i *IdempotentResponses) Get(id []byte) (*IdempotentResponse, error) {
+	if data, err := i.db.Value("idempotency", id).Get(); err != nil {
+		return nil, err
+	} else {
+		var response *IdempotentResponse
+		if err := json.Unmarshal(data, &response); err != nil {
+			return nil, err
+		}
+		return response, nil
+	}
+}
+
+func (i *IdempotentResponses) Set(id []byte, response *IdempotentResponse, ttl time.Duration) error {
+	if data, err := json.Marshal(response); err != nil {
+		return err
+	} else {
+		return i.db.Value("idempotency", id).Set(data, ttl)
+	}
+}
+
+// CancellationNotices
+
+type CancellationNotices struct {
+	db    services.Database
+	token []byte
+	dbs   services.Map
+}
+
+func (c *CancellationNotices) Add(notice *services.CancellationNotice, ttl time.Duration) error {
+	if data, err := json.Marshal(notice); err != nil {
+		return err
+	} else if err := c.dbs.Set(notice.SlotID, data); err != nil {
+		return err
+	}
+	return c.db.Expire("cancellationNotices", c.token, ttl)
+}
+
+func (c *CancellationNotices) Del(slotID []byte) error {
+	return c.dbs.Del(slotID)
+}
+
+func (c *CancellationNotices) GetAll() ([]*services.CancellationNotice, error) {
+	notices := make([]*services.CancellationNotice, 0)
+	if allData, err := c.dbs.GetAll(); err != nil {
+		if err == databases.NotFound {
+			return notices, nil
+		}
+		return nil, err
+	} else {
+		for _, data := range allData {
+			var notice *services.CancellationNotice
+			if err := json.Unmarshal(data, &notice); err != nil {
+				return nil, err
+			}
+			notices = append(notices, notice)
+		}
+	}
+	sort.Slice(notices, func(i, j int) bool {
+		return notices[i].CancelledAt.Before(notices[j].CancelledAt)
+	})
+	return notices, nil
+}
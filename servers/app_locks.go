@@ -21,6 +21,7 @@ package servers
 import (
 	"encoding/base64"
 	"github.com/impfen/services-inoeg"
+	"time"
 )
 
 func toBase64 (bytes []byte) string {
@@ -70,6 +71,27 @@ func (c *Appointments) LockUser (
 	)
 }
 
+// idempotency locks make concurrent retries of a request wait until the
+// response of the first one has been stored
+func (c *Appointments) LockIdempotencyKey (
+	id []byte,
+	size int,
+) (services.Lock, error) {
+
+	// the lock is held while the request is executed, which takes longer
+	// for large requests (e.g. when publishing many appointments)
+	ttl := time.Second*30 + time.Duration(size/1024)*time.Second
+	if ttl > time.Minute*10 {
+		ttl = time.Minute * 10
+	}
+
+	return c.db.Lock(
+		"Lock::Idempotency::" + toBase64(id),
+		time.Second*10,
+		ttl,
+	)
+}
+
 func LockError (context services.Context) services.Response {
-	return context.Error(503, "lock timeout", nil)
+	return context.Fail(services.ErrLockTimeout, nil)
 }
@@ -19,6 +19,7 @@
 package servers
 
 import (
+	"encoding/hex"
 	"github.com/impfen/services-inoeg"
 	"github.com/impfen/services-inoeg/crypto"
 	"github.com/impfen/services-inoeg/databases"
@@ -28,9 +29,14 @@ import (
 func (c *Appointments) confirmProvider(
 	context services.Context,
 	params *services.ConfirmProviderSignedParams,
-) services.Response {
+) (resp services.Response) {
 
-	resp, _ := c.isMediator(context, &services.SignedParams{
+	// retries may use the original (possibly expired) signature
+	if resp := c.storedResponse(context, "confirmProvider", params.PublicKey, params.Signature, params.Data.IdempotencyKey, params.JSON); resp != nil {
+		return resp
+	}
+
+	resp, _ = c.isMediator(context, &services.SignedParams{
 		JSON:      params.JSON,
 		Signature: params.Signature,
 		PublicKey: params.PublicKey,
@@ -38,15 +44,22 @@ func (c *Appointments) confirmProvider(
 	})
 
 	if resp != nil {
+		c.metrics.SignatureFailure(context, "confirmProvider", "mediator", resp)
 		return resp
 	}
 
+	idem, resp := c.idempotency(context, "confirmProvider", params.PublicKey, params.Data.IdempotencyKey, params.JSON)
+	if resp != nil {
+		return resp
+	}
+	defer func() { idem.Store(resp) }()
+
 	providerID := crypto.Hash(params.Data.SignedKeyData.Data.Signing)
 
 	lock, err := c.LockProvider(providerID)
 	if err != nil {
 		services.Log.Error(err)
-		return LockError(context)
+		return c.metrics.LockError(context, "confirmProvider")
 	}
 	defer lock.Release()
 
@@ -136,5 +149,9 @@ func (c *Appointments) confirmProvider(
 		}
 	}
 
+	c.recordEvent(services.ProviderConfirmedEvent, map[string]interface{}{
+		"provider": hex.EncodeToString(providerID),
+	})
+
 	return context.Acknowledge()
 }
@@ -39,6 +39,7 @@ func (c *Appointments) getPendingProviderData(
 	})
 
 	if resp != nil {
+		c.metrics.SignatureFailure(context, "getPendingProviderData", "mediator", resp)
 		return resp
 	}
 
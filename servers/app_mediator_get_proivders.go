@@ -37,7 +37,10 @@ func (c *Appointments) getProviders(
 		PublicKey: params.PublicKey,
 		Timestamp: params.Data.Timestamp,
 	})
-	if resp != nil { return resp }
+	if resp != nil {
+		c.metrics.SignatureFailure(context, "getProviders", "mediator", resp)
+		return resp
+	}
 
 	providerStatus := c.backend.ProviderStatus()
 	pdEntries := []*services.RawProviderData{}
@@ -35,7 +35,10 @@ func (c *Appointments) getProviderData(
 		PublicKey: params.PublicKey,
 		Timestamp: params.Data.Timestamp,
 	})
-	if resp != nil { return resp }
+	if resp != nil {
+		c.metrics.SignatureFailure(context, "getProviderData", "mediator", resp)
+		return resp
+	}
 
 	verifiedProviderData := c.backend.VerifiedProviderData()
 	verPro, verProErr := verifiedProviderData.Get(params.Data.ProviderID)
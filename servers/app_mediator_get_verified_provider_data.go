@@ -39,6 +39,7 @@ func (c *Appointments) getVerifiedProviderData(
 	})
 
 	if resp != nil {
+		c.metrics.SignatureFailure(context, "getVerifiedProviderData", "mediator", resp)
 		return resp
 	}
 
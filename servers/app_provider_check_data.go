@@ -37,6 +37,7 @@ func (c *Appointments) checkProviderData(
 	})
 
 	if resp != nil {
+		c.metrics.SignatureFailure(context, "checkProviderData", "provider", resp)
 		return resp
 	}
 
@@ -37,6 +37,7 @@ func (c *Appointments) getProviderAppointments(
 	})
 
 	if resp != nil {
+		c.metrics.SignatureFailure(context, "getProviderAppointments", "provider", resp)
 		return resp
 	}
 
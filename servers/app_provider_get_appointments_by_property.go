@@ -37,6 +37,7 @@ func (c *Appointments) getProviderAppointmentsByProperty(
 	})
 
 	if resp != nil {
+		c.metrics.SignatureFailure(context, "getProviderAppointmentsByProperty", "provider", resp)
 		return resp
 	}
 
@@ -33,7 +33,7 @@ func (c *Appointments) isValidProvider(
 	lock, err := c.LockProvider(providerId)
 	if err != nil {
 		services.Log.Error(err)
-		return LockError(context)
+		return c.metrics.LockError(context, "isValidProvider")
 	}
 	defer lock.Release()
 
@@ -20,193 +20,451 @@ package servers
 
 import (
 	"bytes"
-	//"encoding/hex"
+	"encoding/hex"
 	"github.com/impfen/services-inoeg"
+	"github.com/impfen/services-inoeg/api"
 	"github.com/impfen/services-inoeg/crypto"
+	"github.com/impfen/services-inoeg/databases"
+	"sort"
 	"time"
 )
 
+// Returns the publishAppointments handler of the given API version. Version 1
+// stops at the first appointment that fails and returns its error (or
+// acknowledges the request), later versions verify the signatures of the
+// appointments, reject duplicates and return the status of every appointment.
 func (c *Appointments) publishAppointments(
-	context services.Context,
-	params *services.PublishAppointmentsSignedParams,
-) services.Response {
-
-	resp, providerKey := c.isProvider(context, &services.SignedParams{
-		JSON:      params.JSON,
-		Signature: params.Signature,
-		PublicKey: params.PublicKey,
-		Timestamp: params.Data.Timestamp,
-	})
+	version int,
+) func(services.Context, *services.PublishAppointmentsSignedParams) services.Response {
 
-	if resp != nil {
-		return resp
-	}
+	return func(
+		context services.Context,
+		params *services.PublishAppointmentsSignedParams,
+	) (resp services.Response) {
 
-	if expired(params.Data.Timestamp) {
-		return context.Error(410, "signature expired", nil)
-	}
+		defer func() {
+			c.metrics.PublishBatchSizes.WithLabelValues("publishAppointments", outcome(resp)).Observe(float64(len(params.Data.Appointments)))
+		}()
 
-	if len(params.Data.Appointments) > 500 {
-		return context.Error(
-			429,
-			"max number of appointments per post exceeded",
-			nil,
-		)
-	}
+		// the responses of the versions differ, so they must not be replayed
+		// for each other
+		endpoint := api.VersionedName("publishAppointments", version)
 
-	pkd, err := providerKey.ProviderKeyData()
+		// retries may use the original (possibly expired) signature
+		if resp := c.storedResponse(context, endpoint, params.PublicKey, params.Signature, params.Data.IdempotencyKey, params.JSON); resp != nil {
+			return resp
+		}
 
-	if err != nil {
-		services.Log.Error(err)
-		return context.InternalError()
+		resp, providerKey := c.isProvider(context, &services.SignedParams{
+			JSON:      params.JSON,
+			Signature: params.Signature,
+			PublicKey: params.PublicKey,
+			Timestamp: params.Data.Timestamp,
+		})
+
+		if resp != nil {
+			c.metrics.SignatureFailure(context, "publishAppointments", "provider", resp)
+			return resp
+		}
+
+		if expired(params.Data.Timestamp) {
+			return context.Fail(services.ErrSignatureExpired, nil)
+		}
+
+		idem, resp := c.idempotency(context, endpoint, params.PublicKey, params.Data.IdempotencyKey, params.JSON)
+		if resp != nil {
+			return resp
+		}
+		defer func() { idem.Store(resp) }()
+
+		if len(params.Data.Appointments) > 500 {
+			return context.Fail(services.ErrTooManyAppointments, nil)
+		}
+
+		pkd, err := providerKey.ProviderKeyData()
+
+		if err != nil {
+			services.Log.Error(err)
+			return context.InternalError()
+		}
+
+		results := c.publishProviderAppointments(pkd, params.Data, &publishOptions{
+			stopOnFailure: version == 1,
+			validate:      version >= 2,
+		})
+
+		if version == 1 {
+			for _, result := range results {
+				if result.Status == services.AppointmentFailed {
+					return context.Fail(services.LookupError(result.Error), nil)
+				}
+			}
+			return context.Acknowledge()
+		}
+
+		return context.Result(results)
 	}
+}
 
-	providerId := crypto.Hash(pkd.Signing)
-	// TODO: fix statistics generation
-	//var bookedSlots, openSlots int64
+// differences in the behavior of the API versions
+type publishOptions struct {
+	// stop at the first appointment that fails and skip the remaining ones
+	stopOnFailure bool
+	// verify the signatures of the appointments and reject duplicates
+	validate bool
+}
+
+// an appointment that is being published
+type appointmentPublication struct {
+	appointment *services.SignedAppointment
+	result      *services.PublishAppointmentResult
+	lock        services.Lock
+	// the currently stored version of the appointment (if any)
+	existing     *services.SignedAppointment
+	existingDate string
+	// bookings that were cancelled as their slots have been removed
+	removedBookings []*services.Booking
+}
+
+func (p *appointmentPublication) fail(err *services.APIError) {
+	p.result.Status = services.AppointmentFailed
+	p.result.Error = err.Code
+	p.result.Reason = err.Message
+}
 
-	for _, appointment := range params.Data.Appointments {
-		res := updateOrCreateAppointment(c, context, providerId, appointment)
-		if res != nil { return res }
+func (p *appointmentPublication) failed() bool {
+	return p.result.Status == services.AppointmentFailed
+}
+
+func (p *appointmentPublication) release() {
+	if p.lock != nil {
+		p.lock.Release()
+		p.lock = nil
 	}
+}
 
-	// TODO: fix statistics generation
-	/*
-	if c.meter != nil {
+// Publishes the appointments of the provider and returns their statuses. In
+// atomic mode, all appointments are validated and locked before any of them
+// is written, and none is written if one of them fails. If writing fails, the
+// appointments that have already been written are restored.
+func (c *Appointments) publishProviderAppointments(
+	pkd *services.ProviderKeyData,
+	params *services.PublishAppointmentsParams,
+	options *publishOptions,
+) []*services.PublishAppointmentResult {
 
-		now := time.Now().UTC().UnixNano()
-		hexUID := hex.EncodeToString(providerId)
+	providerId := crypto.Hash(pkd.Signing)
+	publications := make([]*appointmentPublication, len(params.Appointments))
+	results := make([]*services.PublishAppointmentResult, len(params.Appointments))
+	seen := make(map[string]bool, len(params.Appointments))
+
+	for i, appointment := range params.Appointments {
+		publication := &appointmentPublication{
+			appointment: appointment,
+			result: &services.PublishAppointmentResult{
+				ID: appointment.Data.ID,
+			},
+		}
+		publications[i] = publication
+		results[i] = publication.result
 
-		addTokenStats := func(tw services.TimeWindow, data map[string]string) error {
-			// we add the maximum of the open appointments
-			if err := c.meter.AddMax("queues", "open", hexUID, data, tw, openSlots); err != nil {
-				return err
+		if !options.validate {
+			continue
+		}
+
+		if seen[string(appointment.Data.ID)] {
+			publication.fail(services.ErrDuplicateAppointment)
+		} else if err := validateAppointment(pkd, appointment); err != nil {
+			publication.fail(err)
+		}
+		seen[string(appointment.Data.ID)] = true
+	}
+
+	// we hold the locks until the events have been recorded, so that e.g. a
+	// booking of a published appointment cannot be recorded before the
+	// publication itself
+	defer func() {
+		for _, publication := range publications {
+			publication.release()
+		}
+	}()
+
+	if !params.Atomic {
+		// version 1 processes the appointments in the order of the request,
+		// as it stops at the first failure
+		ordered := publications
+		if !options.stopOnFailure {
+			ordered = lockOrder(publications)
+		}
+		stopped := false
+		for _, publication := range ordered {
+			if stopped {
+				publication.result.Status = services.AppointmentSkipped
+				continue
 			}
-			// we add the maximum of the booked appointments
-			if err := c.meter.AddMax("queues", "booked", hexUID, data, tw, bookedSlots); err != nil {
-				return err
+			if !publication.failed() {
+				c.prepareAppointment(providerId, publication, params.Force)
 			}
-			// we add the info that this provider is active
-			if err := c.meter.AddOnce("queues", "active", hexUID, data, tw, 1); err != nil {
-				return err
+			if !publication.failed() {
+				c.writeAppointment(providerId, publication)
 			}
-			return nil
+			stopped = publication.failed() && options.stopOnFailure
 		}
+		c.recordPublishedAppointments(pkd, providerId, publications)
+		return results
+	}
 
-		for _, twt := range tws {
-
-			// generate the time window
-			tw := twt(now)
+	failed := func() bool {
+		for _, publication := range publications {
+			if publication.failed() {
+				return true
+			}
+		}
+		return false
+	}
 
-			// global statistics
-			if err := addTokenStats(tw, map[string]string{}); err != nil {
-				services.Log.Error(err)
+	if !failed() {
+		for _, publication := range lockOrder(publications) {
+			if c.prepareAppointment(providerId, publication, params.Force); publication.failed() {
+				break
 			}
+		}
+	}
 
-			// statistics by zip code
-			if err := addTokenStats(tw, map[string]string{
-				"zipCode": pkd.QueueData.ZipCode,
-			}); err != nil {
-				services.Log.Error(err)
+	skipRemaining := func() {
+		for _, publication := range publications {
+			if !publication.failed() {
+				publication.result.Status = services.AppointmentSkipped
 			}
+		}
+	}
 
+	if failed() {
+		skipRemaining()
+		return results
+	}
+
+	for i, publication := range publications {
+		if c.writeAppointment(providerId, publication); publication.failed() {
+			// the failed appointment might have been written partially
+			for _, written := range publications[:i+1] {
+				c.rollbackAppointment(providerId, written)
+			}
+			skipRemaining()
+			return results
 		}
+	}
+
+	c.recordPublishedAppointments(pkd, providerId, publications)
+
+	return results
+}
+
+// Returns the publications in the order in which we lock their appointments.
+// As we hold several locks at once, a fixed order ensures that concurrent
+// requests cannot block each other.
+func lockOrder(publications []*appointmentPublication) []*appointmentPublication {
+	ordered := make([]*appointmentPublication, len(publications))
+	copy(ordered, publications)
+	sort.Slice(ordered, func(i, j int) bool {
+		return bytes.Compare(ordered[i].appointment.Data.ID, ordered[j].appointment.Data.ID) < 0
+	})
+	return ordered
+}
+
+// appointments have to be signed by the provider that publishes them
+func validateAppointment(
+	pkd *services.ProviderKeyData,
+	appointment *services.SignedAppointment,
+) *services.APIError {
 
+	if !bytes.Equal(appointment.PublicKey, pkd.Signing) {
+		return services.ErrInvalidSignature
 	}
-	*/
 
-	return context.Acknowledge()
+	if ok, err := crypto.VerifyWithBytes(
+		[]byte(appointment.JSON),
+		appointment.Signature,
+		appointment.PublicKey,
+	); err != nil || !ok {
+		return services.ErrInvalidSignature
+	}
+
+	return nil
 }
 
-func updateOrCreateAppointment (
-	c *Appointments,
-	context services.Context,
+// locks the appointment and determines whether it is created, updated or
+// unchanged. Updates that remove booked slots fail unless they are forced.
+func (c *Appointments) prepareAppointment(
 	providerId []byte,
-	appointment *services.SignedAppointment,
-) services.Response {
+	publication *appointmentPublication,
+	force bool,
+) {
 
-	// appointments are stored in a provider-specific key
-	appointmentDatesByID := c.backend.AppointmentDatesByID(providerId)
-	usedTokens := c.backend.UsedTokens()
+	id := publication.appointment.Data.ID
 
-	lock, err := c.LockAppointment(appointment.Data.ID)
+	lock, err := c.LockAppointment(id)
 	if err != nil {
 		services.Log.Error(err)
-		return LockError(context)
+		c.metrics.LockTimeouts.WithLabelValues("publishAppointments", services.ErrLockTimeout.Code).Inc()
+		publication.fail(services.ErrLockTimeout)
+		return
 	}
-	defer lock.Release()
+	publication.lock = lock
 
 	// check if there's an existing appointment
-	if date, err := appointmentDatesByID.Get(appointment.Data.ID); err == nil {
+	date, err := c.backend.AppointmentDatesByID(providerId).Get(id)
 
-		// delete old dates index
-		if err := appointmentDatesByID.Del(appointment.Data.ID); err != nil {
+	if err != nil {
+		if err != databases.NotFound {
 			services.Log.Error(err)
-			return context.InternalError()
+			publication.fail(services.ErrInternal)
+			return
 		}
+		publication.result.Status = services.AppointmentCreated
+		return
+	}
 
-		appointmentsByDate :=
-			c.backend.AppointmentsByDate(providerId, string(date))
+	existingAppointment, err := c.backend.AppointmentsByDate(providerId, date).Get(
+		c.settings.Validate,
+		id,
+	)
 
-		if existingAppointment, err := appointmentsByDate.Get(
-			c.settings.Validate,
-			appointment.Data.ID,
-		); err != nil {
+	if err != nil {
+		if err != databases.NotFound {
 			services.Log.Error(err)
-			return context.InternalError()
-		} else {
-
-			// delete old properties indexes
-			for k, v := range appointment.Data.Properties {
-				appointmentDatesByProperty :=
-					c.backend.AppointmentDatesByProperty(providerId, k, v)
-				if err := appointmentDatesByProperty.Del(appointment.Data.ID); err != nil {
-					services.Log.Error(err)
-					return context.InternalError()
-				}
-			}
+			publication.fail(services.ErrInternal)
+			return
+		}
+		// the appointment has expired, only its index is left
+		publication.result.Status = services.AppointmentCreated
+		return
+	}
 
-			// delete old appointment
-			if err := appointmentsByDate.Del(appointment.Data.ID); err != nil {
-				services.Log.Error(err)
-				return context.InternalError()
-			}
+	publication.existing = existingAppointment
+	publication.existingDate = date
 
-			// deal with bookings
-			bookings := make([]*services.Booking, 0)
-			for _, existingSlotData := range existingAppointment.Data.SlotData {
-				found := false
-				for _, slotData := range appointment.Data.SlotData {
-					if bytes.Equal(slotData.ID, existingSlotData.ID) {
-						found = true
-						break
-					}
-				}
+	if existingAppointment.JSON == publication.appointment.JSON &&
+		bytes.Equal(existingAppointment.Signature, publication.appointment.Signature) {
+		publication.result.Status = services.AppointmentUnchanged
+		return
+	}
+
+	if _, removed := splitBookings(existingAppointment, publication.appointment); len(removed) > 0 && !force {
+		publication.fail(services.ErrBookedSlotsRemoved)
+		return
+	}
+
+	publication.result.Status = services.AppointmentUpdated
+}
+
+// Splits the bookings of the existing appointment into those of slots that are
+// preserved in the updated appointment and those of slots that are removed
+func splitBookings(
+	existingAppointment *services.SignedAppointment,
+	appointment *services.SignedAppointment,
+) (preserved, removed []*services.Booking) {
+
+	preserved = make([]*services.Booking, 0)
+
+	for _, existingSlotData := range existingAppointment.Data.SlotData {
+		found := false
+		for _, slotData := range appointment.Data.SlotData {
+			if bytes.Equal(slotData.ID, existingSlotData.ID) {
+				found = true
+				break
+			}
+		}
+		for _, booking := range existingAppointment.Bookings {
+			if bytes.Equal(booking.ID, existingSlotData.ID) {
 				if found {
-					// this slot has been preserved, if there's any booking for it we migrate it
-					for _, booking := range existingAppointment.Bookings {
-						if bytes.Equal(booking.ID, existingSlotData.ID) {
-							bookings = append(bookings, booking)
-							break
-						}
-					}
+					preserved = append(preserved, booking)
 				} else {
-					// this slot has been deleted, if there's any booking for it we delete it
-					for _, booking := range existingAppointment.Bookings {
-						if bytes.Equal(booking.ID, existingSlotData.ID) {
-							// we re-enable the associated token
-							if err := usedTokens.Del(booking.Token); err != nil {
-								services.Log.Error(err)
-								return context.InternalError()
-							}
-							break
-						}
-					}
+					removed = append(removed, booking)
 				}
+				break
+			}
+		}
+	}
+
+	return preserved, removed
+}
+
+// writes a prepared appointment, migrating the bookings of preserved slots
+func (c *Appointments) writeAppointment(
+	providerId []byte,
+	publication *appointmentPublication,
+) {
+
+	if publication.result.Status == services.AppointmentUnchanged {
+		return
+	}
+
+	if err := c.storeAppointment(providerId, publication); err != nil {
+		services.Log.Error(err)
+		publication.fail(services.ErrInternal)
+	}
+}
+
+func (c *Appointments) storeAppointment(
+	providerId []byte,
+	publication *appointmentPublication,
+) error {
+
+	appointment := publication.appointment
+	appointmentDatesByID := c.backend.AppointmentDatesByID(providerId)
+	usedTokens := c.backend.UsedTokens()
+
+	if existingAppointment := publication.existing; existingAppointment != nil {
+
+		// delete old dates index
+		if err := appointmentDatesByID.Del(appointment.Data.ID); err != nil {
+			return err
+		}
+
+		// delete old properties indexes
+		for k, v := range existingAppointment.Data.Properties {
+			appointmentDatesByProperty :=
+				c.backend.AppointmentDatesByProperty(providerId, k, v)
+			if err := appointmentDatesByProperty.Del(appointment.Data.ID); err != nil {
+				return err
 			}
-			appointment.Bookings = bookings
+		}
 
+		// delete old appointment
+		appointmentsByDate :=
+			c.backend.AppointmentsByDate(providerId, publication.existingDate)
+		if err := appointmentsByDate.Del(appointment.Data.ID); err != nil {
+			return err
+		}
+
+		// bookings of preserved slots are migrated, those of deleted slots
+		// are cancelled
+		bookings, removed := splitBookings(existingAppointment, appointment)
+
+		for _, booking := range removed {
+			// we re-enable the associated token
+			if err := usedTokens.Del(booking.Token); err != nil {
+				return err
+			}
+			// and tell the user about the cancellation
+			notice := &services.CancellationNotice{
+				ProviderID:    providerId,
+				AppointmentID: appointment.Data.ID,
+				SlotID:        booking.ID,
+				Timestamp:     existingAppointment.Data.Timestamp,
+				CancelledAt:   time.Now(),
+				Reason:        services.SlotRemovedReason,
+			}
+			ttl := time.Duration(c.settings.DataTTLDays) * time.Hour * 24
+			if err := c.backend.CancellationNotices(booking.Token).Add(notice, ttl); err != nil {
+				return err
+			}
 		}
+
+		appointment.Bookings = bookings
+		publication.removedBookings = removed
+
 	}
 
 	appointment.UpdatedAt = time.Now()
@@ -216,24 +474,154 @@ func updateOrCreateAppointment (
 	// create appointment
 	appointmentsByDate := c.backend.AppointmentsByDate(providerId, date)
 	if err := appointmentsByDate.Set(appointment); err != nil {
-		services.Log.Error(err)
-		return context.InternalError()
+		return err
 	}
 
 	//create ByDate index
 	if err := appointmentDatesByID.Set(appointment.Data.ID, date); err != nil {
-		services.Log.Error(err)
-		return context.InternalError()
+		return err
 	}
 
 	// create ByProperty indexes
 	for k, v := range appointment.Data.Properties {
 		appointmentDatesByProperty := c.backend.AppointmentDatesByProperty(providerId, k, v)
 		if err := appointmentDatesByProperty.Set(appointment.Data.ID, date); err != nil {
-			services.Log.Error(err)
-			return context.InternalError()
+			return err
+		}
+	}
+
+	return nil
+}
+
+// restores the state before the appointment was (possibly partially) written
+func (c *Appointments) rollbackAppointment(
+	providerId []byte,
+	publication *appointmentPublication,
+) {
+
+	if publication.result.Status == services.AppointmentUnchanged {
+		return
+	}
+
+	if err := c.restoreAppointment(providerId, publication); err != nil {
+		services.Log.Errorf("cannot roll back appointment %s: %v", hex.EncodeToString(publication.appointment.Data.ID), err)
+	}
+
+	publication.removedBookings = nil
+}
+
+func (c *Appointments) restoreAppointment(
+	providerId []byte,
+	publication *appointmentPublication,
+) error {
+
+	appointment := publication.appointment
+	id := appointment.Data.ID
+	appointmentDatesByID := c.backend.AppointmentDatesByID(providerId)
+	usedTokens := c.backend.UsedTokens()
+
+	// we delete the new version
+	date := appointment.Data.Timestamp.UTC().Format("2006-01-02")
+
+	if err := c.backend.AppointmentsByDate(providerId, date).Del(id); err != nil {
+		return err
+	}
+
+	if err := appointmentDatesByID.Del(id); err != nil {
+		return err
+	}
+
+	for k, v := range appointment.Data.Properties {
+		if err := c.backend.AppointmentDatesByProperty(providerId, k, v).Del(id); err != nil {
+			return err
+		}
+	}
+
+	existingAppointment := publication.existing
+
+	if existingAppointment == nil {
+		return nil
+	}
+
+	// and restore the existing one, including the bookings of removed slots
+	if err := c.backend.AppointmentsByDate(providerId, publication.existingDate).Set(existingAppointment); err != nil {
+		return err
+	}
+
+	if err := appointmentDatesByID.Set(id, publication.existingDate); err != nil {
+		return err
+	}
+
+	for k, v := range existingAppointment.Data.Properties {
+		if err := c.backend.AppointmentDatesByProperty(providerId, k, v).Set(id, publication.existingDate); err != nil {
+			return err
+		}
+	}
+
+	_, removed := splitBookings(existingAppointment, appointment)
+
+	for _, booking := range removed {
+		if err := usedTokens.Add(booking.Token); err != nil {
+			return err
+		}
+		if err := c.backend.CancellationNotices(booking.Token).Del(booking.ID); err != nil {
+			return err
 		}
 	}
 
 	return nil
 }
+
+// Records an event for every booking that has been cancelled and an event for
+// the publication. The statistics count the slots of all published
+// appointments (including unchanged ones, as clients usually republish all
+// their appointments), while the list of appointments only contains those
+// that have been created or updated. This is called while the appointments
+// are still locked.
+func (c *Appointments) recordPublishedAppointments(
+	pkd *services.ProviderKeyData,
+	providerId []byte,
+	publications []*appointmentPublication,
+) {
+
+	var bookedSlots, openSlots int64
+	published := false
+	appointmentIDs := make([]string, 0, len(publications))
+
+	for _, publication := range publications {
+		appointment := publication.appointment
+		switch publication.result.Status {
+		case services.AppointmentCreated, services.AppointmentUpdated:
+			appointmentIDs = append(appointmentIDs, hex.EncodeToString(appointment.Data.ID))
+		case services.AppointmentUnchanged:
+			// the bookings are only contained in the stored appointment
+			appointment = publication.existing
+		default:
+			continue
+		}
+		published = true
+		// bookings of preserved slots have been migrated to the appointment
+		bookedSlots += int64(len(appointment.Bookings))
+		openSlots += int64(len(appointment.Data.SlotData) - len(appointment.Bookings))
+		for range publication.removedBookings {
+			c.recordEvent(services.AppointmentCancelledEvent, map[string]interface{}{
+				"provider":    hex.EncodeToString(providerId),
+				"appointment": hex.EncodeToString(appointment.Data.ID),
+				"zipCode":     pkd.QueueData.ZipCode,
+				"reason":      services.SlotRemovedReason,
+			})
+		}
+	}
+
+	if !published {
+		return
+	}
+
+	c.recordEvent(services.AppointmentsPublishedEvent, map[string]interface{}{
+		"provider":     hex.EncodeToString(providerId),
+		"zipCode":      pkd.QueueData.ZipCode,
+		"open":         openSlots,
+		"booked":       bookedSlots,
+		"appointments": appointmentIDs,
+	})
+}
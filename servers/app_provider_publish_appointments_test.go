@@ -19,10 +19,14 @@
 package servers_test
 
 import (
+	"encoding/json"
+	"github.com/impfen/services-inoeg"
 	"github.com/impfen/services-inoeg/definitions"
+	"github.com/impfen/services-inoeg/helpers"
 	at "github.com/impfen/services-inoeg/testing"
 	af "github.com/impfen/services-inoeg/testing/fixtures"
 	"testing"
+	"time"
 )
 
 func TestPublishAppointments(t *testing.T) {
@@ -49,7 +53,7 @@ func TestPublishAppointments(t *testing.T) {
 		}, "provider"},
 
 		at.FC{af.Appointments{
-			N:        1000,
+			N:        500,
 			Start:    af.TS("2022-10-01T12:00:00Z"),
 			Duration: 30,
 			Slots:    20,
@@ -66,4 +70,73 @@ func TestPublishAppointments(t *testing.T) {
 		t.Fatal(err)
 	}
 
+	client := fixtures["client"].(*helpers.Client)
+	provider := fixtures["provider"].(*helpers.Provider)
+	appointments := fixtures["appointments"].([]*services.SignedAppointment)
+
+	publish := func(atomic bool, appointments ...*services.SignedAppointment) []*services.PublishAppointmentResult {
+
+		resp, err := client.Appointments.PublishAppointmentsV2(&services.PublishAppointmentsParams{
+			Timestamp:    time.Now(),
+			Atomic:       atomic,
+			Appointments: appointments,
+		}, provider)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.StatusCode != 200 {
+			t.Fatalf("expected a 200 status code, got %d instead", resp.StatusCode)
+		}
+
+		var result struct {
+			Result []*services.PublishAppointmentResult `json:"result"`
+		}
+
+		if data, err := resp.Bytes(); err != nil {
+			t.Fatal(err)
+		} else if err := json.Unmarshal(data, &result); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(result.Result) != len(appointments) {
+			t.Fatalf("expected %d results, got %d", len(appointments), len(result.Result))
+		}
+
+		return result.Result
+	}
+
+	expectStatuses := func(results []*services.PublishAppointmentResult, statuses ...string) {
+		for i, result := range results {
+			if result.Status != statuses[i] {
+				t.Fatalf("expected status %s for appointment %d, got %s (%s)", statuses[i], i, result.Status, result.Reason)
+			}
+		}
+	}
+
+	// republishing appointments does not change them
+	expectStatuses(publish(false, appointments[0], appointments[1]), "unchanged", "unchanged")
+
+	appointment, err := services.MakeAppointment(af.TS("2022-11-01T12:00:00Z"), 10, 30)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	appointment.PublicKey = provider.Actor.EncryptionKey.PublicKey
+	appointment.Vaccine = "moderna"
+
+	signedAppointment, err := appointment.Sign(provider.Actor.SigningKey)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// in atomic mode nothing is written if one of the appointments fails
+	expectStatuses(publish(true, signedAppointment, appointments[0], appointments[0]), "skipped", "skipped", "error")
+
+	// otherwise the other appointments are published
+	expectStatuses(publish(false, signedAppointment, appointments[0], appointments[0]), "created", "unchanged", "error")
+
 }
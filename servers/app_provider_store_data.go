@@ -28,7 +28,12 @@ import (
 func (c *Appointments) storeProviderData(
 	context services.Context,
 	params *services.StoreProviderDataSignedParams,
-) services.Response {
+) (resp services.Response) {
+
+	// retries may use the original (possibly expired) signature
+	if resp := c.storedResponse(context, "storeProviderData", params.PublicKey, params.Signature, params.Data.IdempotencyKey, params.JSON); resp != nil {
+		return resp
+	}
 
 	/* we verify the signature (without veryfing e.g. the provenance of the key)
 	 this is important as we use the public key as an identifier for the provider
@@ -42,12 +47,20 @@ func (c *Appointments) storeProviderData(
 		services.Log.Error(err)
 		return context.InternalError()
 	} else if !ok {
-		return context.Error(400, "invalid signature", nil)
+		resp := context.Fail(services.ErrInvalidSignature, nil)
+		c.metrics.SignatureFailure(context, "storeProviderData", "provider", resp)
+		return resp
 	}
 
 	if expired(params.Data.Timestamp) {
-		return context.Error(410, "signature expired", nil)
+		return context.Fail(services.ErrSignatureExpired, nil)
+	}
+
+	idem, resp := c.idempotency(context, "storeProviderData", params.PublicKey, params.Data.IdempotencyKey, params.JSON)
+	if resp != nil {
+		return resp
 	}
+	defer func() { idem.Store(resp) }()
 
 	// TODO: add one-time use check
 
@@ -70,13 +83,13 @@ func (c *Appointments) storeProviderData(
 
 	if (!existingData) && c.settings.ProviderCodesEnabled {
 		if params.Data.Code == nil {
-			return context.Error(401, "not authorized", nil)
+			return context.Fail(services.ErrNotAuthorized, nil)
 		}
 		if ok, err := codes.Has(params.Data.Code); err != nil {
 			services.Log.Error()
 			return context.InternalError()
 		} else if !ok {
-			return context.Error(401, "not authorized", nil)
+			return context.Fail(services.ErrNotAuthorized, nil)
 		}
 	}
 
@@ -84,7 +97,7 @@ func (c *Appointments) storeProviderData(
 	lock, err := c.LockProvider(providerID)
 	if err != nil {
 		services.Log.Error(err)
-		return LockError(context)
+		return c.metrics.LockError(context, "storeProviderData")
 	}
 	defer lock.Release()
 
@@ -0,0 +1,103 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"encoding/hex"
+	"fmt"
+	"github.com/impfen/services-inoeg"
+	"github.com/impfen/services-inoeg/crypto"
+	"io"
+	"time"
+)
+
+// interval of the keep-alive comments, which prevent proxies from closing
+// idle connections
+var keepAliveInterval = 30 * time.Second
+
+func (c *Appointments) streamProviderAppointments(
+	context services.Context,
+	params *services.StreamProviderAppointmentsSignedParams,
+) services.Response {
+
+	resp, providerKey := c.isProvider(context, &services.SignedParams{
+		JSON:      params.JSON,
+		Signature: params.Signature,
+		PublicKey: params.PublicKey,
+		Timestamp: params.Data.Timestamp,
+	})
+
+	if resp != nil {
+		c.metrics.SignatureFailure(context, "streamProviderAppointments", "provider", resp)
+		return resp
+	}
+
+	pkd, err := providerKey.ProviderKeyData()
+
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	channel := providerAppointmentsChannel(hex.EncodeToString(crypto.Hash(pkd.Signing)))
+
+	return context.Result(&services.StreamResult{
+		ContentType: "text/event-stream",
+		Stream: func(done <-chan struct{}, writer io.Writer) error {
+			return streamUpdates(c.pubSub, channel, done, c.stop, writer)
+		},
+	})
+}
+
+// Writes the messages of the channel as server-sent events until the client
+// disconnects or the server stops
+func streamUpdates(pubSub services.PubSub, channel string, done <-chan struct{}, stop <-chan bool, writer io.Writer) error {
+
+	subscription, err := pubSub.Subscribe(channel)
+
+	if err != nil {
+		return err
+	}
+
+	defer subscription.Close()
+
+	ticker := time.NewTicker(keepAliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case message, ok := <-subscription.Messages():
+			if !ok {
+				return nil
+			}
+			if _, err := fmt.Fprintf(writer, "event: appointment\ndata: %s\n\n", message); err != nil {
+				// the client has most likely disconnected
+				return nil
+			}
+		case <-ticker.C:
+			if _, err := io.WriteString(writer, ": keep-alive\n\n"); err != nil {
+				return nil
+			}
+		case <-done:
+			return nil
+		case <-stop:
+			return nil
+		}
+	}
+}
@@ -25,7 +25,12 @@ import (
 
 // { keys }, keyPair
 // add the mediator key to the list of keys (only for testing)
-func (c *Appointments) addMediatorPublicKeys(context services.Context, params *services.AddMediatorPublicKeysSignedParams) services.Response {
+func (c *Appointments) addMediatorPublicKeys(context services.Context, params *services.AddMediatorPublicKeysSignedParams) (resp services.Response) {
+
+	// retries may use the original (possibly expired) signature
+	if resp := c.storedResponse(context, "addMediatorPublicKeys", params.PublicKey, params.Signature, params.Data.IdempotencyKey, params.JSON); resp != nil {
+		return resp
+	}
 
 	if resp := c.isRoot(context, &services.SignedParams{
 		JSON:      params.JSON,
@@ -33,8 +38,15 @@ func (c *Appointments) addMediatorPublicKeys(context services.Context, params *s
 		PublicKey: params.PublicKey,
 		Timestamp: params.Data.Timestamp,
 	}); resp != nil {
+		c.metrics.SignatureFailure(context, "addMediatorPublicKeys", "root", resp)
+		return resp
+	}
+
+	idem, resp := c.idempotency(context, "addMediatorPublicKeys", params.PublicKey, params.Data.IdempotencyKey, params.JSON)
+	if resp != nil {
 		return resp
 	}
+	defer func() { idem.Store(resp) }()
 
 	mediatorKey := &services.ActorKey{
 		Data:      params.Data.SignedKeyData.JSON,
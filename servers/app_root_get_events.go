@@ -0,0 +1,50 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"github.com/impfen/services-inoeg"
+)
+
+// { cursor, limit }, keyPair
+// returns the events from the outbox that are newer than the cursor
+func (c *Appointments) getEvents(context services.Context, params *services.GetEventsSignedParams) services.Response {
+
+	if resp := c.isRoot(context, &services.SignedParams{
+		JSON:      params.JSON,
+		Signature: params.Signature,
+		PublicKey: params.PublicKey,
+		Timestamp: params.Data.Timestamp,
+	}); resp != nil {
+		c.metrics.SignatureFailure(context, "getEvents", "root", resp)
+		return resp
+	}
+
+	events, cursor, err := c.backend.Outbox().Get(params.Data.Cursor, params.Data.Limit)
+
+	if err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	}
+
+	return context.Result(&services.EventsFeed{
+		Events: events,
+		Cursor: cursor,
+	})
+}
@@ -30,11 +30,12 @@ func (a *Appointments) resetDB(context services.Context, params *services.ResetD
 		PublicKey: params.PublicKey,
 		Timestamp: params.Data.Timestamp,
 	}); resp != nil {
+		a.metrics.SignatureFailure(context, "resetDB", "root", resp)
 		return resp
 	}
 
 	if !a.test {
-		context.Error(400, "not a test system, will not reset database...", nil)
+		return context.Fail(services.ErrNotATestSystem, nil)
 	}
 
 	services.Log.Warning("Database reset requested!")
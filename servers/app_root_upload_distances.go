@@ -23,24 +23,34 @@ import (
 	"github.com/impfen/services-inoeg/crypto"
 )
 
-func (c *Appointments) uploadDistances(context services.Context, params *services.UploadDistancesSignedParams) services.Response {
+func (c *Appointments) uploadDistances(context services.Context, params *services.UploadDistancesSignedParams) (resp services.Response) {
 	rootKey := c.settings.Key("root")
 	if rootKey == nil {
 		services.Log.Error("root key missing")
 		return context.InternalError()
 	}
+	// retries may use the original (possibly expired) signature
+	if resp := c.storedResponse(context, "uploadDistances", rootKey.PublicKey, params.Signature, params.Data.IdempotencyKey, params.JSON); resp != nil {
+		return resp
+	}
 	if ok, err := rootKey.Verify(&crypto.SignedData{
 		Data:      []byte(params.JSON),
 		Signature: params.Signature,
 	}); !ok {
-		return context.Error(403, "invalid signature", nil)
+		return context.Fail(services.ErrInvalidSignature, nil)
 	} else if err != nil {
 		services.Log.Error(err)
 		return context.InternalError()
 	}
 	if expired(params.Data.Timestamp) {
-		return context.Error(410, "signature expired", nil)
+		return context.Fail(services.ErrSignatureExpired, nil)
+	}
+
+	idem, resp := c.idempotency(context, "uploadDistances", rootKey.PublicKey, params.Data.IdempotencyKey, params.JSON)
+	if resp != nil {
+		return resp
 	}
+	defer func() { idem.Store(resp) }()
 	for _, distance := range params.Data.Distances {
 		neighborsFrom := c.backend.Neighbors(params.Data.Type, distance.From)
 		neighborsTo := c.backend.Neighbors(params.Data.Type, distance.To)
@@ -20,6 +20,7 @@ package servers
 
 import (
 	"bytes"
+	"encoding/hex"
 	"github.com/impfen/services-inoeg"
 	"github.com/impfen/services-inoeg/databases"
 	"time"
@@ -32,17 +33,35 @@ func (c *Appointments) isActiveProvider(
 
 	if _, err := c.backend.Keys("providers").Get(id); err != nil {
 		if err == databases.NotFound {
-			return context.Error(404, "provider not found", nil)
+			return context.Fail(services.ErrProviderNotFound, nil)
 		}
 	}
 
 	return nil
 }
 
+// returns the zip code of the provider or an empty string if it is unknown
+func (c *Appointments) providerZipCode(id []byte) string {
+	if providerKey, err := c.backend.Keys("providers").Get(id); err != nil {
+		return ""
+	} else if pkd, err := providerKey.ProviderKeyData(); err != nil {
+		return ""
+	} else {
+		return pkd.QueueData.ZipCode
+	}
+}
+
 func (c *Appointments) bookAppointment(
 	context services.Context,
 	params *services.BookAppointmentSignedParams,
-) services.Response {
+) (resp services.Response) {
+
+	defer func() { c.metrics.Observe(c.metrics.Bookings, "bookAppointment", resp) }()
+
+	// retries may use the original (possibly expired) signature
+	if resp := c.storedResponse(context, "bookAppointment", params.PublicKey, params.Signature, params.Data.IdempotencyKey, params.JSON); resp != nil {
+		return resp
+	}
 
 	if resp := c.isUser(context, &services.SignedParams{
 		JSON:      params.JSON,
@@ -51,9 +70,16 @@ func (c *Appointments) bookAppointment(
 		ExtraData: params.Data.SignedTokenData,
 		Timestamp: params.Data.Timestamp,
 	}); resp != nil {
+		c.metrics.SignatureFailure(context, "bookAppointment", "user", resp)
 		return resp
 	}
 
+	idem, resp := c.idempotency(context, "bookAppointment", params.PublicKey, params.Data.IdempotencyKey, params.JSON)
+	if resp != nil {
+		return resp
+	}
+	defer func() { idem.Store(resp) }()
+
 	var result interface{}
 
 	usedTokens := c.backend.UsedTokens()
@@ -82,7 +108,7 @@ func (c *Appointments) bookAppointment(
 		appLock, err := c.LockAppointment(params.Data.ID)
 		if err != nil {
 			services.Log.Error(err)
-			return LockError(context)
+			return c.metrics.LockError(context, "bookAppointment")
 		}
 		defer appLock.Release()
 
@@ -116,13 +142,13 @@ func (c *Appointments) bookAppointment(
 					services.Log.Error(err)
 					return context.InternalError()
 				} else if ok {
-					return context.Error(401, "not authorized", nil)
+					return context.Fail(services.ErrNotAuthorized, nil)
 				}
 
 				tokenLock, err := c.LockToken(token)
 				if err != nil {
 					services.Log.Error(err)
-					return LockError(context)
+					return c.metrics.LockError(context, "bookAppointment")
 				}
 				defer tokenLock.Release()
 
@@ -164,26 +190,13 @@ func (c *Appointments) bookAppointment(
 
 	}
 
-	// TODO fix statistics
-	/*
-	if c.meter != nil {
-
-		now := time.Now().UTC().UnixNano()
-
-		for _, twt := range tws {
-
-			// generate the time window
-			tw := twt(now)
-
-			// we add the info that a booking was made
-			if err := c.meter.Add("queues", "bookings", map[string]string{}, tw, 1); err != nil {
-				services.Log.Error(err)
-			}
-
-		}
-
+	if result != nil {
+		c.recordEvent(services.AppointmentBookedEvent, map[string]interface{}{
+			"provider":    hex.EncodeToString(params.Data.ProviderID),
+			"appointment": hex.EncodeToString(params.Data.ID),
+			"zipCode":     c.providerZipCode(params.Data.ProviderID),
+		})
 	}
-	*/
 
 	return context.Result(result)
 
@@ -20,6 +20,7 @@ package servers
 
 import (
 	"bytes"
+	"encoding/hex"
 	"github.com/impfen/services-inoeg"
 	"time"
 )
@@ -27,7 +28,14 @@ import (
 func (c *Appointments) cancelAppointment(
 	context services.Context,
 	params *services.CancelAppointmentSignedParams,
-) services.Response {
+) (resp services.Response) {
+
+	defer func() { c.metrics.Observe(c.metrics.Cancellations, "cancelAppointment", resp) }()
+
+	// retries may use the original (possibly expired) signature
+	if resp := c.storedResponse(context, "cancelAppointment", params.PublicKey, params.Signature, params.Data.IdempotencyKey, params.JSON); resp != nil {
+		return resp
+	}
 
 	if resp := c.isUser(context, &services.SignedParams{
 		JSON:      params.JSON,
@@ -36,9 +44,16 @@ func (c *Appointments) cancelAppointment(
 		ExtraData: params.Data.SignedTokenData,
 		Timestamp: params.Data.Timestamp,
 	}); resp != nil {
+		c.metrics.SignatureFailure(context, "cancelAppointment", "user", resp)
 		return resp
 	}
 
+	idem, resp := c.idempotency(context, "cancelAppointment", params.PublicKey, params.Data.IdempotencyKey, params.JSON)
+	if resp != nil {
+		return resp
+	}
+	defer func() { idem.Store(resp) }()
+
 	appointmentDatesByID := c.backend.AppointmentDatesByID(params.Data.ProviderID)
 
 	if date, err := appointmentDatesByID.Get(params.Data.ID); err != nil {
@@ -55,7 +70,7 @@ func (c *Appointments) cancelAppointment(
 		lock, err := c.LockAppointment(params.Data.ID)
 		if err != nil {
 			services.Log.Error(err)
-			return LockError(context)
+			return c.metrics.LockError(context, "cancelAppointment")
 		}
 		defer lock.Release()
 
@@ -106,6 +121,12 @@ func (c *Appointments) cancelAppointment(
 
 	}
 
+	c.recordEvent(services.AppointmentCancelledEvent, map[string]interface{}{
+		"provider":    hex.EncodeToString(params.Data.ProviderID),
+		"appointment": hex.EncodeToString(params.Data.ID),
+		"zipCode":     c.providerZipCode(params.Data.ProviderID),
+	})
+
 	return context.Acknowledge()
 
 }
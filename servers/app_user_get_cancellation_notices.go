@@ -0,0 +1,51 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"github.com/impfen/services-inoeg"
+)
+
+// returns the notices about bookings of the user that have been cancelled by
+// the system (e.g. because the provider removed the booked slot)
+func (c *Appointments) getCancellationNotices(
+	context services.Context,
+	params *services.GetCancellationNoticesSignedParams,
+) services.Response {
+
+	if resp := c.isUser(context, &services.SignedParams{
+		JSON:      params.JSON,
+		Signature: params.Signature,
+		PublicKey: params.PublicKey,
+		ExtraData: params.Data.SignedTokenData,
+		Timestamp: params.Data.Timestamp,
+	}); resp != nil {
+		c.metrics.SignatureFailure(context, "getCancellationNotices", "user", resp)
+		return resp
+	}
+
+	token := params.Data.SignedTokenData.Data.Token
+
+	if notices, err := c.backend.CancellationNotices(token).GetAll(); err != nil {
+		services.Log.Error(err)
+		return context.InternalError()
+	} else {
+		return context.Result(notices)
+	}
+}
@@ -0,0 +1,252 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/impfen/services-inoeg"
+	"github.com/impfen/services-inoeg/crypto"
+	"github.com/impfen/services-inoeg/definitions"
+	"github.com/impfen/services-inoeg/helpers"
+	at "github.com/impfen/services-inoeg/testing"
+	af "github.com/impfen/services-inoeg/testing/fixtures"
+	"testing"
+	"time"
+)
+
+func TestRemoveBookedSlots(t *testing.T) {
+
+	var fixturesConfig = []at.FC{
+
+		// we create the settings
+		at.FC{af.Settings{Definitions: definitions.Default}, "settings"},
+
+		// we create the appointments API
+		at.FC{af.AppointmentsServer{}, "appointmentsServer"},
+
+		// we create a client (without a key)
+		at.FC{af.Client{}, "client"},
+
+		// we create a mediator
+		at.FC{af.Mediator{}, "mediator"},
+
+		// we create a provider
+		at.FC{af.Provider{
+			ZipCode:   "10707",
+			StoreData: true,
+			Confirm:   true,
+		}, "provider"},
+
+		at.FC{af.Appointments{
+			N:        1,
+			Start:    af.TS("2022-10-01T12:00:00Z"),
+			Duration: 30,
+			Slots:    3,
+			Properties: map[string]string{
+				"vaccine": "moderna",
+			},
+		}, "appointments"},
+
+		// we create a user with a token
+		at.FC{af.User{}, "user"},
+	}
+
+	fixtures, err := at.SetupFixtures(fixturesConfig)
+	defer at.TeardownFixtures(fixturesConfig, fixtures)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := fixtures["client"].(*helpers.Client)
+	provider := fixtures["provider"].(*helpers.Provider)
+	user := fixtures["user"].(*helpers.User)
+	appointment := fixtures["appointments"].([]*services.SignedAppointment)[0]
+
+	book := func(statusCode int) *services.Booking {
+
+		ephemeralKey, err := crypto.GenerateWebKey("ephemeral-user", "ecdh")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		encryptedData, err := ephemeralKey.Encrypt([]byte("test"), provider.Actor.EncryptionKey)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err := client.Appointments.BookAppointment(&services.BookAppointmentParams{
+			ProviderID:    crypto.Hash(provider.Actor.SigningKey.PublicKey),
+			ID:            appointment.Data.ID,
+			EncryptedData: encryptedData,
+			Timestamp:     time.Now(),
+		}, user)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.StatusCode != statusCode {
+			t.Fatalf("expected a %d status code, got %d instead", statusCode, resp.StatusCode)
+		}
+
+		if statusCode != 200 {
+			return nil
+		}
+
+		var result struct {
+			Result *services.Booking `json:"result"`
+		}
+
+		if data, err := resp.Bytes(); err != nil {
+			t.Fatal(err)
+		} else if err := json.Unmarshal(data, &result); err != nil {
+			t.Fatal(err)
+		}
+
+		return result.Result
+	}
+
+	publish := func(force bool, appointment *services.SignedAppointment) *services.PublishAppointmentResult {
+
+		resp, err := client.Appointments.PublishAppointmentsV2(&services.PublishAppointmentsParams{
+			Timestamp:    time.Now(),
+			Force:        force,
+			Appointments: []*services.SignedAppointment{appointment},
+		}, provider)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.StatusCode != 200 {
+			t.Fatalf("expected a 200 status code, got %d instead", resp.StatusCode)
+		}
+
+		var result struct {
+			Result []*services.PublishAppointmentResult `json:"result"`
+		}
+
+		if data, err := resp.Bytes(); err != nil {
+			t.Fatal(err)
+		} else if err := json.Unmarshal(data, &result); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(result.Result) != 1 {
+			t.Fatalf("expected one result, got %d", len(result.Result))
+		}
+
+		return result.Result[0]
+	}
+
+	booking := book(200)
+
+	// the token has been used, so the user cannot book another slot
+	book(401)
+
+	// we remove the booked slot from the appointment
+	updated := *appointment.Data
+	updated.SlotData = nil
+
+	for _, slot := range appointment.Data.SlotData {
+		if !bytes.Equal(slot.ID, booking.ID) {
+			updated.SlotData = append(updated.SlotData, slot)
+		}
+	}
+
+	if len(updated.SlotData) != 2 {
+		t.Fatalf("expected the booked slot to be one of the appointment slots")
+	}
+
+	signedAppointment, err := updated.Sign(provider.Actor.SigningKey)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// without force booked slots cannot be removed
+	if result := publish(false, signedAppointment); result.Status != services.AppointmentFailed || result.Error != services.ErrBookedSlotsRemoved.Code {
+		t.Fatalf("expected a %s error, got status %s (%s)", services.ErrBookedSlotsRemoved.Code, result.Status, result.Error)
+	}
+
+	// the user did not get a cancellation notice yet
+	if notices := getCancellationNotices(t, client, user); len(notices) != 0 {
+		t.Fatalf("expected no cancellation notices, got %d", len(notices))
+	}
+
+	// with force the slot is removed
+	if result := publish(true, signedAppointment); result.Status != services.AppointmentUpdated {
+		t.Fatalf("expected status %s, got %s (%s)", services.AppointmentUpdated, result.Status, result.Reason)
+	}
+
+	// the user is told about the cancellation
+	notices := getCancellationNotices(t, client, user)
+
+	if len(notices) != 1 {
+		t.Fatalf("expected one cancellation notice, got %d", len(notices))
+	}
+
+	notice := notices[0]
+
+	if !bytes.Equal(notice.SlotID, booking.ID) || !bytes.Equal(notice.AppointmentID, appointment.Data.ID) {
+		t.Fatalf("expected a cancellation notice for the removed slot")
+	}
+
+	if notice.Reason != services.SlotRemovedReason {
+		t.Fatalf("expected reason %s, got %s", services.SlotRemovedReason, notice.Reason)
+	}
+
+	// the token has been re-enabled, so the user can book one of the remaining
+	// slots again
+	if rebooking := book(200); bytes.Equal(rebooking.ID, booking.ID) {
+		t.Fatalf("expected a booking of one of the remaining slots")
+	}
+
+}
+
+func getCancellationNotices(t *testing.T, client *helpers.Client, user *helpers.User) []*services.CancellationNotice {
+
+	resp, err := client.Appointments.GetCancellationNotices(&services.GetCancellationNoticesParams{
+		Timestamp: time.Now(),
+	}, user)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d instead", resp.StatusCode)
+	}
+
+	var result struct {
+		Result []*services.CancellationNotice `json:"result"`
+	}
+
+	if data, err := resp.Bytes(); err != nil {
+		t.Fatal(err)
+	} else if err := json.Unmarshal(data, &result); err != nil {
+		t.Fatal(err)
+	}
+
+	return result.Result
+}
@@ -80,12 +80,14 @@ func (c *Appointments) priorityToken(
 func (c *Appointments) getToken(
 	context services.Context,
 	params *services.GetTokenParams,
-) services.Response {
+) (resp services.Response) {
+
+	defer func() { c.metrics.Observe(c.metrics.TokensIssued, "getToken", resp) }()
 
 	codes := c.backend.Codes("user")
 
-	tokenKey := c.settings.Key("token")
-	if tokenKey == nil {
+	tokenSigner := c.signer("token")
+	if tokenSigner == nil {
 		services.Log.Error("token key missing")
 		return context.InternalError()
 	}
@@ -93,7 +95,7 @@ func (c *Appointments) getToken(
 	var signedData *crypto.SignedStringData
 
 	if c.settings.UserCodesEnabled {
-		notAuthorized := context.Error(401, "not authorized", nil)
+		notAuthorized := context.Fail(services.ErrNotAuthorized, nil)
 		if params.Code == nil {
 			return notAuthorized
 		}
@@ -110,7 +112,7 @@ func (c *Appointments) getToken(
 	if data, jsonData, token, err := c.priorityToken(userID); err != nil {
 		services.Log.Error(err)
 		if err == maxTokensError {
-			context.Error(401, "maximum number of tokens exceeded", nil)
+			return context.Fail(services.ErrTooManyTokens, nil)
 		} else {
 			return context.InternalError()
 		}
@@ -130,7 +132,7 @@ func (c *Appointments) getToken(
 			return context.InternalError()
 		}
 
-		if signedData, err = tokenKey.SignString(string(td)); err != nil {
+		if signedData, err = tokenSigner.SignString(string(td)); err != nil {
 			services.Log.Error(err)
 			return context.InternalError()
 		}
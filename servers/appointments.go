@@ -20,10 +20,14 @@ package servers
 
 import (
 	"bytes"
+	"fmt"
 	"github.com/impfen/services-inoeg"
 	"github.com/impfen/services-inoeg/api"
 	"github.com/impfen/services-inoeg/crypto"
+	"github.com/impfen/services-inoeg/databases"
 	"github.com/impfen/services-inoeg/forms"
+	"github.com/impfen/services-inoeg/signer"
+	"sync"
 )
 
 // time windows for statistics generation
@@ -38,11 +42,21 @@ var tws = []services.TimeWindowFunc{
 
 type Appointments struct {
 	*Server
-	db       services.Database
-	backend  *AppointmentsBackend
-	meter    services.Meter
-	settings *services.AppointmentsSettings
-	test     bool
+	db           services.Database
+	backend      *AppointmentsBackend
+	meter        services.Meter
+	settings     *services.AppointmentsSettings
+	signers      map[string]*signer.Client
+	events       *Events
+	privacy      *StatsPrivacy
+	compactor    *MeterCompactor
+	webhooks     *WebhookDispatcher
+	pubSub       services.PubSub
+	availability *AvailabilitySubscriptions
+	stop         chan bool
+	stopOnce     sync.Once
+	metrics      *Metrics
+	test         bool
 }
 
 func MakeAppointments(settings *services.Settings) (*Appointments, error) {
@@ -52,10 +66,78 @@ func MakeAppointments(settings *services.Settings) (*Appointments, error) {
 		backend:  &AppointmentsBackend{db: settings.DatabaseObj},
 		meter:    settings.MeterObj,
 		settings: settings.Appointments,
+		signers:  make(map[string]*signer.Client),
+		events:   MakeEvents(10000),
+		stop:     make(chan bool),
+		metrics:  MakeMetrics("appointments"),
 		test:     settings.Test,
 	}
 
-	api := &api.API{
+	if settings.Appointments.StatsPrivacy != nil {
+		appointments.privacy = MakeStatsPrivacy(settings.Appointments.StatsPrivacy)
+	}
+
+	if pubSub, ok := settings.DatabaseObj.(services.PubSub); ok {
+		appointments.pubSub = pubSub
+	} else {
+		// updates will only reach subscribers on this server instance
+		appointments.pubSub = databases.MakeInMemoryPubSub()
+	}
+
+	appointments.events.AddHandler(MakeAppointmentUpdates(appointments.pubSub))
+	appointments.availability = MakeAvailabilitySubscriptions(appointments.pubSub, availabilityUpdateInterval)
+
+	if settings.Appointments.Webhooks != nil {
+		if webhooks, err := MakeWebhookDispatcher(
+			settings.Appointments.Webhooks,
+			settings.Appointments.Keys,
+			appointments.backend.Webhooks(),
+		); err != nil {
+			return nil, err
+		} else {
+			appointments.webhooks = webhooks
+			appointments.events.AddHandler(webhooks)
+		}
+	}
+
+	if settings.MeterObj != nil {
+		appointments.events.AddHandler(MakeStatsAggregator(settings.MeterObj))
+		if settings.Meter != nil && settings.Meter.Retention != nil {
+			appointments.compactor = MakeMeterCompactor(settings.MeterObj, settings.DatabaseObj, settings.Meter.Retention)
+		}
+	}
+
+	// keys that are held by the signing daemon
+	if settings.Appointments.Signer != nil {
+		for _, name := range settings.Appointments.Signer.Keys {
+			// we need the public key to verify the keys held by the daemon
+			key := settings.Appointments.Key(name)
+			if key == nil {
+				return nil, fmt.Errorf("public key for remote signer key '%s' missing", name)
+			}
+			appointments.signers[name] = signer.MakeClient(settings.Appointments.Signer.Socket, name, key.PublicKey)
+		}
+	}
+
+	api := appointments.makeAPI()
+
+	var err error
+
+	if appointments.Server, err = MakeServer("appointments", settings.Appointments.HTTP, settings.Appointments.JSONRPC, settings.Appointments.REST, settings.Appointments.Validate, api); err != nil {
+		return nil, err
+	}
+
+	return appointments, nil
+}
+
+// Returns the definition of the appointments API. Handlers may only be called if the
+// server was created via MakeAppointments.
+func AppointmentsAPI() *api.API {
+	return (&Appointments{}).makeAPI()
+}
+
+func (c *Appointments) makeAPI() *api.API {
+	return &api.API{
 		Version: 1,
 		Name:    "appointments",
 		Endpoints: []*api.Endpoint{
@@ -63,8 +145,9 @@ func MakeAppointments(settings *services.Settings) (*Appointments, error) {
 				Name:        "getStats", // unauthenticated
 				Description: "Returns various public statistics related to the system.",
 				Form:        &forms.GetStatsForm,
-				Handler:     appointments.getStats,
+				Handler:     c.getStats,
 				ReturnType: &api.ReturnType{
+					Type:       []*services.StatsValue{},
 					Validators: forms.GetStatsRVV,
 				},
 				REST: &api.REST{
@@ -72,12 +155,26 @@ func MakeAppointments(settings *services.Settings) (*Appointments, error) {
 					Method: api.GET,
 				},
 			},
+			{
+				Name:        "exportStats", // unauthenticated
+				Description: "Returns the public statistics in CSV format.",
+				Form:        &forms.GetStatsForm,
+				Handler:     c.exportStats,
+				ReturnType: &api.ReturnType{
+					Type: &services.RawResult{},
+				},
+				REST: &api.REST{
+					Path:   "stats/export",
+					Method: api.GET,
+				},
+			},
 			{
 				Name:        "getKeys", // unauthenticated
 				Description: "Returns various required public keys. Please note that you should have an independent verification mechanism for these keys and not blindly trust the ones provided by this API.",
 				Form:        &forms.GetKeysForm,
-				Handler:     appointments.getKeys,
+				Handler:     c.getKeys,
 				ReturnType: &api.ReturnType{
+					Type:       &services.Keys{},
 					Validators: forms.GetKeysRVV,
 				},
 				REST: &api.REST{
@@ -89,8 +186,9 @@ func MakeAppointments(settings *services.Settings) (*Appointments, error) {
 				Name:        "getConfigurables", // unauthenticated
 				Description: "returns configuration variables regarding filters",
 				Form:        &forms.GetConfigurablesForm,
-				Handler:     appointments.getConfigurables,
+				Handler:     c.getConfigurables,
 				ReturnType: &api.ReturnType{
+					Type:       &services.ValidateSettings{},
 					Validators: forms.GetConfigurablesRVV,
 				},
 				REST: &api.REST{
@@ -102,8 +200,9 @@ func MakeAppointments(settings *services.Settings) (*Appointments, error) {
 				Name:        "getAppointmentsAggregated", // unauthenticated
 				Description: "Returns available appointments for a given zip code area.",
 				Form:        &forms.GetAppointmentsAggregatedForm,
-				Handler:     appointments.getAppointmentsAggregated,
+				Handler:     c.getAppointmentsAggregated,
 				ReturnType: &api.ReturnType{
+					Type:       []*services.AggregatedProviderAppointments{},
 					Validators: forms.GetAppointmentsAggregatedRVV,
 				},
 				REST: &api.REST{
@@ -115,8 +214,9 @@ func MakeAppointments(settings *services.Settings) (*Appointments, error) {
 				Name:        "getAppointmentsByZipCode", // unauthenticated
 				Description: "Returns available appointments for a given zip code area.",
 				Form:        &forms.GetAppointmentsByZipCodeForm,
-				Handler:     appointments.getAppointmentsByZipCode,
+				Handler:     c.getAppointmentsByZipCode,
 				ReturnType: &api.ReturnType{
+					Type:       []*services.ProviderAppointments{},
 					Validators: forms.GetAppointmentsByZipCodeRVV,
 				},
 				REST: &api.REST{
@@ -124,12 +224,23 @@ func MakeAppointments(settings *services.Settings) (*Appointments, error) {
 					Method: api.GET,
 				},
 			},
+			{
+				Name:        "subscribeAvailability", // unauthenticated
+				Description: "Sends 'availabilityUpdate' notifications (at most once per minute) when new appointments are published in the given zip code area. Requires a WebSocket connection.",
+				Form:        &forms.SubscribeAvailabilityForm,
+				Handler:     c.subscribeAvailability,
+				ReturnType: &api.ReturnType{
+					Type:       "",
+					Validators: forms.IsAcknowledgeRVV,
+				},
+			},
 			{
 				Name:        "getProvidersByZipCode", // unauthenticated
 				Description: "Returns verified providers for a given zip code area.",
 				Form:        &forms.GetProvidersByZipCodeForm,
-				Handler:     appointments.getProvidersByZipCode,
+				Handler:     c.getProvidersByZipCode,
 				ReturnType: &api.ReturnType{
+					Type:       []*services.SignedProviderData{},
 					Validators: forms.GetProvidersByZipCodeRVV,
 				},
 				REST: &api.REST{
@@ -141,8 +252,9 @@ func MakeAppointments(settings *services.Settings) (*Appointments, error) {
 				Name:        "getAppointment", // unauthenticated
 				Description: "Returns details about a specific appointment.",
 				Form:        &forms.GetAppointmentForm,
-				Handler:     appointments.getAppointment,
+				Handler:     c.getAppointment,
 				ReturnType: &api.ReturnType{
+					Type:       &services.ProviderAppointments{},
 					Validators: forms.GetAppointmentRVV,
 				},
 				REST: &api.REST{
@@ -154,8 +266,9 @@ func MakeAppointments(settings *services.Settings) (*Appointments, error) {
 				Name:        "getToken", // unauthenticated
 				Description: "Returns a signed token that allows users to book appointments.",
 				Form:        &forms.GetTokenForm,
-				Handler:     appointments.getToken,
+				Handler:     c.getToken,
 				ReturnType: &api.ReturnType{
+					Type:       &crypto.SignedStringData{},
 					Validators: forms.GetTokenRVV,
 				},
 				REST: &api.REST{
@@ -167,8 +280,9 @@ func MakeAppointments(settings *services.Settings) (*Appointments, error) {
 				Name:        "addMediatorPublicKeys", // authenticted (root)
 				Description: "Adds the public key data and associated information of a mediator to the system.",
 				Form:        &forms.AddMediatorPublicKeysForm,
-				Handler:     appointments.addMediatorPublicKeys,
+				Handler:     c.addMediatorPublicKeys,
 				ReturnType: &api.ReturnType{
+					Type:       "",
 					Validators: forms.IsAcknowledgeRVV,
 				},
 				REST: &api.REST{
@@ -176,12 +290,27 @@ func MakeAppointments(settings *services.Settings) (*Appointments, error) {
 					Method: api.POST,
 				},
 			},
+			{
+				Name:        "getEvents", // authenticated (root)
+				Description: "Returns the domain events that occurred after the given cursor.",
+				Form:        &forms.GetEventsForm,
+				Handler:     c.getEvents,
+				ReturnType: &api.ReturnType{
+					Type:       &services.EventsFeed{},
+					Validators: forms.GetEventsRVV,
+				},
+				REST: &api.REST{
+					Path:   "events",
+					Method: api.POST,
+				},
+			},
 			{
 				Name:        "addCodes", // authenticated (root)
 				Description: "Adds signup codes to the system.",
 				Form:        &forms.AddCodesForm,
-				Handler:     appointments.addCodes,
+				Handler:     c.addCodes,
 				ReturnType: &api.ReturnType{
+					Type:       "",
 					Validators: forms.IsAcknowledgeRVV,
 				},
 				REST: &api.REST{
@@ -193,8 +322,9 @@ func MakeAppointments(settings *services.Settings) (*Appointments, error) {
 				Name:        "uploadDistances", // authenticated (root)
 				Description: "Uploads distance information to the system.",
 				Form:        &forms.UploadDistancesForm,
-				Handler:     appointments.uploadDistances,
+				Handler:     c.uploadDistances,
 				ReturnType: &api.ReturnType{
+					Type:       "",
 					Validators: forms.IsAcknowledgeRVV,
 				},
 				REST: &api.REST{
@@ -206,8 +336,9 @@ func MakeAppointments(settings *services.Settings) (*Appointments, error) {
 				Name:        "resetDB", // authenticated (root)
 				Description: "Resets the database. This endpoint is only active for test deployments.",
 				Form:        &forms.ResetDBForm,
-				Handler:     appointments.resetDB,
+				Handler:     c.resetDB,
 				ReturnType: &api.ReturnType{
+					Type:       "",
 					Validators: forms.IsAcknowledgeRVV,
 				},
 				REST: &api.REST{
@@ -219,8 +350,9 @@ func MakeAppointments(settings *services.Settings) (*Appointments, error) {
 				Name:        "isValidMediator", // authenticated (provider)
 				Description: "Validates the mediator signature",
 				Form:        &forms.SignedTimestampForm,
-				Handler:     appointments.isValidMediator,
+				Handler:     c.isValidMediator,
 				ReturnType: &api.ReturnType{
+					Type:       false,
 					Validators: forms.IsBooleanRVV,
 				},
 				REST: &api.REST{
@@ -232,8 +364,9 @@ func MakeAppointments(settings *services.Settings) (*Appointments, error) {
 				Name:        "confirmProvider", // authenticated (mediator)
 				Description: "Confirms a provider by adding its public key data and associated information to the system.",
 				Form:        &forms.ConfirmProviderForm,
-				Handler:     appointments.confirmProvider,
+				Handler:     c.confirmProvider,
 				ReturnType: &api.ReturnType{
+					Type:       "",
 					Validators: forms.IsAcknowledgeRVV,
 				},
 				REST: &api.REST{
@@ -245,8 +378,9 @@ func MakeAppointments(settings *services.Settings) (*Appointments, error) {
 				Name:        "getProviders", // authenticated (mediator)
 				Description: "Returns the provider data for all providers",
 				Form:        &forms.GetProvidersDataForm,
-				Handler:     appointments.getProviders,
+				Handler:     c.getProviders,
 				ReturnType:  &api.ReturnType{
+					Type:       []*services.RawProviderData{},
 					Validators: forms.GetProviderDataRVV,
 				},
 				REST: &api.REST{
@@ -258,8 +392,9 @@ func MakeAppointments(settings *services.Settings) (*Appointments, error) {
 				Name:        "getProviderData", // authenticated (mediator)
 				Description: "Returns the provider data for the given provider id",
 				Form:        &forms.GetProviderDataForm,
-				Handler:     appointments.getProviderData,
+				Handler:     c.getProviderData,
 				ReturnType:  &api.ReturnType{
+					Type:       &services.GetProviderResult{},
 					Validators: forms.GetSingleProviderDataRVV,
 				},
 				REST: &api.REST{
@@ -271,8 +406,9 @@ func MakeAppointments(settings *services.Settings) (*Appointments, error) {
 				Name:        "getPendingProviderData", // authenticated (mediator)
 				Description: "Returns a list of provider data waiting for confirmation.",
 				Form:        &forms.GetProvidersDataForm,
-				Handler:     appointments.getPendingProviderData,
+				Handler:     c.getPendingProviderData,
 				ReturnType:  &api.ReturnType{
+					Type:       []*services.RawProviderData{},
 					Validators: forms.GetProviderDataRVV,
 				},
 				REST: &api.REST{
@@ -284,8 +420,9 @@ func MakeAppointments(settings *services.Settings) (*Appointments, error) {
 				Name:        "getVerifiedProviderData", // authenticated (mediator)
 				Description: "Returns a list of confirmed provider data.",
 				Form:        &forms.GetProvidersDataForm,
-				Handler:     appointments.getVerifiedProviderData,
+				Handler:     c.getVerifiedProviderData,
 				ReturnType:  &api.ReturnType{
+					Type:       []*services.RawProviderData{},
 					Validators: forms.GetProviderDataRVV,
 				},
 				REST: &api.REST{
@@ -297,8 +434,9 @@ func MakeAppointments(settings *services.Settings) (*Appointments, error) {
 				Name:        "isValidProvider", // authenticated (provider)
 				Description: "Checks the verification status of provider data.",
 				Form:        &forms.SignedTimestampForm,
-				Handler:     appointments.isValidProvider,
+				Handler:     c.isValidProvider,
 				ReturnType:  &api.ReturnType{
+					Type:       false,
 					Validators: forms.IsBooleanRVV,
 				},
 				REST: &api.REST{
@@ -310,8 +448,9 @@ func MakeAppointments(settings *services.Settings) (*Appointments, error) {
 				Name:        "isValidatedProvider", // authenticated (provider)
 				Description: "Checks the verification status of provider data.",
 				Form:        &forms.SignedTimestampForm,
-				Handler:     appointments.isValidatedProvider,
+				Handler:     c.isValidatedProvider,
 				ReturnType:  &api.ReturnType{
+					Type:       false,
 					Validators: forms.IsBooleanRVV,
 				},
 				REST: &api.REST{
@@ -323,8 +462,9 @@ func MakeAppointments(settings *services.Settings) (*Appointments, error) {
 				Name:        "getProviderAppointmentsByProperty", // authenticated (provider)
 				Description: "Returns a list of appointments for the given provider.",
 				Form:        &forms.GetProviderAppointmentsByPropertyForm,
-				Handler:     appointments.getProviderAppointmentsByProperty,
+				Handler:     c.getProviderAppointmentsByProperty,
 				ReturnType: &api.ReturnType{
+					Type:       &services.ProviderAppointments{},
 					Validators: forms.GetProviderAppointmentsByPropertyRVV,
 				},
 				REST: &api.REST{
@@ -336,8 +476,9 @@ func MakeAppointments(settings *services.Settings) (*Appointments, error) {
 				Name:        "getProviderAppointments", // authenticated (provider)
 				Description: "Returns a list of appointments for the given provider.",
 				Form:        &forms.GetProviderAppointmentsForm,
-				Handler:     appointments.getProviderAppointments,
+				Handler:     c.getProviderAppointments,
 				ReturnType: &api.ReturnType{
+					Type:       &services.ProviderAppointments{},
 					Validators: forms.GetProviderAppointmentsRVV,
 				},
 				REST: &api.REST{
@@ -345,12 +486,27 @@ func MakeAppointments(settings *services.Settings) (*Appointments, error) {
 					Method: api.POST,
 				},
 			},
+			{
+				Name:        "streamProviderAppointments", // authenticated (provider)
+				Description: "Streams the IDs of updated appointments of the provider as server-sent events.",
+				Form:        &forms.StreamProviderAppointmentsForm,
+				Handler:     c.streamProviderAppointments,
+				ReturnType: &api.ReturnType{
+					Type: &services.StreamResult{},
+				},
+				REST: &api.REST{
+					Path:   "appointments/stream",
+					Method: api.GET,
+				},
+			},
 			{
 				Name:        "publishAppointments", // authenticated (provider)
 				Description: "Publishes new or modified appointments to the system.",
 				Form:        &forms.PublishAppointmentsForm,
-				Handler:     appointments.publishAppointments,
+				Handler:     c.publishAppointments(1),
+				Versions:    []int{1},
 				ReturnType: &api.ReturnType{
+					Type:       "",
 					Validators: forms.IsAcknowledgeRVV,
 				},
 				REST: &api.REST{
@@ -358,12 +514,28 @@ func MakeAppointments(settings *services.Settings) (*Appointments, error) {
 					Method: api.POST,
 				},
 			},
+			{
+				Name:        "publishAppointments", // authenticated (provider)
+				Description: "Publishes new or modified appointments to the system and returns the status of every appointment. Unlike version 1, appointments must be signed by the publishing provider, duplicate IDs are rejected and a failing appointment does not stop the others.",
+				Form:        &forms.PublishAppointmentsForm,
+				Handler:     c.publishAppointments(2),
+				Versions:    []int{2},
+				ReturnType: &api.ReturnType{
+					Type:       []*services.PublishAppointmentResult{},
+					Validators: forms.PublishAppointmentsRVV,
+				},
+				REST: &api.REST{
+					Path:   "appointments/publish",
+					Method: api.POST,
+				},
+			},
 			{
 				Name:        "storeProviderData", // authenticated (provider)
 				Description: "Stores provider data for verification.",
 				Form:        &forms.StoreProviderDataForm,
-				Handler:     appointments.storeProviderData,
+				Handler:     c.storeProviderData,
 				ReturnType: &api.ReturnType{
+					Type:       "",
 					Validators: forms.IsAcknowledgeRVV,
 				},
 				REST: &api.REST{
@@ -375,8 +547,9 @@ func MakeAppointments(settings *services.Settings) (*Appointments, error) {
 				Name:        "checkProviderData", // authenticated (provider)
 				Description: "Checks the verification status of provider data.",
 				Form:        &forms.SignedTimestampForm,
-				Handler:     appointments.checkProviderData,
+				Handler:     c.checkProviderData,
 				ReturnType: &api.ReturnType{
+					Type:       &services.ConfirmedProviderData{},
 					Validators: forms.CheckProviderDataRVV,
 				},
 				REST: &api.REST{
@@ -388,8 +561,9 @@ func MakeAppointments(settings *services.Settings) (*Appointments, error) {
 				Name:        "checkProviderStatus", // authenticated (provider)
 				Description: "returns the current status of the provider",
 				Form:        &forms.SignedTimestampForm,
-				Handler:     appointments.checkProviderStatus,
+				Handler:     c.checkProviderStatus,
 				ReturnType:  &api.ReturnType{
+					Type:       "",
 					Validators: forms.IsStringRVV,
 				},
 				REST: &api.REST{
@@ -401,8 +575,9 @@ func MakeAppointments(settings *services.Settings) (*Appointments, error) {
 				Name:        "bookAppointment", // authenticated (user)
 				Description: "Books an appointment.",
 				Form:        &forms.BookAppointmentForm,
-				Handler:     appointments.bookAppointment,
+				Handler:     c.bookAppointment,
 				ReturnType: &api.ReturnType{
+					Type:       &services.Booking{},
 					Validators: forms.BookAppointmentRVV,
 				},
 				REST: &api.REST{
@@ -414,8 +589,9 @@ func MakeAppointments(settings *services.Settings) (*Appointments, error) {
 				Name:        "cancelAppointment", // authenticated (user)
 				Description: "Cancels a booking.",
 				Form:        &forms.CancelAppointmentForm,
-				Handler:     appointments.cancelAppointment,
+				Handler:     c.cancelAppointment,
 				ReturnType: &api.ReturnType{
+					Type:       "",
 					Validators: forms.IsAcknowledgeRVV,
 				},
 				REST: &api.REST{
@@ -423,12 +599,27 @@ func MakeAppointments(settings *services.Settings) (*Appointments, error) {
 					Method: api.DELETE,
 				},
 			},
+			{
+				Name:        "getCancellationNotices", // authenticated (user)
+				Description: "Returns the bookings of the user that have been cancelled because the provider removed the booked slot.",
+				Form:        &forms.GetCancellationNoticesForm,
+				Handler:     c.getCancellationNotices,
+				ReturnType: &api.ReturnType{
+					Type:       []*services.CancellationNotice{},
+					Validators: forms.GetCancellationNoticesRVV,
+				},
+				REST: &api.REST{
+					Path:   "appointments/cancellations",
+					Method: api.POST,
+				},
+			},
 			{
 				Name:        "isValidUser", // authenticated (user)
 				Description: "Validates the user token signature",
 				Form:        &forms.ValidateUserForm,
-				Handler:     appointments.isValidUser,
+				Handler:     c.isValidUser,
 				ReturnType: &api.ReturnType{
+					Type:       false,
 					Validators: forms.IsBooleanRVV,
 				},
 				REST: &api.REST{
@@ -438,14 +629,52 @@ func MakeAppointments(settings *services.Settings) (*Appointments, error) {
 			},
 		},
 	}
+}
 
-	var err error
-
-	if appointments.Server, err = MakeServer("appointments", settings.Appointments.HTTP, settings.Appointments.JSONRPC, settings.Appointments.REST, settings.Appointments.Validate, api); err != nil {
-		return nil, err
+func (c *Appointments) Start() error {
+	if err := c.metrics.Register(); err != nil {
+		return err
+	}
+	c.events.Start()
+	if c.compactor != nil {
+		c.compactor.Start()
+	}
+	if c.webhooks != nil {
+		if err := c.webhooks.metrics.Register(); err != nil {
+			return err
+		}
+		c.webhooks.Start()
+	}
+	for name, remoteSigner := range c.signers {
+		// the daemon might not be up yet, clients verify the key again
+		// whenever they (re)connect, so we only log the error here
+		if err := remoteSigner.Verify(); err != nil {
+			services.Log.Errorf("cannot verify remote signer key '%s': %v", name, err)
+		}
 	}
+	return c.Server.Start()
+}
 
-	return appointments, nil
+func (c *Appointments) Stop() error {
+	// we close open streams, as the HTTP server waits for them to finish,
+	// streams that start afterwards end immediately
+	c.stopOnce.Do(func() { close(c.stop) })
+	err := c.Server.Stop()
+	c.availability.Stop()
+	if c.compactor != nil {
+		c.compactor.Stop()
+	}
+	if c.webhooks != nil {
+		c.webhooks.Stop()
+		c.webhooks.metrics.Unregister()
+	}
+	for _, remoteSigner := range c.signers {
+		remoteSigner.Close()
+	}
+	// we process the remaining events before returning
+	c.events.Stop()
+	c.metrics.Unregister()
+	return err
 }
 
 // Method Handlers
@@ -474,6 +703,18 @@ func (c *Appointments) getActorKeys() (*services.KeyLists, error) {
 	}, nil
 }
 
+// returns the signer for the given key, which is either the signing daemon
+// or the (local) key itself
+func (c *Appointments) signer(name string) crypto.Signer {
+	if remoteSigner, ok := c.signers[name]; ok {
+		return remoteSigner
+	}
+	if key := c.settings.Key(name); key != nil {
+		return key
+	}
+	return nil
+}
+
 // authentication helpers
 
 func (c *Appointments) isUser(context services.Context, params *services.SignedParams) services.Response {
@@ -497,12 +738,12 @@ func (c *Appointments) isUser(context services.Context, params *services.SignedP
 		services.Log.Error(err)
 		return context.InternalError()
 	} else if !ok {
-		return context.Error(400, "invalid token", nil)
+		return context.Fail(services.ErrInvalidToken, nil)
 	}
 
 	// then we ensure the public key matches the key from the signed token data
 	if !bytes.Equal(signedTokenData.Data.PublicKey, params.PublicKey) {
-		return context.Error(400, "invalid key", nil)
+		return context.Fail(services.ErrInvalidKey, nil)
 	}
 
 	// then we verify the data was signed with the same key
@@ -510,11 +751,11 @@ func (c *Appointments) isUser(context services.Context, params *services.SignedP
 		services.Log.Error(err)
 		return context.InternalError()
 	} else if !ok {
-		return context.Error(400, "invalid signature", nil)
+		return context.Fail(services.ErrInvalidSignature, nil)
 	}
 
 	if expired(params.Timestamp) {
-		return context.Error(410, "signature expired", nil)
+		return context.Fail(services.ErrSignatureExpired, nil)
 	}
 
 	return nil
@@ -537,7 +778,7 @@ func (c *Appointments) isMediator(context services.Context, params *services.Sig
 	if resp, key := c.isValidActorSignature(context, []byte(params.JSON), params.Signature, params.PublicKey, keys.Mediators); resp != nil {
 		return resp, nil
 	} else if expired(params.Timestamp) {
-		return context.Error(410, "signature expired", nil), nil
+		return context.Fail(services.ErrSignatureExpired, nil), nil
 	} else {
 		return nil, key
 	}
@@ -549,7 +790,7 @@ func (c *Appointments) isPendingProvider(
 ) (services.Response) {
 
 	if expired(params.Timestamp) {
-		return context.Error(410, "signature expired", nil)
+		return context.Fail(services.ErrSignatureExpired, nil)
 	}
 
 	providerID := crypto.Hash(params.PublicKey)
@@ -570,7 +811,7 @@ func (c *Appointments) isPendingProvider(
 	}
 
 	if !found {
-		return context.Error(401, "not authorized", nil)
+		return context.Fail(services.ErrNotAuthorized, nil)
 	}
 
 	if ok, err := crypto.VerifyWithBytes(
@@ -581,7 +822,7 @@ func (c *Appointments) isPendingProvider(
 		services.Log.Error(err)
 		return context.InternalError()
 	} else if !ok {
-		return context.Error(403, "invalid signature", nil)
+		return context.Fail(services.ErrInvalidSignature, nil)
 	} else {
 		return nil
 	}
@@ -594,7 +835,7 @@ func (c *Appointments) isProvider(
 ) (services.Response, *services.ActorKey) {
 
 	if expired(params.Timestamp) {
-		return context.Error(410, "signature expired", nil), nil
+		return context.Fail(services.ErrSignatureExpired, nil), nil
 	}
 
 	keys, err := c.getActorKeys()
@@ -627,14 +868,14 @@ func (c *Appointments) isValidActorSignature(context services.Context, data, sig
 	}
 
 	if actorKey == nil {
-		return context.Error(401, "not authorized", nil), nil
+		return context.Fail(services.ErrNotAuthorized, nil), nil
 	}
 
 	if ok, err := crypto.VerifyWithBytes(data, signature, publicKey); err != nil {
 		services.Log.Error(err)
 		return context.InternalError(), nil
 	} else if !ok {
-		return context.Error(403, "invalid signature", nil), nil
+		return context.Fail(services.ErrInvalidSignature, nil), nil
 	}
 
 	return nil, actorKey
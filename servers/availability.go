@@ -0,0 +1,197 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"encoding/json"
+	"github.com/impfen/services-inoeg"
+	"sync"
+	"time"
+)
+
+// the maximum number of availability subscriptions per connection
+const maxAvailabilitySubscriptions = 5
+
+// subscribers are notified at most once per interval
+const availabilityUpdateInterval = time.Minute
+
+// AvailabilitySubscriptions fans out the availability updates of a single
+// pub/sub subscription to all subscribed connections. Subscribers are told
+// at most once per interval that the availability in their area changed, so
+// that they cannot follow the activity of individual providers.
+type AvailabilitySubscriptions struct {
+	pubSub       services.PubSub
+	interval     time.Duration
+	mutex        sync.Mutex
+	subscription services.Subscription
+	subscribers  map[*availabilitySubscriber]bool
+	connections  map[interface{}]int
+	changed      map[string]bool
+}
+
+type availabilitySubscriber struct {
+	zipCode  string
+	zipCodes map[string]bool
+	context  services.NotifyingContext
+}
+
+func MakeAvailabilitySubscriptions(pubSub services.PubSub, interval time.Duration) *AvailabilitySubscriptions {
+	return &AvailabilitySubscriptions{
+		pubSub:      pubSub,
+		interval:    interval,
+		subscribers: make(map[*availabilitySubscriber]bool),
+		connections: make(map[interface{}]int),
+		changed:     make(map[string]bool),
+	}
+}
+
+// Subscribes the connection to changes in the given zip codes, the updates
+// refer to the given zip code
+func (a *AvailabilitySubscriptions) Subscribe(context services.NotifyingContext, zipCode string, zipCodes map[string]bool) error {
+
+	subscriber := &availabilitySubscriber{
+		zipCode:  zipCode,
+		zipCodes: zipCodes,
+		context:  context,
+	}
+
+	key := context.ConnectionKey()
+
+	a.mutex.Lock()
+
+	if a.connections[key] >= maxAvailabilitySubscriptions {
+		a.mutex.Unlock()
+		return services.ErrTooManySubscriptions
+	}
+
+	if a.subscription == nil {
+		// all subscribers share a single subscription
+		subscription, err := a.pubSub.Subscribe(availabilityChannel)
+		if err != nil {
+			a.mutex.Unlock()
+			return err
+		}
+		a.subscription = subscription
+		go a.loop(subscription)
+	}
+
+	a.subscribers[subscriber] = true
+	a.connections[key]++
+
+	a.mutex.Unlock()
+
+	// this might call the function right away if the connection is closed
+	context.OnClose(func() { a.unsubscribe(subscriber, key) })
+
+	return nil
+}
+
+func (a *AvailabilitySubscriptions) unsubscribe(subscriber *availabilitySubscriber, key interface{}) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if !a.subscribers[subscriber] {
+		return
+	}
+	delete(a.subscribers, subscriber)
+	if a.connections[key]--; a.connections[key] <= 0 {
+		delete(a.connections, key)
+	}
+	if len(a.subscribers) == 0 {
+		a.close()
+	}
+}
+
+// must be called with the mutex held
+func (a *AvailabilitySubscriptions) close() {
+	if a.subscription != nil {
+		a.subscription.Close()
+		a.subscription = nil
+	}
+	a.changed = make(map[string]bool)
+}
+
+// Closes the shared subscription, subscribers are not notified anymore
+func (a *AvailabilitySubscriptions) Stop() {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.subscribers = make(map[*availabilitySubscriber]bool)
+	a.connections = make(map[interface{}]int)
+	a.close()
+}
+
+func (a *AvailabilitySubscriptions) loop(subscription services.Subscription) {
+
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	messages := subscription.Messages()
+
+	for {
+		select {
+		case message, ok := <-messages:
+			if !ok {
+				// the subscription was closed
+				return
+			}
+			update := &services.AvailabilityUpdate{}
+			if err := json.Unmarshal(message, update); err != nil {
+				services.Log.Error(err)
+				continue
+			}
+			a.mutex.Lock()
+			a.changed[update.ZipCode] = true
+			a.mutex.Unlock()
+		case <-ticker.C:
+			a.notify()
+		}
+	}
+}
+
+// notifies all subscribers whose area contains a changed zip code
+func (a *AvailabilitySubscriptions) notify() {
+
+	a.mutex.Lock()
+
+	changed := a.changed
+	a.changed = make(map[string]bool)
+
+	subscribers := make([]*availabilitySubscriber, 0)
+
+	for subscriber := range a.subscribers {
+		for zipCode := range changed {
+			if subscriber.zipCodes[zipCode] {
+				subscribers = append(subscribers, subscriber)
+				break
+			}
+		}
+	}
+
+	a.mutex.Unlock()
+
+	now := time.Now().UTC()
+
+	for _, subscriber := range subscribers {
+		// a slow connection should not hold up the others, closed connections
+		// unsubscribe via their close handler
+		go subscriber.context.Notify("availabilityUpdate", &services.AvailabilityUpdate{
+			ZipCode:   subscriber.zipCode,
+			Timestamp: now,
+		})
+	}
+}
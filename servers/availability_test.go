@@ -0,0 +1,147 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"encoding/json"
+	"github.com/impfen/services-inoeg"
+	"github.com/impfen/services-inoeg/databases"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testConnection struct {
+	mutex         sync.Mutex
+	notifications chan interface{}
+	closeHandlers []func()
+}
+
+type testNotifyingContext struct {
+	services.Context
+	connection *testConnection
+}
+
+func (t *testNotifyingContext) Notify(method string, params interface{}) error {
+	t.connection.notifications <- params
+	return nil
+}
+
+func (t *testNotifyingContext) OnClose(handler func()) {
+	t.connection.mutex.Lock()
+	defer t.connection.mutex.Unlock()
+	t.connection.closeHandlers = append(t.connection.closeHandlers, handler)
+}
+
+func (t *testNotifyingContext) ConnectionKey() interface{} {
+	return t.connection
+}
+
+func (t *testConnection) close() {
+	t.mutex.Lock()
+	handlers := t.closeHandlers
+	t.mutex.Unlock()
+	for _, handler := range handlers {
+		handler()
+	}
+}
+
+func TestAvailabilitySubscriptions(t *testing.T) {
+
+	pubSub := databases.MakeInMemoryPubSub()
+	updates := MakeAppointmentUpdates(pubSub)
+	availability := MakeAvailabilitySubscriptions(pubSub, 10*time.Millisecond)
+
+	defer availability.Stop()
+
+	connection := &testConnection{notifications: make(chan interface{}, 10)}
+	context := &testNotifyingContext{connection: connection}
+
+	for i := 0; i < maxAvailabilitySubscriptions; i++ {
+		if err := availability.Subscribe(context, "10707", map[string]bool{"10707": true, "10709": true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := availability.Subscribe(context, "10707", map[string]bool{"10707": true}); err != services.ErrTooManySubscriptions {
+		t.Fatalf("expected the number of subscriptions to be limited")
+	}
+
+	publish := func(eventType, zipCode string) {
+		data, _ := json.Marshal(&services.AvailabilityUpdate{ZipCode: zipCode})
+		if eventType != "" {
+			// we go through the event handler
+			if err := updates.HandleEvent(&services.Event{
+				Type:      eventType,
+				Timestamp: time.Now(),
+				Data: map[string]interface{}{
+					"provider":    "abcd",
+					"appointment": "1234",
+					"zipCode":     zipCode,
+				},
+			}); err != nil {
+				t.Fatal(err)
+			}
+		} else if err := pubSub.Publish(availabilityChannel, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// bookings are not published to anonymous subscribers
+	publish(services.AppointmentBookedEvent, "10709")
+
+	select {
+	case <-connection.notifications:
+		t.Fatalf("expected no notification for a booking")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// changes are only sent once per interval and subscriber
+	publish("", "10709")
+	publish("", "10709")
+	publish("", "99999")
+
+	received := 0
+
+	for received < maxAvailabilitySubscriptions {
+		select {
+		case notification := <-connection.notifications:
+			if update := notification.(*services.AvailabilityUpdate); update.ZipCode != "10707" {
+				t.Fatalf("expected the subscribed zip code, got %s", update.ZipCode)
+			}
+			received++
+		case <-time.After(time.Second):
+			t.Fatalf("expected a notification for every subscription")
+		}
+	}
+
+	select {
+	case <-connection.notifications:
+		t.Fatalf("expected a single notification per subscription")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// closing the connection frees its subscriptions
+	connection.close()
+
+	if err := availability.Subscribe(context, "10707", map[string]bool{"10707": true}); err != nil {
+		t.Fatal(err)
+	}
+
+}
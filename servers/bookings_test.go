@@ -0,0 +1,159 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"bytes"
+	"github.com/impfen/services-inoeg"
+	"testing"
+	"time"
+)
+
+// a database that only supports the outbox
+type memoryOutboxDatabase struct {
+	services.Database
+	events *memorySortedSet
+	seq    *memoryInteger
+}
+
+func (m *memoryOutboxDatabase) SortedSet(table string, key []byte) services.SortedSet {
+	return m.events
+}
+
+func (m *memoryOutboxDatabase) Integer(table string, key []byte) services.Integer {
+	return m.seq
+}
+
+func TestSplitBookings(t *testing.T) {
+
+	appointment, err := services.MakeAppointment(time.Now(), 3, 30)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	slots := appointment.SlotData
+
+	existing := &services.SignedAppointment{
+		Data: appointment,
+		Bookings: []*services.Booking{
+			{ID: slots[0].ID, Token: []byte("a")},
+			{ID: slots[2].ID, Token: []byte("c")},
+		},
+	}
+
+	// the slots without booking can be removed without conflict
+	updated := &services.SignedAppointment{
+		Data: &services.Appointment{
+			ID:       appointment.ID,
+			SlotData: []*services.Slot{slots[0], slots[2]},
+		},
+	}
+
+	if preserved, removed := splitBookings(existing, updated); len(preserved) != 2 || len(removed) != 0 {
+		t.Fatalf("expected all bookings to be preserved")
+	}
+
+	// removing a booked slot cancels its booking
+	updated.Data.SlotData = []*services.Slot{slots[0], slots[1]}
+
+	preserved, removed := splitBookings(existing, updated)
+
+	if len(preserved) != 1 || !bytes.Equal(preserved[0].Token, []byte("a")) {
+		t.Fatalf("expected the booking of the first slot to be preserved")
+	}
+
+	if len(removed) != 1 || !bytes.Equal(removed[0].Token, []byte("c")) {
+		t.Fatalf("expected the booking of the last slot to be removed")
+	}
+
+}
+
+func TestRecordPublishedAppointments(t *testing.T) {
+
+	db := &memoryOutboxDatabase{events: &memorySortedSet{}, seq: &memoryInteger{}}
+
+	c := &Appointments{
+		backend: &AppointmentsBackend{db: db},
+		events:  MakeEvents(10),
+	}
+
+	makeAppointment := func(slots int64) *services.SignedAppointment {
+		appointment, err := services.MakeAppointment(time.Now(), slots, 30)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &services.SignedAppointment{Data: appointment}
+	}
+
+	// republished appointments do not contain the bookings
+	unchanged := makeAppointment(3)
+	existing := &services.SignedAppointment{
+		Data:     unchanged.Data,
+		Bookings: []*services.Booking{{ID: unchanged.Data.SlotData[0].ID}},
+	}
+
+	publications := []*appointmentPublication{
+		{
+			appointment: unchanged,
+			existing:    existing,
+			result:      &services.PublishAppointmentResult{Status: services.AppointmentUnchanged},
+		},
+		{
+			appointment: makeAppointment(2),
+			result:      &services.PublishAppointmentResult{Status: services.AppointmentCreated},
+		},
+		{
+			appointment: makeAppointment(5),
+			result:      &services.PublishAppointmentResult{Status: services.AppointmentFailed},
+		},
+	}
+
+	pkd := &services.ProviderKeyData{QueueData: &services.ProviderQueueData{ZipCode: "10707"}}
+
+	c.recordPublishedAppointments(pkd, []byte("provider"), publications)
+
+	event := <-c.events.events
+
+	if event.Type != services.AppointmentsPublishedEvent {
+		t.Fatalf("expected a publication event, got %s", event.Type)
+	}
+
+	// unchanged appointments count towards the slots
+	if event.Data["open"] != int64(4) || event.Data["booked"] != int64(1) {
+		t.Fatalf("unexpected slot counts: %v", event.Data)
+	}
+
+	// but only changed appointments are listed
+	if ids := event.Data["appointments"].([]string); len(ids) != 1 {
+		t.Fatalf("expected one changed appointment, got %d", len(ids))
+	}
+
+	if len(db.events.entries) != 1 {
+		t.Fatalf("expected the event to be written to the outbox")
+	}
+
+	// the event is recorded even if nothing changed
+	c.recordPublishedAppointments(pkd, []byte("provider"), publications[:1])
+
+	if event := <-c.events.events; event.Data["open"] != int64(2) || len(event.Data["appointments"].([]string)) != 0 {
+		t.Fatalf("unexpected event: %v", event.Data)
+	}
+
+}
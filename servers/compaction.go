@@ -0,0 +1,101 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"github.com/impfen/services-inoeg"
+	"github.com/impfen/services-inoeg/meters"
+	"time"
+)
+
+// the IDs of all meter values that we generate
+var meterIDs = []string{"queues", "tokens"}
+
+// MeterCompactor periodically rolls up and expires meter values according to
+// the retention settings.
+type MeterCompactor struct {
+	meter    services.Meter
+	db       services.Database
+	settings *services.RetentionSettings
+	stop     chan bool
+	done     chan bool
+}
+
+func MakeMeterCompactor(meter services.Meter, db services.Database, settings *services.RetentionSettings) *MeterCompactor {
+	return &MeterCompactor{
+		meter:    meter,
+		db:       db,
+		settings: settings,
+	}
+}
+
+func (m *MeterCompactor) compact() {
+
+	// we make sure that only one server compacts the meter at a time
+	lock, err := m.db.Lock("Lock::MeterCompaction", time.Millisecond*100, time.Duration(m.settings.Interval)*time.Second)
+
+	if err != nil {
+		services.Log.Debugf("cannot obtain compaction lock, skipping: %v", err)
+		return
+	}
+
+	if lock != nil {
+		defer lock.Release()
+	}
+
+	now := time.Now().UTC().UnixNano()
+
+	for _, id := range meterIDs {
+		if err := meters.Compact(m.meter, id, m.settings, now); err != nil {
+			services.Log.Error(err)
+		}
+	}
+}
+
+func (m *MeterCompactor) loop(stop, done chan bool) {
+	ticker := time.NewTicker(time.Duration(m.settings.Interval) * time.Second)
+	defer ticker.Stop()
+	for {
+		m.compact()
+		select {
+		case <-ticker.C:
+		case <-stop:
+			done <- true
+			return
+		}
+	}
+}
+
+func (m *MeterCompactor) Start() {
+	if m.stop != nil {
+		return
+	}
+	m.stop = make(chan bool)
+	m.done = make(chan bool)
+	go m.loop(m.stop, m.done)
+}
+
+func (m *MeterCompactor) Stop() {
+	if m.stop == nil {
+		return
+	}
+	m.stop <- true
+	<-m.done
+	m.stop = nil
+}
@@ -0,0 +1,124 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"github.com/impfen/services-inoeg"
+	"sync"
+	"time"
+)
+
+// Events dispatches domain events to handlers in a background goroutine, so
+// that the latency of a request does not depend on e.g. meter writes.
+type Events struct {
+	events   chan *services.Event
+	handlers []services.EventHandler
+	mutex    sync.RWMutex
+	running  bool
+	done     chan bool
+}
+
+func MakeEvents(bufferSize int) *Events {
+	return &Events{
+		events:   make(chan *services.Event, bufferSize),
+		handlers: make([]services.EventHandler, 0),
+	}
+}
+
+// handlers must be added before the event loop is started
+func (e *Events) AddHandler(handler services.EventHandler) {
+	e.handlers = append(e.handlers, handler)
+}
+
+// Writes an event to the outbox and passes it on to the handlers. This is
+// called while the handler still holds its locks, so the order of events in
+// the outbox matches the order of the state changes. The outbox write is not
+// part of the state change, so if it fails the state change stands but the
+// event is never delivered to webhook subscribers.
+func (c *Appointments) recordEvent(eventType string, data map[string]interface{}) {
+	event := &services.Event{
+		Type:      eventType,
+		Timestamp: time.Now().UTC(),
+		Data:      data,
+	}
+	if _, err := c.backend.Outbox().Add(event); err != nil {
+		services.Log.Errorf("cannot write '%s' event to outbox: %v", eventType, err)
+	}
+	c.events.Dispatch(event)
+}
+
+// Emits an event without blocking. If the buffer is full (i.e. the handlers
+// cannot keep up) we drop the event instead of slowing down the request.
+func (e *Events) Emit(eventType string, data map[string]interface{}) {
+	e.Dispatch(&services.Event{
+		Type:      eventType,
+		Timestamp: time.Now().UTC(),
+		Data:      data,
+	})
+}
+
+func (e *Events) Dispatch(event *services.Event) {
+	// we hold the read lock so that the channel does not get closed meanwhile
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+	select {
+	case e.events <- event:
+	default:
+		services.Log.Warningf("event buffer full, dropping '%s' event", event.Type)
+	}
+}
+
+func (e *Events) handle(event *services.Event) {
+	for _, handler := range e.handlers {
+		if err := handler.HandleEvent(event); err != nil {
+			services.Log.Error(err)
+		}
+	}
+}
+
+func (e *Events) loop(events chan *services.Event, done chan bool) {
+	for event := range events {
+		e.handle(event)
+	}
+	done <- true
+}
+
+func (e *Events) Start() {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.running {
+		return
+	}
+	e.running = true
+	e.done = make(chan bool, 1)
+	go e.loop(e.events, e.done)
+}
+
+// Stops the event loop after all buffered events have been handled
+func (e *Events) Stop() {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if !e.running {
+		return
+	}
+	close(e.events)
+	<-e.done
+	e.events = make(chan *services.Event, cap(e.events))
+	e.running = false
+}
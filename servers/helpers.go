@@ -67,13 +67,13 @@ func isRoot(context services.Context, data, signature []byte, timestamp time.Tim
 		Data:      data,
 		Signature: signature,
 	}); !ok {
-		return context.Error(403, "invalid signature", nil)
+		return context.Fail(services.ErrInvalidSignature, nil)
 	} else if err != nil {
 		services.Log.Error(err)
 		return context.InternalError()
 	}
 	if expired(timestamp) {
-		return context.Error(410, "signature expired", nil)
+		return context.Fail(services.ErrSignatureExpired, nil)
 	}
 	return nil
 }
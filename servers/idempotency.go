@@ -0,0 +1,294 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/impfen/services-inoeg"
+	"github.com/impfen/services-inoeg/crypto"
+	"github.com/impfen/services-inoeg/databases"
+	"github.com/impfen/services-inoeg/jsonrpc"
+	"github.com/impfen/services-inoeg/rest"
+	"strings"
+	"time"
+)
+
+// Write endpoints accept an optional idempotency key in their signed data. The
+// first response to a request with a given key is stored for a configurable
+// period and returned verbatim when the request is retried, so that clients
+// that e.g. ran into a timeout can safely retry their request. Retries may
+// use the original signed data (even if its signature has expired) or sign
+// the data again with a new timestamp. Reusing a key for a request with
+// different signed data is rejected.
+
+// header that marks responses which have been replayed
+const IdempotentReplayHeader = "Idempotent-Replayed"
+
+var replayHeaders = map[string]string{IdempotentReplayHeader: "true"}
+
+// A stored response to a request with an idempotency key
+type IdempotentResponse struct {
+	// the result of a successful request
+	Result json.RawMessage `json:"result,omitempty"`
+	// the error data of a failed request
+	Error     *services.ErrorData `json:"error,omitempty"`
+	CreatedAt time.Time           `json:"createdAt"`
+	// hash of the signed data of the request (without its timestamp)
+	RequestHash []byte `json:"requestHash,omitempty"`
+}
+
+// returns the response to store for the given response, or nil if the request
+// should be executed again when it is retried (e.g. due to a lock timeout)
+func MakeIdempotentResponse(resp services.Response) (*IdempotentResponse, error) {
+
+	var result, data interface{}
+	var failed bool
+
+	switch r := resp.(type) {
+	case *jsonrpc.Response:
+		if r.Error == nil {
+			result = r.Result
+		} else {
+			failed = true
+			data = r.Error.Data
+		}
+	case *rest.Response:
+		if r.StatusCode < 400 {
+			result = r.Data
+		} else if err, ok := r.Data.(*rest.Error); ok {
+			failed = true
+			data = err.Data
+		} else {
+			return nil, nil
+		}
+	default:
+		return nil, nil
+	}
+
+	if failed {
+		errorData, ok := data.(*services.ErrorData)
+		if !ok {
+			return nil, nil
+		}
+		// only errors that will not go away on their own are stored
+		if apiErr := services.LookupError(errorData.Code); apiErr == nil || apiErr.Status >= 500 || errorData.RetryAfter > 0 {
+			return nil, nil
+		}
+		return &IdempotentResponse{
+			Error:     errorData,
+			CreatedAt: time.Now(),
+		}, nil
+	}
+
+	idempotentResponse := &IdempotentResponse{
+		CreatedAt: time.Now(),
+	}
+
+	if !isNil(result) {
+		if data, err := json.Marshal(result); err != nil {
+			return nil, err
+		} else {
+			idempotentResponse.Result = data
+		}
+	}
+
+	return idempotentResponse, nil
+}
+
+// returns whether the response belongs to the request with the given hash
+func (i *IdempotentResponse) Matches(requestHash []byte) bool {
+	// responses stored before we recorded the hash are replayed
+	return i.RequestHash == nil || bytes.Equal(i.RequestHash, requestHash)
+}
+
+// recreates the stored response for the given context
+func (i *IdempotentResponse) Response(context services.Context) services.Response {
+
+	var resp services.Response
+
+	if i.Error != nil {
+		apiErr := services.LookupError(i.Error.Code)
+		if apiErr == nil {
+			// the code was removed from the catalog in the meantime
+			apiErr = services.ErrInternal
+		}
+		resp = context.Fail(apiErr, nil)
+		// we return the original error data (including the server time)
+		switch r := resp.(type) {
+		case *jsonrpc.Response:
+			r.Error.Data = i.Error
+		case *rest.Response:
+			if err, ok := r.Data.(*rest.Error); ok {
+				err.Data = i.Error
+			}
+		}
+	} else if i.Result != nil {
+		resp = context.Result(i.Result)
+	} else {
+		resp = context.Nil()
+	}
+
+	switch r := resp.(type) {
+	case *jsonrpc.Response:
+		r.Headers = services.MergeHeaders(replayHeaders, r.Headers)
+	case *rest.Response:
+		r.Headers = services.MergeHeaders(replayHeaders, r.Headers)
+	}
+
+	return resp
+}
+
+// returns the ID of the stored response, keys are scoped to the endpoint so
+// that a response is never returned for a different kind of request
+func idempotencyID(endpoint string, publicKey []byte, key string) []byte {
+	data := append([]byte(endpoint+"::"+key+"::"), publicKey...)
+	return crypto.Hash(data)
+}
+
+// hashes the signed data without its timestamp, so that retries which have
+// been signed again match the original request
+func hashRequest(signedJSON string) []byte {
+	var data map[string]interface{}
+	decoder := json.NewDecoder(strings.NewReader(signedJSON))
+	decoder.UseNumber()
+	if err := decoder.Decode(&data); err == nil {
+		delete(data, "timestamp")
+		// maps are encoded with sorted keys
+		if canonicalJSON, err := json.Marshal(data); err == nil {
+			return crypto.Hash(canonicalJSON)
+		}
+	}
+	return crypto.Hash([]byte(signedJSON))
+}
+
+// Returns the stored response if the request is a retry of a request whose
+// response has been stored, or nil otherwise. Handlers call this before they
+// check the timestamp of the signature, as retries with the original signed
+// data may arrive after the signature has expired. The signature itself is
+// still verified, as only the owner of the key may retrieve the response.
+func (c *Appointments) storedResponse(
+	context services.Context,
+	endpoint string,
+	publicKey []byte,
+	signature []byte,
+	key string,
+	signedJSON string,
+) services.Response {
+
+	if key == "" {
+		return nil
+	}
+
+	if ok, err := crypto.VerifyWithBytes([]byte(signedJSON), signature, publicKey); err != nil || !ok {
+		// the handler reports invalid signatures
+		return nil
+	}
+
+	stored, err := c.backend.IdempotentResponses().Get(idempotencyID(endpoint, publicKey, key))
+
+	if err != nil {
+		if err != databases.NotFound {
+			services.Log.Error(err)
+		}
+		return nil
+	}
+
+	// reused keys are rejected by the handler once the request is verified
+	if !stored.Matches(hashRequest(signedJSON)) {
+		return nil
+	}
+
+	return stored.Response(context)
+}
+
+// An ongoing request with an idempotency key
+type idempotentRequest struct {
+	c           *Appointments
+	id          []byte
+	requestHash []byte
+	lock        services.Lock
+}
+
+// Looks up the stored response for the given idempotency key of the actor. If
+// there is none, the returned request has to be completed by calling Store
+// with the response. Requests without idempotency key return nil for both.
+func (c *Appointments) idempotency(
+	context services.Context,
+	endpoint string,
+	publicKey []byte,
+	key string,
+	signedJSON string,
+) (*idempotentRequest, services.Response) {
+
+	if key == "" {
+		return nil, nil
+	}
+
+	id := idempotencyID(endpoint, publicKey, key)
+	requestHash := hashRequest(signedJSON)
+
+	// concurrent retries wait until the first request has been completed
+	lock, err := c.LockIdempotencyKey(id, len(signedJSON))
+	if err != nil {
+		services.Log.Error(err)
+		return nil, c.metrics.LockError(context, endpoint)
+	}
+
+	if stored, err := c.backend.IdempotentResponses().Get(id); err != nil {
+		if err != databases.NotFound {
+			lock.Release()
+			services.Log.Error(err)
+			return nil, context.InternalError()
+		}
+	} else {
+		lock.Release()
+		if !stored.Matches(requestHash) {
+			return nil, context.Fail(services.ErrIdempotencyKeyReused, nil)
+		}
+		return nil, stored.Response(context)
+	}
+
+	return &idempotentRequest{
+		c:           c,
+		id:          id,
+		requestHash: requestHash,
+		lock:        lock,
+	}, nil
+}
+
+// stores the response for retries and releases the lock of the request
+func (r *idempotentRequest) Store(resp services.Response) {
+
+	if r == nil {
+		return
+	}
+
+	defer r.lock.Release()
+
+	if stored, err := MakeIdempotentResponse(resp); err != nil {
+		services.Log.Error(err)
+	} else if stored != nil {
+		stored.RequestHash = r.requestHash
+		ttl := time.Duration(r.c.settings.IdempotencyTTLHours) * time.Hour
+		if err := r.c.backend.IdempotentResponses().Set(r.id, stored, ttl); err != nil {
+			services.Log.Error(err)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/impfen/services-inoeg"
+	"github.com/impfen/services-inoeg/crypto"
+	"github.com/impfen/services-inoeg/databases"
+	"github.com/impfen/services-inoeg/jsonrpc"
+	"github.com/impfen/services-inoeg/rest"
+	"testing"
+	"time"
+)
+
+// stores the response and returns the replayed one, like a retry would
+func replayResponse(t *testing.T, context services.Context, resp services.Response) services.Response {
+	stored, err := MakeIdempotentResponse(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored == nil {
+		return nil
+	}
+	// responses go through the database
+	if data, err := json.Marshal(stored); err != nil {
+		t.Fatal(err)
+	} else if err := json.Unmarshal(data, &stored); err != nil {
+		t.Fatal(err)
+	}
+	return stored.Response(context)
+}
+
+func TestIdempotentResponseJSONRPC(t *testing.T) {
+
+	context := &jsonrpc.Context{Request: &jsonrpc.Request{ID: "1"}}
+
+	resp := context.Result(map[string]interface{}{"id": "foo"})
+	replayed, ok := replayResponse(t, context, resp).(*jsonrpc.Response)
+
+	if !ok {
+		t.Fatalf("expected a replayed response")
+	}
+
+	if replayed.Headers[IdempotentReplayHeader] != "true" {
+		t.Fatalf("expected the replay header to be set")
+	}
+
+	original, _ := json.Marshal(resp)
+	replayed.Headers = nil
+	if data, _ := json.Marshal(replayed); string(data) != string(original) {
+		t.Fatalf("expected %s, got %s", original, data)
+	}
+
+	resp = context.Fail(services.ErrNotAuthorized, nil)
+	replayed, _ = replayResponse(t, context, resp).(*jsonrpc.Response)
+
+	if replayed == nil || replayed.Error == nil || replayed.Status != 401 {
+		t.Fatalf("expected the error to be replayed")
+	}
+
+	if replayed.Error.Data.(*services.ErrorData).ServerTime.Unix() != resp.(*jsonrpc.Response).Error.Data.(*services.ErrorData).ServerTime.Unix() {
+		t.Fatalf("expected the original server time")
+	}
+
+	// temporary errors are not stored
+	for _, resp := range []services.Response{
+		context.InternalError(),
+		context.Fail(services.ErrLockTimeout, nil),
+		context.Fail(services.ErrPrivacyBudgetExhausted.WithRetryAfter(60e9), nil),
+	} {
+		if replayResponse(t, context, resp) != nil {
+			t.Fatalf("expected the error not to be stored")
+		}
+	}
+
+}
+
+func TestIdempotentResponseREST(t *testing.T) {
+
+	context := &rest.Context{}
+
+	replayed, ok := replayResponse(t, context, context.Acknowledge()).(*rest.Response)
+
+	if !ok || replayed.StatusCode != 200 {
+		t.Fatalf("expected a replayed response")
+	}
+
+	if data, _ := json.Marshal(replayed.Data); string(data) != `"ok"` {
+		t.Fatalf("expected the original result, got %s", data)
+	}
+
+	replayed, ok = replayResponse(t, context, context.NotFound()).(*rest.Response)
+
+	if !ok || replayed.StatusCode != 404 || replayed.Headers[IdempotentReplayHeader] != "true" {
+		t.Fatalf("expected the error to be replayed")
+	}
+
+	if replayed.Data.(*rest.Error).Data.(*services.ErrorData).Code != "not_found" {
+		t.Fatalf("expected the error code to be replayed")
+	}
+
+	if replayed, ok := replayResponse(t, context, context.Nil()).(*rest.Response); !ok || replayed.Data != nil {
+		t.Fatalf("expected an empty result")
+	}
+
+}
+
+func TestIdempotentResponseMatches(t *testing.T) {
+
+	context := &jsonrpc.Context{Request: &jsonrpc.Request{ID: "1"}}
+
+	stored, err := MakeIdempotentResponse(context.Acknowledge())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !stored.Matches([]byte("foo")) {
+		t.Fatalf("expected responses without hash to match any request")
+	}
+
+	stored.RequestHash = []byte("foo")
+
+	if !stored.Matches([]byte("foo")) || stored.Matches([]byte("bar")) {
+		t.Fatalf("expected only the original request to match")
+	}
+
+}
+
+// a database that only supports values and (no-op) locks
+type memoryValueDatabase struct {
+	services.Database
+	values map[string][]byte
+}
+
+type memoryValue struct {
+	db  *memoryValueDatabase
+	key string
+}
+
+type noopLock struct{}
+
+func (l noopLock) Release() error { return nil }
+
+func (m *memoryValueDatabase) Lock(key string, timeout, ttl time.Duration) (services.Lock, error) {
+	return noopLock{}, nil
+}
+
+func (m *memoryValueDatabase) Value(table string, key []byte) services.Value {
+	return &memoryValue{db: m, key: table + "::" + string(key)}
+}
+
+func (m *memoryValue) Set(value []byte, ttl time.Duration) error {
+	m.db.values[m.key] = value
+	return nil
+}
+
+func (m *memoryValue) Get() ([]byte, error) {
+	if value, ok := m.db.values[m.key]; ok {
+		return value, nil
+	}
+	return nil, databases.NotFound
+}
+
+func (m *memoryValue) Del() error {
+	delete(m.db.values, m.key)
+	return nil
+}
+
+func TestIdempotentRetry(t *testing.T) {
+
+	db := &memoryValueDatabase{values: make(map[string][]byte)}
+
+	c := &Appointments{
+		db:       db,
+		backend:  &AppointmentsBackend{db: db},
+		settings: &services.AppointmentsSettings{IdempotencyTTLHours: 24},
+	}
+
+	key, err := crypto.GenerateWebKey("user", "ecdsa")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sign := func(key *crypto.Key, id string, timestamp time.Time) *crypto.SignedStringData {
+		data := fmt.Sprintf(`{"id": "%s", "idempotencyKey": "foo", "timestamp": "%s"}`, id, timestamp.Format(time.RFC3339Nano))
+		if signedData, err := key.SignString(data); err != nil {
+			t.Fatal(err)
+			return nil
+		} else {
+			return signedData
+		}
+	}
+
+	context := &jsonrpc.Context{Request: &jsonrpc.Request{ID: "1"}}
+
+	original := sign(key, "a", time.Now().Add(-time.Hour))
+
+	idem, resp := c.idempotency(context, "test", key.PublicKey, "foo", original.Data)
+
+	if idem == nil || resp != nil {
+		t.Fatalf("expected a new request")
+	}
+
+	idem.Store(context.Result("ok"))
+
+	replayed := func(signedData *crypto.SignedStringData) bool {
+		resp, ok := c.storedResponse(context, "test", key.PublicKey, signedData.Signature, "foo", signedData.Data).(*jsonrpc.Response)
+		return ok && resp.Headers[IdempotentReplayHeader] == "true"
+	}
+
+	// the original request is replayed even though its signature expired
+	if !replayed(original) {
+		t.Fatalf("expected the original request to be replayed")
+	}
+
+	// requests that have been signed again with a new timestamp as well
+	if !replayed(sign(key, "a", time.Now())) {
+		t.Fatalf("expected the re-signed request to be replayed")
+	}
+
+	// the response is only returned to the owner of the key
+	otherKey, err := crypto.GenerateWebKey("other", "ecdsa")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if replayed(sign(otherKey, "a", time.Now())) {
+		t.Fatalf("expected requests with an invalid signature not to be replayed")
+	}
+
+	// requests with different data are rejected
+	different := sign(key, "b", time.Now())
+
+	if replayed(different) {
+		t.Fatalf("expected requests with different data not to be replayed")
+	}
+
+	if _, resp := c.idempotency(context, "test", key.PublicKey, "foo", different.Data); resp == nil || resp.(*jsonrpc.Response).Error.Data.(*services.ErrorData).Code != services.ErrIdempotencyKeyReused.Code {
+		t.Fatalf("expected the reused key to be rejected")
+	}
+
+}
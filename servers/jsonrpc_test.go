@@ -0,0 +1,98 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers_test
+
+import (
+	"encoding/json"
+	"github.com/impfen/services-inoeg"
+	"github.com/impfen/services-inoeg/definitions"
+	"github.com/impfen/services-inoeg/helpers"
+	at "github.com/impfen/services-inoeg/testing"
+	af "github.com/impfen/services-inoeg/testing/fixtures"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestJSONRPCCallsWithoutID(t *testing.T) {
+
+	var fixturesConfig = []at.FC{
+
+		// we create the settings
+		at.FC{af.Settings{Definitions: definitions.Default}, "settings"},
+
+		// we create the appointments API
+		at.FC{af.AppointmentsServer{}, "appointmentsServer"},
+
+		// we create a client (without a key)
+		at.FC{af.Client{}, "client"},
+
+		// we create a mediator, which calls the API via the client
+		at.FC{af.Mediator{}, "mediator"},
+	}
+
+	fixtures, err := at.SetupFixtures(fixturesConfig)
+	defer at.TeardownFixtures(fixturesConfig, fixtures)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	settings := fixtures["settings"].(*services.Settings)
+	client := fixtures["client"].(*helpers.Client)
+
+	if resp, err := client.Appointments.GetKeys(); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d instead", resp.StatusCode)
+	}
+
+	post := func(body string) *http.Response {
+		resp, err := http.Post(settings.Admin.Client.AppointmentsEndpoint, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	// single calls without an ID still receive a response
+	resp := post(`{"jsonrpc": "2.0", "method": "getKeys", "params": {}}`)
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		t.Fatalf("expected a 200 status code, got %d instead", resp.StatusCode)
+	}
+
+	var result map[string]interface{}
+
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	} else if result["result"] == nil {
+		t.Fatalf("expected a result, got %v", result)
+	}
+
+	// calls without an ID in a batch are notifications
+	batchResp := post(`[{"jsonrpc": "2.0", "method": "getKeys", "params": {}}]`)
+	defer batchResp.Body.Close()
+
+	if batchResp.StatusCode != 204 {
+		t.Fatalf("expected a 204 status code, got %d instead", batchResp.StatusCode)
+	}
+
+}
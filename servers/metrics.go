@@ -0,0 +1,164 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"fmt"
+	"github.com/impfen/services-inoeg"
+	"github.com/impfen/services-inoeg/jsonrpc"
+	"github.com/impfen/services-inoeg/rest"
+	"github.com/prometheus/client_golang/prometheus"
+	"reflect"
+	"strings"
+)
+
+// Business metrics of the appointments server, labelled by endpoint and
+// outcome of the request
+type Metrics struct {
+	TokensIssued      *prometheus.CounterVec
+	Bookings          *prometheus.CounterVec
+	Cancellations     *prometheus.CounterVec
+	LockTimeouts      *prometheus.CounterVec
+	SignatureFailures *prometheus.CounterVec
+	PublishBatchSizes *prometheus.HistogramVec
+}
+
+func MakeMetrics(prefix string) *Metrics {
+
+	counter := func(name, help string, labels ...string) *prometheus.CounterVec {
+		return prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: fmt.Sprintf("%s_%s", prefix, name),
+				Help: help,
+			},
+			append([]string{"endpoint", "outcome"}, labels...),
+		)
+	}
+
+	return &Metrics{
+		TokensIssued:      counter("tokens_total", "Token requests"),
+		Bookings:          counter("bookings_total", "Booking requests"),
+		Cancellations:     counter("cancellations_total", "Cancellation requests"),
+		LockTimeouts:      counter("lock_timeouts_total", "Requests that could not obtain a lock"),
+		SignatureFailures: counter("signature_failures_total", "Requests with invalid or unauthorized signatures", "actor"),
+		PublishBatchSizes: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    fmt.Sprintf("%s_%s", prefix, "publish_batch_size"),
+				Help:    "Number of appointments per publish request",
+				Buckets: []float64{1, 5, 10, 25, 50, 100, 250, 500, 1000},
+			},
+			[]string{"endpoint", "outcome"},
+		),
+	}
+}
+
+func (m *Metrics) collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		m.TokensIssued,
+		m.Bookings,
+		m.Cancellations,
+		m.LockTimeouts,
+		m.SignatureFailures,
+		m.PublishBatchSizes,
+	}
+}
+
+func (m *Metrics) Register() error {
+	for _, collector := range m.collectors() {
+		if err := prometheus.Register(collector); err != nil {
+			return fmt.Errorf("error registering business metrics: %v", err)
+		}
+	}
+	return nil
+}
+
+func (m *Metrics) Unregister() {
+	for _, collector := range m.collectors() {
+		prometheus.Unregister(collector)
+	}
+}
+
+func isNil(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	v := reflect.ValueOf(value)
+	return v.Kind() == reflect.Ptr && v.IsNil()
+}
+
+// Returns the outcome of a request based on its response. Errors from the
+// catalog are identified by their code, other error messages are static
+// strings, so the number of outcomes stays small.
+func outcome(resp services.Response) string {
+	var message string
+	var data interface{}
+	switch r := resp.(type) {
+	case *jsonrpc.Response:
+		if r.Error == nil {
+			if isNil(r.Result) {
+				// e.g. no appointment slot was available
+				return "empty"
+			}
+			return "success"
+		}
+		message = r.Error.Message
+		data = r.Error.Data
+	case *rest.Response:
+		if r.StatusCode < 400 {
+			if isNil(r.Data) {
+				return "empty"
+			}
+			return "success"
+		}
+		if err, ok := r.Data.(*rest.Error); ok {
+			message = err.Message
+			data = err.Data
+		}
+	default:
+		return "unknown"
+	}
+	if errorData, ok := data.(*services.ErrorData); ok {
+		return errorData.Code
+	}
+	if message == "" {
+		return "error"
+	}
+	return strings.Replace(message, " ", "_", -1)
+}
+
+// Records the outcome of a request in the given counter
+func (m *Metrics) Observe(counter *prometheus.CounterVec, endpoint string, resp services.Response) {
+	counter.WithLabelValues(endpoint, outcome(resp)).Inc()
+}
+
+// Records a failed authentication of the given actor, internal errors are
+// not counted
+func (m *Metrics) SignatureFailure(context services.Context, endpoint, actor string, resp services.Response) {
+	if context.IsInternalError(resp) {
+		return
+	}
+	m.SignatureFailures.WithLabelValues(endpoint, outcome(resp), actor).Inc()
+}
+
+// Records a lock timeout and returns the corresponding error response
+func (m *Metrics) LockError(context services.Context, endpoint string) services.Response {
+	resp := LockError(context)
+	m.LockTimeouts.WithLabelValues(endpoint, outcome(resp)).Inc()
+	return resp
+}
@@ -0,0 +1,182 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"encoding/json"
+	"github.com/impfen/services-inoeg"
+	"github.com/impfen/services-inoeg/databases"
+	"sort"
+	"testing"
+	"time"
+)
+
+type memorySortedSet struct {
+	entries []*services.SortedSetEntry
+}
+
+func (m *memorySortedSet) Del(data []byte) (bool, error) { return false, nil }
+
+func (m *memorySortedSet) Add(data []byte, score int64) error {
+	m.entries = append(m.entries, &services.SortedSetEntry{Score: score, Data: data})
+	sort.Slice(m.entries, func(i, j int) bool { return m.entries[i].Score < m.entries[j].Score })
+	return nil
+}
+
+func (m *memorySortedSet) Range(from, to int64) ([]*services.SortedSetEntry, error) {
+	return nil, nil
+}
+
+func (m *memorySortedSet) RangeByScore(from, to int64) ([]*services.SortedSetEntry, error) {
+	entries := make([]*services.SortedSetEntry, 0)
+	for _, entry := range m.entries {
+		if entry.Score >= from && entry.Score <= to {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+func (m *memorySortedSet) At(i int64) (*services.SortedSetEntry, error) { return nil, nil }
+
+func (m *memorySortedSet) Score(data []byte) (int64, error) { return 0, nil }
+
+func (m *memorySortedSet) PopMin(n int64) ([]*services.SortedSetEntry, error) { return nil, nil }
+
+func (m *memorySortedSet) RemoveRangeByScore(from, to int64) error {
+	entries := make([]*services.SortedSetEntry, 0)
+	for _, entry := range m.entries {
+		if entry.Score < from || entry.Score > to {
+			entries = append(entries, entry)
+		}
+	}
+	m.entries = entries
+	return nil
+}
+
+type memoryInteger struct {
+	value *int64
+}
+
+func (m *memoryInteger) Set(value int64, ttl time.Duration) error {
+	m.value = &value
+	return nil
+}
+
+func (m *memoryInteger) IncrBy(n int64) (int64, error) {
+	var value int64
+	if m.value != nil {
+		value = *m.value
+	}
+	value += n
+	m.value = &value
+	return value, nil
+}
+
+func (m *memoryInteger) DecrBy(n int64) (int64, error) { return m.IncrBy(-n) }
+
+func (m *memoryInteger) Get() (int64, error) {
+	if m.value == nil {
+		return 0, databases.NotFound
+	}
+	return *m.value, nil
+}
+
+func (m *memoryInteger) Del() error {
+	m.value = nil
+	return nil
+}
+
+func TestOutboxGaps(t *testing.T) {
+
+	events := &memorySortedSet{}
+	outbox := &Outbox{events: events, seq: &memoryInteger{}}
+
+	if result, cursor, err := outbox.Get(0, 10); err != nil {
+		t.Fatal(err)
+	} else if len(result) != 0 || cursor != 0 {
+		t.Fatalf("expected no events")
+	}
+
+	// stores an event with a previously allocated ID
+	store := func(id int64, timestamp time.Time) {
+		data, err := json.Marshal(&services.OutboxEvent{
+			ID:    id,
+			Event: services.Event{Type: "test", Timestamp: timestamp},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := events.Add(data, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := outbox.seq.IncrBy(1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a concurrent request stores event 3 before event 2
+	store(1, time.Now())
+	store(3, time.Now())
+
+	if result, cursor, err := outbox.Get(0, 10); err != nil {
+		t.Fatal(err)
+	} else if len(result) != 1 || cursor != 1 {
+		t.Fatalf("expected to stop before the missing event, got cursor %d", cursor)
+	}
+
+	store(2, time.Now())
+
+	if result, cursor, err := outbox.Get(1, 10); err != nil {
+		t.Fatal(err)
+	} else if len(result) != 2 || cursor != 3 {
+		t.Fatalf("expected the remaining events, got cursor %d", cursor)
+	}
+
+	// event 4 is lost, we move past it once event 5 has settled
+	for i := 0; i < 2; i++ {
+		if _, err := outbox.seq.IncrBy(1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	store(5, time.Now().Add(-outboxSettleDelay))
+
+	if result, cursor, err := outbox.Get(3, 10); err != nil {
+		t.Fatal(err)
+	} else if len(result) != 1 || cursor != 5 {
+		t.Fatalf("expected to skip the lost event, got cursor %d", cursor)
+	}
+
+	// a reader whose events have been trimmed from the outbox finds the
+	// events that follow them, even beyond the limit
+	if err := events.RemoveRangeByScore(0, 3); err != nil {
+		t.Fatal(err)
+	}
+
+	if result, cursor, err := outbox.Get(0, 2); err != nil {
+		t.Fatal(err)
+	} else if len(result) != 1 || cursor != 5 {
+		t.Fatalf("expected to skip the trimmed events, got cursor %d", cursor)
+	}
+
+}
@@ -0,0 +1,219 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"github.com/impfen/services-inoeg"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+var BudgetExhausted = fmt.Errorf("privacy budget exhausted")
+var RateLimitExceeded = fmt.Errorf("privacy budget rate limit exceeded")
+
+// StatsPrivacy adds Laplace noise to public statistics, suppresses small
+// values and keeps track of the privacy budget that has been spent for each
+// metric. The noise for a given value is generated only once per budget
+// period, so repeating a query neither reveals more information nor spends
+// additional budget. If the value changes (e.g. because its time window is
+// still open) we draw new noise, which spends budget again. As all clients
+// share the budget, the number of queries that spend budget can be limited
+// per client.
+type StatsPrivacy struct {
+	settings    *services.StatsPrivacySettings
+	mutex       sync.Mutex
+	periodStart time.Time
+	spent       map[string]float64
+	cells       map[string]*noisyCell
+	rateWindow  services.TimeWindow
+	rates       map[string]int64
+}
+
+// the true value of a cell and the noise we released it with
+type noisyCell struct {
+	value int64
+	noise int64
+}
+
+func MakeStatsPrivacy(settings *services.StatsPrivacySettings) *StatsPrivacy {
+	return &StatsPrivacy{
+		settings: settings,
+		spent:    make(map[string]float64),
+		cells:    make(map[string]*noisyCell),
+		rates:    make(map[string]int64),
+	}
+}
+
+func (p *StatsPrivacy) sensitivity(name string) float64 {
+	for _, metric := range p.settings.Metrics {
+		if metric.Name == name {
+			return metric.Sensitivity
+		}
+	}
+	return 1.0
+}
+
+func cellKey(value *services.StatsValue) string {
+	// fmt prints maps with sorted keys
+	return fmt.Sprintf("%s:%d:%d:%v", value.Name, value.From.UnixNano(), value.To.UnixNano(), value.Data)
+}
+
+// Values of a metric with the same data keys and time window length are
+// disjoint, as every event falls into exactly one of them. Values from
+// different partitions overlap (e.g. the total and the values per zip code).
+func partitionKey(value *services.StatsValue) string {
+	keys := make([]string, 0, len(value.Data))
+	for key := range value.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return fmt.Sprintf("%s:%d:%v", value.Name, value.To.Sub(value.From), keys)
+}
+
+// Returns the time until the next budget period begins
+func (p *StatsPrivacy) NextPeriod() time.Duration {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return time.Until(p.periodStart.Add(time.Duration(p.settings.BudgetPeriod) * time.Second))
+}
+
+// Returns the time until the given client may spend budget again
+func (p *StatsPrivacy) NextRateWindow() time.Duration {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return time.Until(time.Unix(0, p.rateWindow.To))
+}
+
+// checks whether the client may spend budget and counts the query
+func (p *StatsPrivacy) rateLimit(now time.Time, client string) error {
+	rateLimit := p.settings.RateLimit
+	if rateLimit == nil {
+		return nil
+	}
+	tw := services.MakeTimeWindow(now.UnixNano(), rateLimit.Type)
+	if !p.rateWindow.EqualTo(&tw) {
+		// a new time window begins, we reset the rates
+		p.rateWindow = tw
+		p.rates = make(map[string]int64)
+	}
+	if p.rates[client] >= rateLimit.Limit {
+		return RateLimitExceeded
+	}
+	p.rates[client]++
+	return nil
+}
+
+// Returns the noisy values, dropping all values below the k-threshold. The
+// client is the address of the requesting client and is used for rate
+// limiting.
+func (p *StatsPrivacy) Apply(values []*services.StatsValue, client string) ([]*services.StatsValue, error) {
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	now := time.Now()
+
+	if now.Sub(p.periodStart) >= time.Duration(p.settings.BudgetPeriod)*time.Second {
+		// a new budget period begins
+		p.periodStart = now
+		p.spent = make(map[string]float64)
+		p.cells = make(map[string]*noisyCell)
+	}
+
+	// releasing new values from the same partition costs epsilon only once
+	// per query (parallel composition), values from overlapping partitions
+	// add up (sequential composition)
+	charges := make(map[string]float64)
+	partitions := make(map[string]bool)
+
+	for _, value := range values {
+		if cell, ok := p.cells[cellKey(value)]; ok && cell.value == value.Value {
+			continue
+		}
+		if key := partitionKey(value); !partitions[key] {
+			partitions[key] = true
+			charges[value.Name] += p.settings.Epsilon
+		}
+	}
+
+	if len(charges) > 0 {
+		for name, charge := range charges {
+			if p.spent[name]+charge > p.settings.Budget {
+				return nil, BudgetExhausted
+			}
+		}
+
+		if err := p.rateLimit(now, client); err != nil {
+			return nil, err
+		}
+
+		for name, charge := range charges {
+			p.spent[name] += charge
+		}
+	}
+
+	noisyValues := make([]*services.StatsValue, 0, len(values))
+
+	for _, value := range values {
+		key := cellKey(value)
+		cell, ok := p.cells[key]
+		if !ok || cell.value != value.Value {
+			scale := p.sensitivity(value.Name) / p.settings.Epsilon
+			cell = &noisyCell{
+				value: value.Value,
+				noise: int64(math.Round(laplace(scale))),
+			}
+			p.cells[key] = cell
+		}
+		noisyValue := value.Value + cell.noise
+		if noisyValue < p.settings.MinCount {
+			// we suppress small values
+			continue
+		}
+		noisyValues = append(noisyValues, &services.StatsValue{
+			Name:  value.Name,
+			From:  value.From,
+			To:    value.To,
+			Data:  value.Data,
+			Value: noisyValue,
+		})
+	}
+
+	return noisyValues, nil
+}
+
+// Returns a sample from a Laplace distribution with mean 0 and the given scale
+func laplace(scale float64) float64 {
+	bs := make([]byte, 8)
+	if _, err := rand.Read(bs); err != nil {
+		// this should never happen
+		panic(err)
+	}
+	// uniform in (-0.5, 0.5)
+	u := (float64(binary.LittleEndian.Uint64(bs)>>11)+0.5)/(1<<53) - 0.5
+	if u < 0 {
+		return scale * math.Log(1+2*u)
+	}
+	return -scale * math.Log(1-2*u)
+}
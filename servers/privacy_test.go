@@ -0,0 +1,231 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"github.com/impfen/services-inoeg"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestLaplace(t *testing.T) {
+	n := 100000
+	var sum, sumAbs float64
+	for i := 0; i < n; i++ {
+		v := laplace(2.0)
+		sum += v
+		sumAbs += math.Abs(v)
+	}
+	// the mean absolute deviation of a Laplace distribution is its scale
+	if math.Abs(sum/float64(n)) > 0.1 || math.Abs(sumAbs/float64(n)-2.0) > 0.1 {
+		t.Fatalf("unexpected distribution: mean %f, mean deviation %f", sum/float64(n), sumAbs/float64(n))
+	}
+}
+
+func TestStatsPrivacy(t *testing.T) {
+
+	privacy := MakeStatsPrivacy(&services.StatsPrivacySettings{
+		Epsilon:      1.0,
+		Budget:       2.0,
+		BudgetPeriod: 3600,
+		MinCount:     20,
+	})
+
+	from := time.Date(2021, 6, 15, 0, 0, 0, 0, time.UTC)
+
+	makeValues := func(days int) []*services.StatsValue {
+		values := make([]*services.StatsValue, 0)
+		for i := 0; i < days; i++ {
+			values = append(values, &services.StatsValue{
+				Name:  "bookings",
+				From:  from.AddDate(0, 0, i),
+				To:    from.AddDate(0, 0, i+1),
+				Data:  map[string]string{"zipCode": "10707"},
+				Value: int64(1000 * (i % 2)),
+			})
+		}
+		return values
+	}
+
+	first, err := privacy.Apply(makeValues(4), "")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// values of 0 are (almost certainly) suppressed
+	if len(first) != 2 {
+		t.Fatalf("expected 2 values, got %d", len(first))
+	}
+
+	// repeating the query returns the same noise and costs no budget
+	for i := 0; i < 5; i++ {
+		if values, err := privacy.Apply(makeValues(4), ""); err != nil {
+			t.Fatal(err)
+		} else if len(values) != 2 || values[0].Value != first[0].Value {
+			t.Fatalf("expected identical values")
+		}
+	}
+
+	// new cells spend budget
+	if _, err := privacy.Apply(makeValues(6), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := privacy.Apply(makeValues(8), ""); err != BudgetExhausted {
+		t.Fatalf("expected the budget to be exhausted")
+	}
+
+}
+
+func TestStatsPrivacyValueChange(t *testing.T) {
+
+	settings := &services.StatsPrivacySettings{
+		Epsilon:      1.0,
+		Budget:       2.0,
+		BudgetPeriod: 3600,
+		MinCount:     0,
+	}
+
+	from := time.Date(2021, 6, 15, 0, 0, 0, 0, time.UTC)
+
+	makeValues := func(value int64) []*services.StatsValue {
+		return []*services.StatsValue{
+			{
+				Name:  "bookings",
+				From:  from,
+				To:    from.AddDate(0, 0, 1),
+				Value: value,
+			},
+		}
+	}
+
+	// the value of an open time window changes, if we kept the noise the
+	// difference of the noisy values would reveal the exact change
+	differences := make(map[int64]bool)
+
+	for i := 0; i < 20; i++ {
+
+		privacy := MakeStatsPrivacy(settings)
+
+		first, err := privacy.Apply(makeValues(1000), "")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// a changed value gets new noise and spends budget
+		second, err := privacy.Apply(makeValues(1001), "")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		differences[second[0].Value-first[0].Value] = true
+
+		// repeating an unchanged value is free
+		if _, err := privacy.Apply(makeValues(1001), ""); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := privacy.Apply(makeValues(1002), ""); err != BudgetExhausted {
+			t.Fatalf("expected the budget to be exhausted")
+		}
+	}
+
+	if len(differences) < 2 {
+		t.Fatalf("expected new noise for changed values")
+	}
+
+}
+
+func TestStatsPrivacyOverlappingValues(t *testing.T) {
+
+	privacy := MakeStatsPrivacy(&services.StatsPrivacySettings{
+		Epsilon:      1.0,
+		Budget:       1.0,
+		BudgetPeriod: 3600,
+		MinCount:     0,
+	})
+
+	from := time.Date(2021, 6, 15, 0, 0, 0, 0, time.UTC)
+
+	// the total overlaps with the values per zip code
+	values := []*services.StatsValue{
+		{Name: "bookings", From: from, To: from.AddDate(0, 0, 1), Value: 100},
+		{Name: "bookings", From: from, To: from.AddDate(0, 0, 1), Data: map[string]string{"zipCode": "10707"}, Value: 60},
+		{Name: "bookings", From: from, To: from.AddDate(0, 0, 1), Data: map[string]string{"zipCode": "10115"}, Value: 40},
+	}
+
+	if _, err := privacy.Apply(values, ""); err != BudgetExhausted {
+		t.Fatalf("expected overlapping values to spend epsilon twice")
+	}
+
+	// the values per zip code are disjoint
+	if _, err := privacy.Apply(values[1:], ""); err != nil {
+		t.Fatal(err)
+	}
+
+}
+
+func TestStatsPrivacyRateLimit(t *testing.T) {
+
+	privacy := MakeStatsPrivacy(&services.StatsPrivacySettings{
+		Epsilon:      1.0,
+		Budget:       100.0,
+		BudgetPeriod: 3600,
+		MinCount:     0,
+		RateLimit:    &services.RateLimit{Type: "hour", Limit: 2},
+	})
+
+	from := time.Date(2021, 6, 15, 0, 0, 0, 0, time.UTC)
+
+	makeValues := func(day int) []*services.StatsValue {
+		return []*services.StatsValue{
+			{
+				Name:  "bookings",
+				From:  from.AddDate(0, 0, day),
+				To:    from.AddDate(0, 0, day+1),
+				Value: 100,
+			},
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := privacy.Apply(makeValues(i), "1.2.3.4"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := privacy.Apply(makeValues(2), "1.2.3.4"); err != RateLimitExceeded {
+		t.Fatalf("expected the rate limit to be exceeded")
+	}
+
+	// queries that do not spend budget are not limited
+	if _, err := privacy.Apply(makeValues(0), "1.2.3.4"); err != nil {
+		t.Fatal(err)
+	}
+
+	// other clients can still spend budget
+	if _, err := privacy.Apply(makeValues(2), "5.6.7.8"); err != nil {
+		t.Fatal(err)
+	}
+
+}
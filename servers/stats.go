@@ -0,0 +1,108 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"fmt"
+	"github.com/impfen/services-inoeg"
+)
+
+// StatsAggregator writes domain events into the meter, for all time windows
+type StatsAggregator struct {
+	meter services.Meter
+}
+
+func MakeStatsAggregator(meter services.Meter) *StatsAggregator {
+	return &StatsAggregator{
+		meter: meter,
+	}
+}
+
+func (s *StatsAggregator) HandleEvent(event *services.Event) error {
+
+	ts := event.Timestamp.UnixNano()
+
+	for _, twt := range tws {
+
+		// generate the time window
+		tw := twt(ts)
+
+		var err error
+
+		switch event.Type {
+		case services.AppointmentsPublishedEvent:
+			err = s.addPublicationStats(event, tw)
+		case services.AppointmentBookedEvent:
+			// we add the info that a booking was made
+			err = s.meter.Add("queues", "bookings", map[string]string{}, tw, 1)
+		case services.AppointmentCancelledEvent:
+			err = s.meter.Add("queues", "cancellations", map[string]string{}, tw, 1)
+		default:
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *StatsAggregator) addPublicationStats(event *services.Event, tw services.TimeWindow) error {
+
+	providerID, ok := event.Data["provider"].(string)
+	if !ok {
+		return fmt.Errorf("provider missing")
+	}
+
+	zipCode, _ := event.Data["zipCode"].(string)
+	openSlots, _ := event.Data["open"].(int64)
+	bookedSlots, _ := event.Data["booked"].(int64)
+
+	addStats := func(data map[string]string) error {
+		// we add the maximum of the open appointments
+		if err := s.meter.AddMax("queues", "open", providerID, data, tw, openSlots); err != nil {
+			return err
+		}
+		// we add the maximum of the booked appointments
+		if err := s.meter.AddMax("queues", "booked", providerID, data, tw, bookedSlots); err != nil {
+			return err
+		}
+		// we add the info that this provider is active
+		if err := s.meter.AddOnce("queues", "active", providerID, data, tw, 1); err != nil {
+			return err
+		}
+		return nil
+	}
+
+	// global statistics
+	if err := addStats(map[string]string{}); err != nil {
+		return err
+	}
+
+	// statistics by zip code
+	if zipCode != "" {
+		return addStats(map[string]string{
+			"zipCode": zipCode,
+		})
+	}
+
+	return nil
+}
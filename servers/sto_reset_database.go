@@ -34,7 +34,7 @@ func (s *Storage) resetDB(context services.Context, params *services.ResetDBSign
 	}
 
 	if !s.test {
-		context.Error(400, "not a test system, will not reset database...", nil)
+		return context.Fail(services.ErrNotATestSystem, nil)
 	}
 
 	services.Log.Warning("Database reset requested!")
@@ -39,7 +39,26 @@ func MakeStorage(settings *services.Settings) (*Storage, error) {
 		test:     settings.Test,
 	}
 
-	api := &api.API{
+	api := storage.makeAPI()
+
+	var err error
+
+	if storage.Server, err = MakeServer("storage", settings.Storage.HTTP, settings.Storage.JSONRPC, settings.Storage.REST, settings.Appointments.Validate, api); err != nil {
+		return nil, err
+	}
+
+	return storage, nil
+
+}
+
+// Returns the definition of the storage API. Handlers may only be called if the
+// server was created via MakeStorage.
+func StorageAPI() *api.API {
+	return (&Storage{}).makeAPI()
+}
+
+func (c *Storage) makeAPI() *api.API {
+	return &api.API{
 		Version: 1,
 		Name:    "storage",
 		Endpoints: []*api.Endpoint{
@@ -47,8 +66,9 @@ func MakeStorage(settings *services.Settings) (*Storage, error) {
 				Name:        "storeSettings",
 				Description: "Stores encrypted settings.",
 				Form:        &forms.StoreSettingsForm,
-				Handler:     storage.storeSettings,
+				Handler:     c.storeSettings,
 				ReturnType: &api.ReturnType{
+					Type:       "",
 					Validators: forms.IsAcknowledgeRVV,
 				},
 				REST: &api.REST{
@@ -60,7 +80,7 @@ func MakeStorage(settings *services.Settings) (*Storage, error) {
 				Name:        "getSettings",
 				Description: "Retrieves encrypted settings.",
 				Form:        &forms.GetSettingsForm,
-				Handler:     storage.getSettings,
+				Handler:     c.getSettings,
 				REST: &api.REST{
 					Path:   "store/<id>",
 					Method: api.GET,
@@ -70,8 +90,9 @@ func MakeStorage(settings *services.Settings) (*Storage, error) {
 				Name:        "deleteSettings",
 				Description: "Deletes encrypted settings.",
 				Form:        &forms.DeleteSettingsForm,
-				Handler:     storage.deleteSettings,
+				Handler:     c.deleteSettings,
 				ReturnType: &api.ReturnType{
+					Type:       "",
 					Validators: forms.IsAcknowledgeRVV,
 				},
 				REST: &api.REST{
@@ -83,8 +104,9 @@ func MakeStorage(settings *services.Settings) (*Storage, error) {
 				Name:        "resetDB",
 				Description: "Resets the database. Only enabled for test deployments.",
 				Form:        &forms.ResetDBForm,
-				Handler:     storage.resetDB,
+				Handler:     c.resetDB,
 				ReturnType: &api.ReturnType{
+					Type:       "",
 					Validators: forms.IsAcknowledgeRVV,
 				},
 				REST: &api.REST{
@@ -94,15 +116,6 @@ func MakeStorage(settings *services.Settings) (*Storage, error) {
 			},
 		},
 	}
-
-	var err error
-
-	if storage.Server, err = MakeServer("storage", settings.Storage.HTTP, settings.Storage.JSONRPC, settings.Storage.REST, settings.Appointments.Validate, api); err != nil {
-		return nil, err
-	}
-
-	return storage, nil
-
 }
 
 func (c *Storage) isRoot(context services.Context, params *services.SignedParams) services.Response {
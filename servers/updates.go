@@ -0,0 +1,90 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/impfen/services-inoeg"
+)
+
+// availability updates for all zip codes are published on a single channel
+const availabilityChannel = "availability"
+
+func providerAppointmentsChannel(providerID string) string {
+	return fmt.Sprintf("providerAppointments::%s", providerID)
+}
+
+// AppointmentUpdates publishes the IDs of changed appointments on the channel
+// of their provider, so that subscribed providers do not need to poll. It
+// also publishes availability updates for anonymous subscribers.
+type AppointmentUpdates struct {
+	pubSub services.PubSub
+}
+
+func MakeAppointmentUpdates(pubSub services.PubSub) *AppointmentUpdates {
+	return &AppointmentUpdates{
+		pubSub: pubSub,
+	}
+}
+
+func (a *AppointmentUpdates) HandleEvent(event *services.Event) error {
+
+	providerID, _ := event.Data["provider"].(string)
+
+	var appointmentIDs []string
+
+	switch event.Type {
+	case services.AppointmentsPublishedEvent:
+		appointmentIDs, _ = event.Data["appointments"].([]string)
+	case services.AppointmentBookedEvent, services.AppointmentCancelledEvent:
+		if appointmentID, ok := event.Data["appointment"].(string); ok {
+			appointmentIDs = []string{appointmentID}
+		}
+	default:
+		return nil
+	}
+
+	// anonymous subscribers only learn about new appointments in a zip code,
+	// not about individual bookings (or republished unchanged appointments)
+	if zipCode, _ := event.Data["zipCode"].(string); zipCode != "" && event.Type == services.AppointmentsPublishedEvent && len(appointmentIDs) > 0 {
+		if data, err := json.Marshal(&services.AvailabilityUpdate{
+			ZipCode:   zipCode,
+			Timestamp: event.Timestamp,
+		}); err != nil {
+			return err
+		} else if err := a.pubSub.Publish(availabilityChannel, data); err != nil {
+			return err
+		}
+	}
+
+	for _, appointmentID := range appointmentIDs {
+		if data, err := json.Marshal(&services.AppointmentUpdate{
+			ID:        appointmentID,
+			Type:      event.Type,
+			Timestamp: event.Timestamp,
+		}); err != nil {
+			return err
+		} else if err := a.pubSub.Publish(providerAppointmentsChannel(providerID), data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,99 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/impfen/services-inoeg"
+	"github.com/impfen/services-inoeg/databases"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStreamUpdates(t *testing.T) {
+
+	pubSub := databases.MakeInMemoryPubSub()
+	updates := MakeAppointmentUpdates(pubSub)
+
+	reader, writer := io.Pipe()
+	done := make(chan struct{})
+	finished := make(chan error)
+
+	go func() {
+		finished <- streamUpdates(pubSub, providerAppointmentsChannel("abcd"), done, make(chan bool), writer)
+	}()
+
+	received := make(chan bool)
+
+	go func() {
+		// we publish until the subscription has been set up
+		for {
+			updates.HandleEvent(&services.Event{
+				Type:      services.AppointmentBookedEvent,
+				Timestamp: time.Now(),
+				Data: map[string]interface{}{
+					"provider":    "abcd",
+					"appointment": "1234",
+				},
+			})
+			select {
+			case <-received:
+				return
+			case <-time.After(5 * time.Millisecond):
+			}
+		}
+	}()
+
+	lines := bufio.NewReader(reader)
+
+	if line, err := lines.ReadString('\n'); err != nil || line != "event: appointment\n" {
+		t.Fatalf("unexpected event line: %s (%v)", line, err)
+	}
+
+	line, err := lines.ReadString('\n')
+
+	if err != nil || !strings.HasPrefix(line, "data: ") {
+		t.Fatalf("unexpected data line: %s (%v)", line, err)
+	}
+
+	close(received)
+
+	update := &services.AppointmentUpdate{}
+
+	if err := json.Unmarshal([]byte(line[6:]), update); err != nil {
+		t.Fatal(err)
+	}
+
+	if update.ID != "1234" || update.Type != services.AppointmentBookedEvent {
+		t.Fatalf("unexpected update: %v", update)
+	}
+
+	// we drain the pipe so that the stream does not block on writes
+	go io.Copy(ioutil.Discard, lines)
+
+	close(done)
+
+	if err := <-finished; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,415 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/impfen/services-inoeg"
+	"github.com/impfen/services-inoeg/crypto"
+	"github.com/prometheus/client_golang/prometheus"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// A batch of events as it is delivered to a subscriber
+type WebhookBatch struct {
+	Subscriber string                  `json:"subscriber"`
+	Events     []*services.OutboxEvent `json:"events"`
+}
+
+// A batch that could not be delivered after the maximum number of attempts
+type DeadLetter struct {
+	Batch     *WebhookBatch `json:"batch"`
+	Error     string        `json:"error"`
+	Attempts  int64         `json:"attempts"`
+	Timestamp time.Time     `json:"timestamp"`
+}
+
+// WebhookStore persists the delivery state of the subscribers
+type WebhookStore interface {
+	Events(cursor, limit int64) ([]*services.OutboxEvent, int64, error)
+	Cursor(subscriber string) (int64, error)
+	SetCursor(subscriber string, cursor int64) error
+	DeadLetter(subscriber string, deadLetter *DeadLetter) error
+	Lock(subscriber string, ttl time.Duration) (services.Lock, error)
+}
+
+type WebhookMetrics struct {
+	Deliveries  *prometheus.CounterVec
+	Events      *prometheus.CounterVec
+	DeadLetters *prometheus.CounterVec
+	Latency     *prometheus.HistogramVec
+}
+
+func MakeWebhookMetrics(prefix string) *WebhookMetrics {
+	return &WebhookMetrics{
+		Deliveries: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: fmt.Sprintf("%s_webhook_deliveries_total", prefix),
+				Help: "Webhook delivery attempts",
+			},
+			[]string{"subscriber", "outcome"},
+		),
+		Events: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: fmt.Sprintf("%s_webhook_events_total", prefix),
+				Help: "Events delivered to webhook subscribers",
+			},
+			[]string{"subscriber"},
+		),
+		DeadLetters: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: fmt.Sprintf("%s_webhook_dead_letters_total", prefix),
+				Help: "Webhook batches moved to the dead-letter queue",
+			},
+			[]string{"subscriber"},
+		),
+		Latency: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    fmt.Sprintf("%s_webhook_latency_seconds", prefix),
+				Help:    "Duration of webhook delivery attempts",
+				Buckets: prometheus.DefBuckets,
+			},
+			[]string{"subscriber"},
+		),
+	}
+}
+
+func (m *WebhookMetrics) collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		m.Deliveries,
+		m.Events,
+		m.DeadLetters,
+		m.Latency,
+	}
+}
+
+func (m *WebhookMetrics) Register() error {
+	for _, collector := range m.collectors() {
+		if err := prometheus.Register(collector); err != nil {
+			return fmt.Errorf("error registering webhook metrics: %v", err)
+		}
+	}
+	return nil
+}
+
+func (m *WebhookMetrics) Unregister() {
+	for _, collector := range m.collectors() {
+		prometheus.Unregister(collector)
+	}
+}
+
+type webhookSubscriber struct {
+	settings *services.WebhookSubscriberSettings
+	key      *crypto.Key
+	events   map[string]bool
+	notify   chan bool
+}
+
+// Signs the timestamp and body of a request, the subscriber should reject
+// requests with old timestamps to prevent replays.
+func (w *webhookSubscriber) sign(timestamp string, body []byte) (string, error) {
+	message := append([]byte(timestamp+"."), body...)
+	if w.key != nil {
+		if signedData, err := w.key.Sign(message); err != nil {
+			return "", err
+		} else {
+			return "ecdsa=" + base64.StdEncoding.EncodeToString(signedData.Signature), nil
+		}
+	}
+	mac := hmac.New(sha256.New, w.settings.Secret)
+	mac.Write(message)
+	return "hmac-sha256=" + hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+func (w *webhookSubscriber) filter(events []*services.OutboxEvent) []*services.OutboxEvent {
+	if len(w.events) == 0 {
+		return events
+	}
+	filtered := make([]*services.OutboxEvent, 0, len(events))
+	for _, event := range events {
+		if w.events[event.Type] {
+			filtered = append(filtered, event)
+		}
+	}
+	return filtered
+}
+
+// WebhookDispatcher delivers the events from the outbox to the subscribers.
+// Every subscriber has its own cursor, so a slow subscriber does not hold up
+// the others. Events in the outbox are delivered at-least-once, subscribers
+// should use the event IDs to detect duplicates. Events that could not be
+// written to the outbox are not delivered at all (see recordEvent).
+type WebhookDispatcher struct {
+	settings    *services.WebhookSettings
+	store       WebhookStore
+	client      *http.Client
+	subscribers []*webhookSubscriber
+	metrics     *WebhookMetrics
+	stop        chan bool
+	wg          sync.WaitGroup
+}
+
+func MakeWebhookDispatcher(settings *services.WebhookSettings, keys []*crypto.Key, store WebhookStore) (*WebhookDispatcher, error) {
+
+	subscribers := make([]*webhookSubscriber, 0, len(settings.Subscribers))
+
+	for _, subscriberSettings := range settings.Subscribers {
+		subscriber := &webhookSubscriber{
+			settings: subscriberSettings,
+			events:   make(map[string]bool),
+			notify:   make(chan bool, 1),
+		}
+		if subscriberSettings.Key != "" {
+			if subscriber.key = services.Key(keys, subscriberSettings.Key); subscriber.key == nil {
+				return nil, fmt.Errorf("webhook key '%s' not found", subscriberSettings.Key)
+			}
+		} else if len(subscriberSettings.Secret) == 0 {
+			return nil, fmt.Errorf("webhook subscriber '%s' needs a secret or a key", subscriberSettings.Name)
+		}
+		for _, eventType := range subscriberSettings.Events {
+			subscriber.events[eventType] = true
+		}
+		subscribers = append(subscribers, subscriber)
+	}
+
+	return &WebhookDispatcher{
+		settings:    settings,
+		store:       store,
+		client:      &http.Client{Timeout: time.Duration(settings.Timeout) * time.Millisecond},
+		subscribers: subscribers,
+		metrics:     MakeWebhookMetrics("appointments"),
+	}, nil
+}
+
+// Wakes up the subscribers when a new event was written, so that we do not
+// need to wait for the next polling interval.
+func (w *WebhookDispatcher) HandleEvent(event *services.Event) error {
+	for _, subscriber := range w.subscribers {
+		select {
+		case subscriber.notify <- true:
+		default:
+		}
+	}
+	return nil
+}
+
+// Returns the delay before the given retry (starting at 1)
+func (w *WebhookDispatcher) backoff(retry int64) time.Duration {
+	delay := w.settings.Backoff
+	for i := int64(1); i < retry && delay < w.settings.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > w.settings.MaxBackoff {
+		delay = w.settings.MaxBackoff
+	}
+	return time.Duration(delay) * time.Millisecond
+}
+
+func (w *WebhookDispatcher) deliver(subscriber *webhookSubscriber, batch *WebhookBatch) error {
+
+	body, err := json.Marshal(batch)
+
+	if err != nil {
+		return err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	signature, err := subscriber.sign(timestamp, body)
+
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequest("POST", subscriber.settings.URL, bytes.NewReader(body))
+
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-Webhook-Timestamp", timestamp)
+	request.Header.Set("X-Webhook-Signature", signature)
+
+	response, err := w.client.Do(request)
+
+	if err != nil {
+		return err
+	}
+
+	// we read the body so that the connection can be reused
+	io.Copy(ioutil.Discard, response.Body)
+	response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code %d", response.StatusCode)
+	}
+
+	return nil
+}
+
+var errWebhookStopped = fmt.Errorf("dispatcher stopped")
+
+func (w *WebhookDispatcher) deliverWithRetries(subscriber *webhookSubscriber, batch *WebhookBatch, stop chan bool) error {
+	name := subscriber.settings.Name
+	var err error
+	for attempt := int64(1); attempt <= w.settings.MaxAttempts; attempt++ {
+		if attempt > 1 {
+			select {
+			case <-time.After(w.backoff(attempt - 1)):
+			case <-stop:
+				return errWebhookStopped
+			}
+		}
+		start := time.Now()
+		err = w.deliver(subscriber, batch)
+		w.metrics.Latency.WithLabelValues(name).Observe(time.Since(start).Seconds())
+		if err == nil {
+			w.metrics.Deliveries.WithLabelValues(name, "success").Inc()
+			w.metrics.Events.WithLabelValues(name).Add(float64(len(batch.Events)))
+			return nil
+		}
+		w.metrics.Deliveries.WithLabelValues(name, "failure").Inc()
+		services.Log.Warningf("webhook delivery to '%s' failed (attempt %d): %v", name, attempt, err)
+	}
+	return err
+}
+
+// Delivers the next batch of events to the subscriber. Returns true if
+// there might be more events to deliver.
+func (w *WebhookDispatcher) process(subscriber *webhookSubscriber, stop chan bool) bool {
+
+	name := subscriber.settings.Name
+
+	// we make sure that only one server delivers to a subscriber at a time
+	ttl := time.Duration(w.settings.MaxAttempts*(w.settings.Timeout+w.settings.MaxBackoff)) * time.Millisecond
+	lock, err := w.store.Lock(name, ttl)
+
+	if err != nil {
+		services.Log.Debugf("cannot obtain webhook lock for '%s', skipping: %v", name, err)
+		return false
+	}
+
+	if lock != nil {
+		defer lock.Release()
+	}
+
+	cursor, err := w.store.Cursor(name)
+
+	if err != nil {
+		services.Log.Error(err)
+		return false
+	}
+
+	events, next, err := w.store.Events(cursor, w.settings.BatchSize)
+
+	if err != nil {
+		services.Log.Error(err)
+		return false
+	}
+
+	if next == cursor {
+		// we have caught up
+		return false
+	}
+
+	batch := &WebhookBatch{
+		Subscriber: name,
+		Events:     subscriber.filter(events),
+	}
+
+	if len(batch.Events) > 0 {
+		if err := w.deliverWithRetries(subscriber, batch, stop); err != nil {
+			if err == errWebhookStopped {
+				// we will retry this batch after a restart
+				return false
+			}
+			if err := w.store.DeadLetter(name, &DeadLetter{
+				Batch:     batch,
+				Error:     err.Error(),
+				Attempts:  w.settings.MaxAttempts,
+				Timestamp: time.Now().UTC(),
+			}); err != nil {
+				services.Log.Error(err)
+				return false
+			}
+			w.metrics.DeadLetters.WithLabelValues(name).Inc()
+		}
+	}
+
+	if err := w.store.SetCursor(name, next); err != nil {
+		services.Log.Error(err)
+		return false
+	}
+
+	return true
+}
+
+func (w *WebhookDispatcher) loop(subscriber *webhookSubscriber, stop chan bool) {
+	defer w.wg.Done()
+	ticker := time.NewTicker(time.Duration(w.settings.Interval) * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		// we deliver batches until we have caught up
+		for w.process(subscriber, stop) {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+		}
+		select {
+		case <-ticker.C:
+		case <-subscriber.notify:
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (w *WebhookDispatcher) Start() {
+	if w.stop != nil {
+		return
+	}
+	w.stop = make(chan bool)
+	for _, subscriber := range w.subscribers {
+		w.wg.Add(1)
+		go w.loop(subscriber, w.stop)
+	}
+}
+
+func (w *WebhookDispatcher) Stop() {
+	if w.stop == nil {
+		return
+	}
+	close(w.stop)
+	w.wg.Wait()
+	w.stop = nil
+}
@@ -0,0 +1,201 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package servers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/impfen/services-inoeg"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type memoryWebhookStore struct {
+	events      []*services.OutboxEvent
+	cursors     map[string]int64
+	deadLetters map[string][]*DeadLetter
+}
+
+func makeMemoryWebhookStore(eventTypes ...string) *memoryWebhookStore {
+	store := &memoryWebhookStore{
+		cursors:     make(map[string]int64),
+		deadLetters: make(map[string][]*DeadLetter),
+	}
+	for i, eventType := range eventTypes {
+		store.events = append(store.events, &services.OutboxEvent{
+			ID: int64(i + 1),
+			Event: services.Event{
+				Type:      eventType,
+				Timestamp: time.Now().UTC(),
+				Data:      map[string]interface{}{},
+			},
+		})
+	}
+	return store
+}
+
+func (m *memoryWebhookStore) Events(cursor, limit int64) ([]*services.OutboxEvent, int64, error) {
+	events := make([]*services.OutboxEvent, 0)
+	for _, event := range m.events {
+		if event.ID > cursor && int64(len(events)) < limit {
+			events = append(events, event)
+		}
+	}
+	if len(events) > 0 {
+		cursor = events[len(events)-1].ID
+	}
+	return events, cursor, nil
+}
+
+func (m *memoryWebhookStore) Cursor(subscriber string) (int64, error) {
+	return m.cursors[subscriber], nil
+}
+
+func (m *memoryWebhookStore) SetCursor(subscriber string, cursor int64) error {
+	m.cursors[subscriber] = cursor
+	return nil
+}
+
+func (m *memoryWebhookStore) DeadLetter(subscriber string, deadLetter *DeadLetter) error {
+	m.deadLetters[subscriber] = append(m.deadLetters[subscriber], deadLetter)
+	return nil
+}
+
+func (m *memoryWebhookStore) Lock(subscriber string, ttl time.Duration) (services.Lock, error) {
+	return nil, nil
+}
+
+func webhookSettings(url string) *services.WebhookSettings {
+	return &services.WebhookSettings{
+		BatchSize:   2,
+		MaxAttempts: 3,
+		Backoff:     1,
+		MaxBackoff:  4,
+		Interval:    10,
+		Timeout:     1000,
+		Subscribers: []*services.WebhookSubscriberSettings{
+			{
+				Name:   "test",
+				URL:    url,
+				Events: []string{services.AppointmentBookedEvent},
+				Secret: []byte("0123456789abcdef"),
+			},
+		},
+	}
+}
+
+func TestWebhookDelivery(t *testing.T) {
+
+	batches := make([]*WebhookBatch, 0)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mac := hmac.New(sha256.New, []byte("0123456789abcdef"))
+		mac.Write([]byte(r.Header.Get("X-Webhook-Timestamp") + "."))
+		mac.Write(body)
+		if r.Header.Get("X-Webhook-Signature") != "hmac-sha256="+hex.EncodeToString(mac.Sum(nil)) {
+			w.WriteHeader(401)
+			return
+		}
+		batch := &WebhookBatch{}
+		if err := json.Unmarshal(body, batch); err != nil {
+			w.WriteHeader(400)
+			return
+		}
+		batches = append(batches, batch)
+	}))
+	defer server.Close()
+
+	store := makeMemoryWebhookStore(
+		services.AppointmentBookedEvent,
+		services.AppointmentCancelledEvent,
+		services.AppointmentBookedEvent,
+	)
+
+	dispatcher, err := MakeWebhookDispatcher(webhookSettings(server.URL), nil, store)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subscriber := dispatcher.subscribers[0]
+
+	for dispatcher.process(subscriber, nil) {
+	}
+
+	if store.cursors["test"] != 3 {
+		t.Fatalf("expected cursor 3, got %d", store.cursors["test"])
+	}
+
+	if len(batches) != 2 || len(batches[0].Events) != 1 || len(batches[1].Events) != 1 {
+		t.Fatalf("unexpected batches: %v", batches)
+	}
+
+	if batches[0].Events[0].ID != 1 || batches[1].Events[0].ID != 3 {
+		t.Fatalf("cancellation should have been filtered")
+	}
+}
+
+func TestWebhookDeadLetter(t *testing.T) {
+
+	attempts := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(500)
+	}))
+	defer server.Close()
+
+	store := makeMemoryWebhookStore(services.AppointmentBookedEvent)
+
+	dispatcher, err := MakeWebhookDispatcher(webhookSettings(server.URL), nil, store)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !dispatcher.process(dispatcher.subscribers[0], make(chan bool)) {
+		t.Fatalf("expected the cursor to advance")
+	}
+
+	if attempts != 3 {
+		t.Fatalf("expected 3 attempts, got %d", attempts)
+	}
+
+	if len(store.deadLetters["test"]) != 1 || store.cursors["test"] != 1 {
+		t.Fatalf("expected batch to be dead-lettered")
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	dispatcher, err := MakeWebhookDispatcher(webhookSettings(""), nil, makeMemoryWebhookStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for retry, expected := range []int64{1, 2, 4, 4} {
+		if delay := dispatcher.backoff(int64(retry + 1)); delay != time.Duration(expected)*time.Millisecond {
+			t.Fatalf("retry %d: expected %dms, got %v", retry+1, expected, delay)
+		}
+	}
+}
@@ -50,7 +50,11 @@ type AppointmentsSettings struct {
 	ResponseMinNAggregated    int64                  `json:"response_min_n_aggregated"`
 	ResponseMaxDaysAggregated int64                  `json:"response_max_days_aggregated"`
 	MaxTokensPerUser          int64                  `json:"max_tokens_per_user"`
+	IdempotencyTTLHours       int64                  `json:"idempotency_ttl_hours"`
 	Validate                  *ValidateSettings      `json:"validate"`
+	Signer                    *RemoteSignerSettings  `json:"signer,omitempty"`
+	StatsPrivacy              *StatsPrivacySettings  `json:"stats_privacy,omitempty"`
+	Webhooks                  *WebhookSettings       `json:"webhooks,omitempty"`
 }
 
 func (a *AppointmentsSettings) Key(name string) *crypto.Key {
@@ -70,6 +74,67 @@ func (s *SigningSettings) Key(name string) *crypto.Key {
 	return Key(s.Keys, name)
 }
 
+// Settings for the out-of-process signing daemon
+type SignerSettings struct {
+	Socket string        `json:"socket"`
+	Keys   []*crypto.Key `json:"keys"`
+}
+
+// Settings for servers that delegate signing to the signing daemon
+type RemoteSignerSettings struct {
+	Socket string   `json:"socket"`
+	Keys   []string `json:"keys"`
+}
+
+// Settings for the differential privacy layer of the public statistics
+type StatsPrivacySettings struct {
+	// privacy loss per query and metric
+	Epsilon float64 `json:"epsilon"`
+	// total privacy loss per metric and budget period
+	Budget float64 `json:"budget"`
+	// length of the budget period in seconds
+	BudgetPeriod int64 `json:"budget_period"`
+	// noisy values below this threshold are suppressed
+	MinCount int64                    `json:"min_count"`
+	Metrics  []*MetricPrivacySettings `json:"metrics,omitempty"`
+	// maximum number of queries per client and time window that spend budget,
+	// clients are identified by their IP address, so behind a reverse proxy
+	// this requires the proxy to be listed in the trusted proxies of the HTTP
+	// server (otherwise all clients share the limit of the proxy address)
+	RateLimit *RateLimit `json:"rate_limit,omitempty"`
+}
+
+type MetricPrivacySettings struct {
+	Name        string  `json:"name"`
+	Sensitivity float64 `json:"sensitivity"`
+}
+
+// Settings for the delivery of domain events to webhook subscribers. All
+// durations are given in milliseconds.
+type WebhookSettings struct {
+	// maximum number of events per request
+	BatchSize int64 `json:"batch_size"`
+	// number of delivery attempts before a batch is dead-lettered
+	MaxAttempts int64 `json:"max_attempts"`
+	// delay before the first retry, doubled for every further retry
+	Backoff     int64                        `json:"backoff"`
+	MaxBackoff  int64                        `json:"max_backoff"`
+	Interval    int64                        `json:"interval"`
+	Timeout     int64                        `json:"timeout"`
+	Subscribers []*WebhookSubscriberSettings `json:"subscribers"`
+}
+
+type WebhookSubscriberSettings struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	// event types to deliver, all types if empty
+	Events []string `json:"events,omitempty"`
+	// secret for HMAC-SHA256 signatures
+	Secret []byte `json:"secret,omitempty"`
+	// name of the appointments key used for ECDSA signatures
+	Key string `json:"key,omitempty"`
+}
+
 type SigningSettings struct {
 	Keys []*crypto.Key `json:"keys"`
 }
@@ -80,8 +145,32 @@ type DatabaseSettings struct {
 }
 
 type MeterSettings struct {
-	Type     string `json:"type"`
-	Settings interface{}
+	Type      string `json:"type"`
+	Settings  interface{}
+	Retention *RetentionSettings `json:"retention,omitempty"`
+	// metrics for which AddOnce counts unique uids approximately
+	Approximate []string `json:"approximate,omitempty"`
+}
+
+// Settings for the retention and compaction of meter values
+type RetentionSettings struct {
+	Policies []*RetentionPolicy `json:"policies"`
+	// metrics that are rolled up by their maximum instead of their sum
+	Gauges []string `json:"gauges"`
+	// unique counts (see Meter.AddOnce), which cannot be derived from finer
+	// windows and are therefore never rolled up
+	Unique []string `json:"unique"`
+	// interval between two compaction runs in seconds
+	Interval int64 `json:"interval"`
+}
+
+type RetentionPolicy struct {
+	// time window type the policy applies to
+	Type string `json:"type"`
+	// number of days after which values are deleted
+	Days int64 `json:"days"`
+	// optional coarser time window type to roll values into before deletion
+	RollupTo string `json:"rollup_to,omitempty"`
 }
 
 type Settings struct {
@@ -93,6 +182,7 @@ type Settings struct {
 	Database     *DatabaseSettings     `json:"database,omitempty"`
 	Meter        *MeterSettings        `json:"meter,omitempty"`
 	Metrics      *MetricSettings       `json:"metrics,omitempty"`
+	Signer       *SignerSettings       `json:"signer,omitempty"`
 	DatabaseObj  Database              `json:"-"`
 	MeterObj     Meter                 `json:"-"`
 	MetricsObj   MetricsServer         `json:"-"`
@@ -129,6 +219,8 @@ type CorsSettings struct {
 type JSONRPCServerSettings struct {
 	Cors *CorsSettings       `json:"cors,omitempty"`
 	HTTP *HTTPServerSettings `json:"http,omitempty"`
+	// maximum number of calls in a batch request
+	MaxBatchSize int64 `json:"max_batch_size,omitempty"`
 }
 
 // Settings for the REST server
@@ -151,6 +243,9 @@ type HTTPServerSettings struct {
 	TLS           *TLSSettings `json:"tls,omitempty"`
 	BindAddress   string       `json:"bind_address"`
 	TCPRateLimits []*RateLimit `json:"tcp_rate_limits"`
+	// addresses or CIDR ranges of reverse proxies whose X-Forwarded-For
+	// header we use to determine the address of the client
+	TrustedProxies []string `json:"trusted_proxies,omitempty"`
 }
 
 type RateLimit struct {
@@ -0,0 +1,179 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package signer
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/impfen/services-inoeg/crypto"
+	"net/rpc"
+	"sync"
+	"time"
+)
+
+var timeoutError = fmt.Errorf("signing request timed out")
+
+// Client implements the crypto.Signer interface for a given key held by
+// the signing daemon. If a public key is given, the client verifies that
+// the daemon holds the matching private key whenever it connects.
+type Client struct {
+	socket    string
+	key       string
+	publicKey []byte
+	timeout   time.Duration
+	mutex     sync.Mutex
+	client    *rpc.Client
+}
+
+func MakeClient(socket, key string, publicKey []byte) *Client {
+	return &Client{
+		socket:    socket,
+		key:       key,
+		publicKey: publicKey,
+		timeout:   5 * time.Second,
+	}
+}
+
+func (c *Client) rpcClient() (*rpc.Client, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.client == nil {
+		if client, err := rpc.Dial("unix", c.socket); err != nil {
+			return nil, err
+		} else if err := c.verify(client); err != nil {
+			client.Close()
+			return nil, err
+		} else {
+			c.client = client
+		}
+	}
+	return c.client, nil
+}
+
+// we make sure that the daemon signs with the key we expect, as otherwise
+// we would hand out signatures that nobody can verify
+func (c *Client) verify(client *rpc.Client) error {
+	if c.publicKey == nil {
+		return nil
+	}
+	response := &PublicKeyResponse{}
+	call := client.Go(serviceName+".PublicKey", &PublicKeyRequest{Key: c.key}, response, make(chan *rpc.Call, 1))
+	select {
+	case <-call.Done:
+		if call.Error != nil {
+			return call.Error
+		}
+	case <-time.After(c.timeout):
+		return timeoutError
+	}
+	if !bytes.Equal(response.PublicKey, c.publicKey) {
+		return fmt.Errorf("public key of signing daemon does not match key '%s'", c.key)
+	}
+	return nil
+}
+
+// Checks that the daemon is reachable and holds the expected key.
+func (c *Client) Verify() error {
+	_, err := c.rpcClient()
+	return err
+}
+
+// we drop a broken connection so that the next request reconnects
+func (c *Client) reset(client *rpc.Client) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.client == client {
+		c.client.Close()
+		c.client = nil
+	}
+}
+
+func (c *Client) call(request *SignRequest) (*SignResponse, error) {
+	client, err := c.rpcClient()
+	if err != nil {
+		return nil, err
+	}
+
+	response := &SignResponse{}
+	call := client.Go(serviceName+".Sign", request, response, make(chan *rpc.Call, 1))
+
+	select {
+	case <-call.Done:
+		if call.Error != nil {
+			// errors returned by the daemon do not affect the connection
+			if _, ok := call.Error.(rpc.ServerError); !ok {
+				c.reset(client)
+			}
+			return nil, call.Error
+		}
+		return response, nil
+	case <-time.After(c.timeout):
+		c.reset(client)
+		return nil, timeoutError
+	}
+}
+
+func (c *Client) Sign(data []byte) (*crypto.SignedData, error) {
+	request := &SignRequest{
+		Key:  c.key,
+		Data: data,
+	}
+
+	response, err := c.call(request)
+
+	if err != nil && err != timeoutError {
+		if _, ok := err.(rpc.ServerError); !ok {
+			// the daemon might have been restarted, so we try again once
+			response, err = c.call(request)
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &crypto.SignedData{
+		Data:      data,
+		Signature: response.Signature,
+		PublicKey: response.PublicKey,
+	}, nil
+}
+
+func (c *Client) SignString(data string) (*crypto.SignedStringData, error) {
+	if signature, err := c.Sign([]byte(data)); err != nil {
+		return nil, err
+	} else {
+		return &crypto.SignedStringData{
+			Data:      string(signature.Data),
+			Signature: signature.Signature,
+			PublicKey: signature.PublicKey,
+		}, nil
+	}
+}
+
+func (c *Client) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.client == nil {
+		return nil
+	}
+	err := c.client.Close()
+	c.client = nil
+	return err
+}
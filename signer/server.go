@@ -0,0 +1,153 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package signer
+
+import (
+	"fmt"
+	"github.com/impfen/services-inoeg"
+	"github.com/impfen/services-inoeg/crypto"
+	"net"
+	"net/rpc"
+	"os"
+	"sync"
+)
+
+type Server struct {
+	settings  *services.SignerSettings
+	rpcServer *rpc.Server
+	listener  net.Listener
+	mutex     sync.Mutex
+	waitGroup sync.WaitGroup
+}
+
+// the RPC service that is exposed via the socket
+type Service struct {
+	keys map[string]*crypto.Key
+}
+
+func (s *Service) Sign(request *SignRequest, response *SignResponse) error {
+	key, ok := s.keys[request.Key]
+	if !ok {
+		return fmt.Errorf("unknown key: '%s'", request.Key)
+	}
+	if signedData, err := key.Sign(request.Data); err != nil {
+		services.Log.Error(err)
+		return fmt.Errorf("signing failed")
+	} else {
+		response.Signature = signedData.Signature
+		response.PublicKey = signedData.PublicKey
+		return nil
+	}
+}
+
+func (s *Service) PublicKey(request *PublicKeyRequest, response *PublicKeyResponse) error {
+	key, ok := s.keys[request.Key]
+	if !ok {
+		return fmt.Errorf("unknown key: '%s'", request.Key)
+	}
+	response.PublicKey = key.PublicKey
+	return nil
+}
+
+func MakeServer(settings *services.SignerSettings) (*Server, error) {
+
+	service := &Service{
+		keys: make(map[string]*crypto.Key),
+	}
+
+	for _, key := range settings.Keys {
+		if key.PrivateKey == nil {
+			return nil, fmt.Errorf("private key missing for key '%s'", key.Name)
+		}
+		service.keys[key.Name] = key
+	}
+
+	rpcServer := rpc.NewServer()
+
+	if err := rpcServer.RegisterName(serviceName, service); err != nil {
+		return nil, err
+	}
+
+	return &Server{
+		settings:  settings,
+		rpcServer: rpcServer,
+	}, nil
+}
+
+func (s *Server) Start() error {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.listener != nil {
+		return fmt.Errorf("already running")
+	}
+
+	// we remove a stale socket from a previous run
+	if err := os.Remove(s.settings.Socket); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	listener, err := net.Listen("unix", s.settings.Socket)
+
+	if err != nil {
+		return err
+	}
+
+	// only the user running the daemon may connect to the socket
+	if err := os.Chmod(s.settings.Socket, 0600); err != nil {
+		listener.Close()
+		return err
+	}
+
+	s.listener = listener
+	s.waitGroup.Add(1)
+
+	go s.serve(listener)
+
+	return nil
+}
+
+func (s *Server) serve(listener net.Listener) {
+	defer s.waitGroup.Done()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			// the listener was closed
+			return
+		}
+		go s.rpcServer.ServeConn(conn)
+	}
+}
+
+func (s *Server) Stop() error {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.listener == nil {
+		return nil
+	}
+
+	err := s.listener.Close()
+	s.waitGroup.Wait()
+	s.listener = nil
+
+	return err
+}
@@ -0,0 +1,46 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+/*
+Package signer implements an out-of-process signing daemon that holds private
+keys and signs data on behalf of other processes via a Unix socket, as well as
+a client that implements the crypto.Signer interface. This allows us to keep
+e.g. the token key out of the internet-facing appointments server.
+*/
+package signer
+
+// name of the RPC service
+const serviceName = "Signer"
+
+type SignRequest struct {
+	Key  string `json:"key"`
+	Data []byte `json:"data"`
+}
+
+type SignResponse struct {
+	Signature []byte `json:"signature"`
+	PublicKey []byte `json:"publicKey"`
+}
+
+type PublicKeyRequest struct {
+	Key string `json:"key"`
+}
+
+type PublicKeyResponse struct {
+	PublicKey []byte `json:"publicKey"`
+}
@@ -0,0 +1,79 @@
+// Kiebitz - Privacy-Friendly Appointment Scheduling
+// Copyright (C) 2021-2021 The Kiebitz Authors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version. Additional terms
+// as defined in section 7 of the license (e.g. regarding attribution)
+// are specified at https://kiebitz.eu/en/docs/open-source/additional-terms.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package signer
+
+import (
+	"github.com/impfen/services-inoeg"
+	"github.com/impfen/services-inoeg/crypto"
+	"path/filepath"
+	"testing"
+)
+
+func TestSignViaSocket(t *testing.T) {
+
+	key, err := crypto.GenerateWebKey("token", "ecdsa")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	settings := &services.SignerSettings{
+		Socket: filepath.Join(t.TempDir(), "signer.sock"),
+		Keys:   []*crypto.Key{key},
+	}
+
+	server, err := MakeServer(settings)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	defer server.Stop()
+
+	client := MakeClient(settings.Socket, "token", key.PublicKey)
+	defer client.Close()
+
+	if signedData, err := client.SignString("test"); err != nil {
+		t.Fatal(err)
+	} else if ok, err := key.VerifyString(signedData); err != nil {
+		t.Fatal(err)
+	} else if !ok {
+		t.Fatalf("Expected a valid signature")
+	}
+
+	if _, err := MakeClient(settings.Socket, "root", nil).Sign([]byte("test")); err == nil {
+		t.Fatalf("Expected an error for an unknown key")
+	}
+
+	otherKey, err := crypto.GenerateWebKey("token", "ecdsa")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the daemon holds a different token key than the one we expect
+	if _, err := MakeClient(settings.Socket, "token", otherKey.PublicKey).Sign([]byte("test")); err == nil {
+		t.Fatalf("Expected an error for a mismatching public key")
+	}
+
+}
@@ -17,3 +17,73 @@
 // along with this program.  If not, see <https://www.gnu.org/licenses/>.
 
 package fixtures
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/impfen/services-inoeg"
+	"github.com/impfen/services-inoeg/crypto"
+	"github.com/impfen/services-inoeg/helpers"
+)
+
+type User struct {
+}
+
+// Creates a new user and gets a token for it
+func (c User) Setup(fixtures map[string]interface{}) (interface{}, error) {
+
+	client, ok := fixtures["client"].(*helpers.Client)
+
+	if !ok {
+		return nil, fmt.Errorf("client missing")
+	}
+
+	actor, err := crypto.MakeActor("user")
+
+	if err != nil {
+		return nil, err
+	}
+
+	hash, err := crypto.RandomBytes(32)
+
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Appointments.GetToken(&services.GetTokenParams{
+		Hash:      hash,
+		PublicKey: actor.SigningKey.PublicKey,
+	})
+
+	if err != nil {
+		return nil, err
+	} else if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("cannot get token")
+	}
+
+	var result struct {
+		Result *services.SignedTokenData `json:"result"`
+	}
+
+	if data, err := resp.Bytes(); err != nil {
+		return nil, err
+	} else if err := json.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+
+	signedTokenData := result.Result
+
+	if err := json.Unmarshal([]byte(signedTokenData.JSON), &signedTokenData.Data); err != nil {
+		return nil, err
+	}
+
+	return &helpers.User{
+		Actor:           actor,
+		SignedTokenData: signedTokenData,
+	}, nil
+
+}
+
+func (c User) Teardown(fixture interface{}) error {
+	return nil
+}